@@ -3,6 +3,7 @@ package analysis
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -195,6 +196,9 @@ func RetrieveStockDataMonthly(ctx context.Context, params AlphaVantageParam) (*S
 // need to query db and fit daily monthly close price to stockdatamonthly
 const DefaultRequiredMonths = 180
 
+// ErrInsufficientHistory is returned when a ticker has fewer months than requested.
+var ErrInsufficientHistory = errors.New("insufficient price history")
+
 func MakeMonthlyDataSlice(ctx context.Context, symbols []string, stockDB *database.StockDB, requiredMonths int) ([]*StockDataMonthly, error) {
 
 	if requiredMonths < 2 {
@@ -215,18 +219,96 @@ func MakeMonthlyDataSlice(ctx context.Context, symbols []string, stockDB *databa
 			continue
 		}
 
-		monthly := make(map[string]database.StockData)
-		for _, d := range dailyData {
-			key := database.MonthKey(d.Date)
+		md := monthlyFromDaily(symbol, dailyData)
+		if err := truncateToMonths(md, requiredMonths); err != nil {
+			return nil, err
+		}
+
+		dataSlice = append(dataSlice, md)
+	}
+
+	if len(dataSlice) == 0 {
+		return nil, fmt.Errorf("no valid monthly data produced")
+	}
 
-			if prev, ok := monthly[key]; !ok || d.Date > prev.Date {
-				monthly[key] = d
+	return dataSlice, nil
+}
+
+// MakeMonthlyHistory loads monthly data like MakeMonthlyDataSlice but
+// leniently: symbols without data are skipped and histories shorter than
+// lookbackMonths are kept whole. Benchmark indexes are built from whichever
+// constituents trade in each month, and backtests pick their own window.
+// Only the month-end closes of the last lookbackMonths calendar months are
+// read, in one query, so indexes of hundreds of tickers load quickly.
+func MakeMonthlyHistory(ctx context.Context, symbols []string, stockDB *database.StockDB, lookbackMonths int) ([]*StockDataMonthly, error) {
+	dataSlice := make([]*StockDataMonthly, 0, len(symbols))
+	monthEnds, err := stockDB.QueryMonthEndStockData(ctx, symbols, lookbackMonths)
+	if err != nil {
+		return nil, fmt.Errorf("query failed for %d symbols: %w", len(symbols), err)
+	}
+	for _, symbol := range symbols {
+		dailyData := monthEnds[symbol]
+		if len(dailyData) == 0 {
+			continue
+		}
+		md := monthlyFromDaily(symbol, dailyData)
+		if len(md.TimeSeriesMonthly) > lookbackMonths {
+			if err := truncateToMonths(md, lookbackMonths); err != nil {
+				return nil, err
 			}
 		}
+		dataSlice = append(dataSlice, md)
+	}
+	return dataSlice, nil
+}
 
-		md := &StockDataMonthly{}
-		md.MetaData.Symbol = symbol
-		md.TimeSeriesMonthly = make(map[string]struct {
+// MakeDailyHistory loads every stored adjusted close of each symbol. A symbol
+// without data gets an empty series, so callers can report it.
+func MakeDailyHistory(ctx context.Context, symbols []string, stockDB *database.StockDB) (map[string]DailySeries, error) {
+	history := make(map[string]DailySeries, len(symbols))
+	for _, symbol := range symbols {
+		dailyData, err := stockDB.QueryStockData(ctx, symbol)
+		if err != nil {
+			return nil, fmt.Errorf("query failed for %s: %w", symbol, err)
+		}
+		var s DailySeries
+		for _, d := range dailyData {
+			if d.AdjClose <= 0 || len(d.Date) < 10 {
+				continue
+			}
+			s.Dates = append(s.Dates, d.Date[:10])
+			s.Closes = append(s.Closes, d.AdjClose)
+		}
+		history[symbol] = s
+	}
+	return history, nil
+}
+
+// monthlyFromDaily keeps the last adjusted close of each month.
+func monthlyFromDaily(symbol string, dailyData []database.StockData) *StockDataMonthly {
+	monthly := make(map[string]database.StockData)
+	for _, d := range dailyData {
+		key := database.MonthKey(d.Date)
+
+		if prev, ok := monthly[key]; !ok || d.Date > prev.Date {
+			monthly[key] = d
+		}
+	}
+
+	md := &StockDataMonthly{}
+	md.MetaData.Symbol = symbol
+	md.TimeSeriesMonthly = make(map[string]struct {
+		Open      string `json:"1. open"`
+		High      string `json:"2. high"`
+		Low       string `json:"3. low"`
+		Close     string `json:"4. close"`
+		AdjClose  string `json:"5. adjusted close"`
+		Volume    string `json:"6. volume"`
+		DivAmount string `json:"7. dividend amount"`
+	})
+
+	for month, d := range monthly {
+		md.TimeSeriesMonthly[month] = struct {
 			Open      string `json:"1. open"`
 			High      string `json:"2. high"`
 			Low       string `json:"3. low"`
@@ -234,40 +316,18 @@ func MakeMonthlyDataSlice(ctx context.Context, symbols []string, stockDB *databa
 			AdjClose  string `json:"5. adjusted close"`
 			Volume    string `json:"6. volume"`
 			DivAmount string `json:"7. dividend amount"`
-		})
-
-		for month, d := range monthly {
-			md.TimeSeriesMonthly[month] = struct {
-				Open      string `json:"1. open"`
-				High      string `json:"2. high"`
-				Low       string `json:"3. low"`
-				Close     string `json:"4. close"`
-				AdjClose  string `json:"5. adjusted close"`
-				Volume    string `json:"6. volume"`
-				DivAmount string `json:"7. dividend amount"`
-			}{
-				AdjClose: strconv.FormatFloat(d.AdjClose, 'f', -1, 64),
-			}
-		}
-
-		if err := truncateToMonths(md, requiredMonths); err != nil {
-			return nil, err
+		}{
+			AdjClose: strconv.FormatFloat(d.AdjClose, 'f', -1, 64),
 		}
-
-		dataSlice = append(dataSlice, md)
-	}
-
-	if len(dataSlice) == 0 {
-		return nil, fmt.Errorf("no valid monthly data produced")
 	}
-
-	return dataSlice, nil
+	return md
 }
 
 func truncateToMonths(md *StockDataMonthly, requiredMonths int) error {
 	if len(md.TimeSeriesMonthly) < requiredMonths {
 		return fmt.Errorf(
-			"symbol %s has %d months, requires %d",
+			"%w: symbol %s has %d months, requires %d",
+			ErrInsufficientHistory,
 			md.MetaData.Symbol,
 			len(md.TimeSeriesMonthly),
 			requiredMonths,
@@ -473,7 +473,7 @@ func TestWorkflow(t *testing.T) {
 
 	// Step 6: Monte Carlo Portfolio Optimization
 	t.Log("\n=== Step 6: Monte Carlo Optimization ===")
-	portfolios, best := analysis.OptimizePortfolio(returns, 100, 0.0, 0.02, 0.20)
+	portfolios, best := analysis.OptimizePortfolio(returns, 100, 0.0, 0.02, 0.20, 1)
 	t.Logf("Best portfolio: %+v", best)
 	t.Logf("Total portfolios: %d", len(portfolios))
 
@@ -0,0 +1,322 @@
+package analysis
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// RebalanceSchedule says when a backtest trades back to its target weights.
+// Trades happen at a month's close, after that month's return.
+type RebalanceSchedule string
+
+const (
+	RebalanceMonthly   RebalanceSchedule = "monthly"
+	RebalanceQuarterly RebalanceSchedule = "quarterly" // after March, June, September and December
+	RebalanceAnnual    RebalanceSchedule = "annual"    // after December
+	RebalanceThreshold RebalanceSchedule = "threshold" // once a weight drifts more than the threshold from its target
+	RebalanceNone      RebalanceSchedule = "none"      // buy and hold
+)
+
+const DefaultDriftThreshold = 0.05
+
+// ParseRebalanceSchedule maps a request value onto a schedule. Empty selects
+// RebalanceMonthly, the assumption the rest of the package makes.
+func ParseRebalanceSchedule(s string) (RebalanceSchedule, error) {
+	switch r := RebalanceSchedule(strings.ToLower(strings.TrimSpace(s))); r {
+	case "":
+		return RebalanceMonthly, nil
+	case RebalanceMonthly, RebalanceQuarterly, RebalanceAnnual, RebalanceThreshold, RebalanceNone:
+		return r, nil
+	default:
+		return "", fmt.Errorf("unknown rebalance schedule %q", s)
+	}
+}
+
+// BacktestConfig describes a backtest. Exactly one of Weights and Strategy is
+// set: fixed target weights, or an optimizer re-run at every rebalance on the
+// TrainMonths of returns before it, so each trade only uses past data.
+type BacktestConfig struct {
+	Start string // first month held, "2006-01"; empty starts as early as the data allows
+	End   string // last month held; empty runs to the end of the data
+
+	Rebalance RebalanceSchedule
+	Threshold float64 // RebalanceThreshold only; absolute drift, 0 uses DefaultDriftThreshold
+
+	Weights     map[string]float64 // ticker -> target weight, summing to 1
+	Strategy    *OptimizerConfig
+	TrainMonths int // Strategy only
+
+	GapPolicy GapPolicy  // zero means GapForwardFill; see alignValuePath
+	Benchmark *Benchmark // optional; aligned and compared with in the risk report
+	Risk      RiskConfig // risk-free rate and confidence; Frequency and Months are filled in
+}
+
+// Rebalance is one trade back to target weights at a month's close.
+type Rebalance struct {
+	Month    string
+	Weights  map[string]float64 // after the trade
+	Turnover float64            // one-way, ½Σ|target - drifted|; 1 for the initial purchase
+}
+
+// BacktestResult is the value path of a backtested portfolio. A portfolio
+// that loses everything ends in the month it does, at an Equity of 0.
+type BacktestResult struct {
+	Months  []string
+	Equity  []float64 // value at each month's close, growing 1 invested at the close before Months[0]
+	Returns []float64
+
+	Rebalances     []Rebalance // the first is the initial purchase
+	Turnover       float64     // summed over the rebalances after the initial purchase
+	AnnualTurnover float64
+
+	Risk *PortfolioRisk
+	Gaps GapReport
+
+	BenchmarkName    string    `json:",omitempty"`
+	BenchmarkReturns []float64 `json:",omitempty"`
+}
+
+// OrchestrateBacktest aligns the monthly data and simulates cfg over it.
+func OrchestrateBacktest(ctx context.Context, monthly []*StockDataMonthly, cfg BacktestConfig) (*BacktestResult, error) {
+	if len(monthly) == 0 {
+		return nil, fmt.Errorf("no monthly data provided")
+	}
+	if (cfg.Weights == nil) == (cfg.Strategy == nil) {
+		return nil, fmt.Errorf("a backtest needs either fixed weights or a strategy")
+	}
+	panel, err := alignValuePath(monthly, cfg.GapPolicy)
+	if err != nil {
+		return nil, err
+	}
+	var benchmark []float64
+	if cfg.Benchmark, benchmark, err = panel.alignBenchmark(cfg.Benchmark); err != nil {
+		return nil, err
+	}
+	result, err := backtest(ctx, panel, benchmark, cfg)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Benchmark != nil {
+		result.BenchmarkName = cfg.Benchmark.Name
+	}
+	return result, nil
+}
+
+// alignValuePath aligns monthly data for a value path compounded month after
+// month. A month GapDrop removes would vanish from the path together with
+// every holding's return in it, so the default is GapForwardFill and GapDrop
+// is refused once it drops a month.
+func alignValuePath(monthly []*StockDataMonthly, policy GapPolicy) (*ReturnPanel, error) {
+	if policy == "" {
+		policy = GapForwardFill
+	}
+	panel, err := AlignMonthlyReturns(monthly, policy)
+	if err != nil {
+		return nil, err
+	}
+	if dropped := panel.Gaps.DroppedMonths; len(dropped) > 0 {
+		return nil, fmt.Errorf("%w: gap policy drop would leave %d months, from %s, out of the value path; use ffill or reject",
+			ErrNoCommonHistory, len(dropped), dropped[0])
+	}
+	return panel, nil
+}
+
+// backtest runs cfg over the months of panel. benchmark, when not nil, holds
+// one return per panel month.
+func backtest(ctx context.Context, panel *ReturnPanel, benchmark []float64, cfg BacktestConfig) (*BacktestResult, error) {
+	tickers := sortedTickers(panel.Returns)
+	if cfg.Strategy == nil {
+		tickers = sortedTickers(cfg.Weights)
+		for _, t := range tickers {
+			if _, ok := panel.Returns[t]; !ok {
+				return nil, fmt.Errorf("%w: no returns for %s", ErrNoCommonHistory, t)
+			}
+		}
+	}
+	train := 0
+	if cfg.Strategy != nil {
+		if cfg.TrainMonths < 2 {
+			return nil, fmt.Errorf("a strategy needs at least 2 training months, got %d", cfg.TrainMonths)
+		}
+		train = cfg.TrainMonths
+	}
+	first, last, err := backtestWindow(panel.Months, cfg.Start, cfg.End, train)
+	if err != nil {
+		return nil, err
+	}
+	threshold := cfg.Threshold
+	if threshold == 0 {
+		threshold = DefaultDriftThreshold
+	}
+
+	// target weights for holding from month i on
+	target := func(i int) ([]float64, error) {
+		w := make([]float64, len(tickers))
+		if cfg.Strategy == nil {
+			for k, t := range tickers {
+				w[k] = cfg.Weights[t]
+			}
+			return w, nil
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		p, err := trainStrategy(ctx, panel, benchmark, *cfg.Strategy, i-cfg.TrainMonths, i)
+		if err != nil {
+			return nil, fmt.Errorf("rebalance before %s: %w", panel.Months[i], err)
+		}
+		for k, t := range tickers {
+			w[k] = p.Weights[t]
+		}
+		return w, nil
+	}
+
+	want, err := target(first)
+	if err != nil {
+		return nil, err
+	}
+	start, err := previousMonth(panel.Months[first])
+	if err != nil {
+		return nil, err
+	}
+	result := &BacktestResult{
+		Months:     panel.Months[first : last+1],
+		Gaps:       panel.Gaps,
+		Rebalances: []Rebalance{{Month: start, Weights: weightMap(tickers, want), Turnover: 1}},
+	}
+
+	held := append([]float64(nil), want...)
+	value := 1.0
+	for i := first; i <= last; i++ {
+		ret := 0.0
+		for k, t := range tickers {
+			ret += held[k] * panel.Returns[t][i]
+		}
+		result.Returns = append(result.Returns, ret)
+		if 1+ret <= 0 {
+			// nothing is left to drift or rebalance
+			result.Equity = append(result.Equity, 0)
+			last = i
+			break
+		}
+		value *= 1 + ret
+		for k, t := range tickers {
+			held[k] *= (1 + panel.Returns[t][i]) / (1 + ret)
+		}
+		result.Equity = append(result.Equity, value)
+
+		if i == last || !rebalanceDue(cfg.Rebalance, panel.Months[i], held, want, threshold) {
+			continue
+		}
+		if want, err = target(i + 1); err != nil {
+			return nil, err
+		}
+		turnover := 0.0
+		for k := range held {
+			turnover += math.Abs(want[k]-held[k]) / 2
+		}
+		result.Rebalances = append(result.Rebalances, Rebalance{Month: panel.Months[i], Weights: weightMap(tickers, want), Turnover: turnover})
+		result.Turnover += turnover
+		copy(held, want)
+	}
+
+	result.Months = panel.Months[first : last+1]
+	riskCfg := cfg.Risk
+	riskCfg.Frequency = Monthly
+	riskCfg.Months = result.Months
+	periods := riskCfg.Frequency.PeriodsPerYear()
+	result.AnnualTurnover = result.Turnover * periods / float64(len(result.Months))
+
+	var bench []float64
+	if benchmark != nil {
+		bench = benchmark[first : last+1]
+		result.BenchmarkReturns = bench
+	}
+	if result.Risk, err = SeriesRisk(result.Returns, bench, riskCfg); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// backtestWindow finds the indices of the first and last months held between
+// start and end, either of which may be empty. train months of returns have
+// to come before the first.
+func backtestWindow(months []string, start, end string, train int) (int, int, error) {
+	first := train
+	if start != "" {
+		first = sort.SearchStrings(months, start)
+		if first < train {
+			return 0, 0, fmt.Errorf("%w: starting %s leaves %d months to train on, need %d; start at %s or later",
+				ErrTooFewObservations, start, first, train, monthOrEnd(months, train))
+		}
+	}
+	last := len(months) - 1
+	if end != "" {
+		last = sort.SearchStrings(months, end+"\xff") - 1
+	}
+	if last-first+1 < 2 {
+		return 0, 0, fmt.Errorf("%w: %d months between %s and %s, need 2", ErrTooFewObservations, max(last-first+1, 0), monthOrEnd(months, first), monthOrEnd(months, last))
+	}
+	return first, last, nil
+}
+
+func monthOrEnd(months []string, i int) string {
+	switch {
+	case len(months) == 0:
+		return "the end of the data"
+	case i < 0:
+		return months[0]
+	case i >= len(months):
+		return months[len(months)-1]
+	}
+	return months[i]
+}
+
+// rebalanceDue reports whether to trade at the close of month.
+func rebalanceDue(schedule RebalanceSchedule, month string, held, target []float64, threshold float64) bool {
+	switch schedule {
+	case RebalanceQuarterly:
+		return strings.HasSuffix(month, "-03") || strings.HasSuffix(month, "-06") || strings.HasSuffix(month, "-09") || strings.HasSuffix(month, "-12")
+	case RebalanceAnnual:
+		return strings.HasSuffix(month, "-12")
+	case RebalanceThreshold:
+		for k := range held {
+			if math.Abs(held[k]-target[k]) > threshold {
+				return true
+			}
+		}
+		return false
+	case RebalanceNone:
+		return false
+	default:
+		return true
+	}
+}
+
+// trainStrategy optimizes cfg on the panel months [from, to).
+func trainStrategy(ctx context.Context, panel *ReturnPanel, benchmark []float64, cfg OptimizerConfig, from, to int) (Portfolio, error) {
+	train := make(map[string][]float64, len(panel.Returns))
+	for t, r := range panel.Returns {
+		train[t] = r[from:to]
+	}
+	if benchmark != nil {
+		cfg.Estimators.Benchmark = benchmark[from:to]
+	}
+	in, _, err := cfg.universe(train)
+	if err != nil {
+		return Portfolio{}, err
+	}
+	return optimizeBest(ctx, in, train, cfg)
+}
+
+// weightMap labels a weight vector ordered like tickers.
+func weightMap(tickers []string, w []float64) map[string]float64 {
+	m := make(map[string]float64, len(tickers))
+	for k, t := range tickers {
+		m[t] = w[k]
+	}
+	return m
+}
@@ -0,0 +1,206 @@
+package analysis_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/AndrewBrickweg/Finet_v2/cmd/finet/analysis"
+)
+
+// pricesFromReturns builds monthly closes starting at 100 in December 2019,
+// so returns[i] is the return over month i+1 from January 2020.
+func pricesFromReturns(t *testing.T, symbol string, returns []float64) *analysis.StockDataMonthly {
+	t.Helper()
+	closes := map[string]float64{"2019-12-31": 100}
+	price := 100.0
+	for i, r := range returns {
+		price *= 1 + r
+		closes[fmt.Sprintf("%d-%02d-28", 2020+i/12, i%12+1)] = price
+	}
+	return monthlyPrices(t, symbol, closes)
+}
+
+func backtestData(t *testing.T) []*analysis.StockDataMonthly {
+	t.Helper()
+	a := make([]float64, 36)
+	b := make([]float64, 36)
+	for i := range a {
+		a[i] = 0.02 + 0.05*math.Sin(float64(i))
+		b[i] = 0.01 - 0.03*math.Cos(float64(2*i))
+	}
+	return []*analysis.StockDataMonthly{pricesFromReturns(t, "AAA", a), pricesFromReturns(t, "BBB", b)}
+}
+
+func TestBacktestFixedWeights(t *testing.T) {
+	data := backtestData(t)
+	panel, err := analysis.AlignMonthlyReturns(data, analysis.GapDrop)
+	if err != nil {
+		t.Fatal(err)
+	}
+	weights := map[string]float64{"AAA": 0.6, "BBB": 0.4}
+
+	t.Run("monthly matches fixed weights", func(t *testing.T) {
+		res, err := analysis.OrchestrateBacktest(context.Background(), data, analysis.BacktestConfig{Weights: weights, Rebalance: analysis.RebalanceMonthly})
+		if err != nil {
+			t.Fatal(err)
+		}
+		value := 1.0
+		for i, r := range res.Returns {
+			want := 0.6*panel.Returns["AAA"][i] + 0.4*panel.Returns["BBB"][i]
+			if math.Abs(r-want) > 1e-12 {
+				t.Fatalf("month %d return %v, want %v", i, r, want)
+			}
+			value *= 1 + want
+			if math.Abs(res.Equity[i]-value) > 1e-12 {
+				t.Fatalf("month %d equity %v, want %v", i, res.Equity[i], value)
+			}
+		}
+		if len(res.Rebalances) != len(res.Months) || res.Rebalances[0].Month != "2019-12" {
+			t.Errorf("%d rebalances starting %s, want the purchase in 2019-12 and one per month after", len(res.Rebalances), res.Rebalances[0].Month)
+		}
+		if res.Turnover <= 0 || math.Abs(res.AnnualTurnover-res.Turnover*12/36) > 1e-12 {
+			t.Errorf("turnover %v, annual %v", res.Turnover, res.AnnualTurnover)
+		}
+		if res.Risk.Periods != 36 {
+			t.Errorf("risk report over %d periods, want 36", res.Risk.Periods)
+		}
+	})
+
+	t.Run("buy and hold drifts", func(t *testing.T) {
+		res, err := analysis.OrchestrateBacktest(context.Background(), data, analysis.BacktestConfig{Weights: weights, Rebalance: analysis.RebalanceNone})
+		if err != nil {
+			t.Fatal(err)
+		}
+		growthA, growthB := 1.0, 1.0
+		for i := range res.Months {
+			growthA *= 1 + panel.Returns["AAA"][i]
+			growthB *= 1 + panel.Returns["BBB"][i]
+		}
+		if want := 0.6*growthA + 0.4*growthB; math.Abs(res.Equity[len(res.Equity)-1]-want) > 1e-12 {
+			t.Errorf("final value %v, want %v", res.Equity[len(res.Equity)-1], want)
+		}
+		if len(res.Rebalances) != 1 || res.Turnover != 0 {
+			t.Errorf("%d rebalances and turnover %v, want only the purchase", len(res.Rebalances), res.Turnover)
+		}
+	})
+
+	t.Run("quarterly within a window", func(t *testing.T) {
+		res, err := analysis.OrchestrateBacktest(context.Background(), data, analysis.BacktestConfig{Weights: weights, Rebalance: analysis.RebalanceQuarterly, Start: "2020-02", End: "2021-01"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.Months[0] != "2020-02" || res.Months[len(res.Months)-1] != "2021-01" {
+			t.Errorf("months %v, want 2020-02 through 2021-01", res.Months)
+		}
+		var got []string
+		for _, r := range res.Rebalances[1:] {
+			got = append(got, r.Month)
+		}
+		if want := "2020-03 2020-06 2020-09 2020-12"; strings.Join(got, " ") != want {
+			t.Errorf("rebalanced %v, want %s", got, want)
+		}
+	})
+
+	t.Run("unknown ticker", func(t *testing.T) {
+		_, err := analysis.OrchestrateBacktest(context.Background(), data, analysis.BacktestConfig{Weights: map[string]float64{"CCC": 1}})
+		if !errors.Is(err, analysis.ErrNoCommonHistory) {
+			t.Errorf("got error %v, want ErrNoCommonHistory", err)
+		}
+	})
+}
+
+func TestBacktestGaps(t *testing.T) {
+	data := backtestData(t)
+	delete(data[1].TimeSeriesMonthly, "2020-06-28") // no June close for BBB
+	weights := map[string]float64{"AAA": 0.6, "BBB": 0.4}
+
+	res, err := analysis.OrchestrateBacktest(context.Background(), data, analysis.BacktestConfig{Weights: weights})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Months) != 36 || len(res.Equity) != 36 || res.Months[5] != "2020-06" || res.Gaps.Policy != analysis.GapForwardFill {
+		t.Errorf("%d months and %d equity values under %s, want all 36 calendar months filled", len(res.Months), len(res.Equity), res.Gaps.Policy)
+	}
+	for i := 1; i < len(res.Months); i++ {
+		if math.Abs(res.Equity[i]-res.Equity[i-1]*(1+res.Returns[i])) > 1e-12 {
+			t.Fatalf("equity breaks between %s and %s", res.Months[i-1], res.Months[i])
+		}
+	}
+
+	if _, err := analysis.OrchestrateBacktest(context.Background(), data, analysis.BacktestConfig{Weights: weights, GapPolicy: analysis.GapDrop}); !errors.Is(err, analysis.ErrNoCommonHistory) {
+		t.Errorf("got error %v under gap policy drop, want ErrNoCommonHistory", err)
+	}
+}
+
+// wipedOut is AAA falling to a hundred-quadrillionth of its price in August
+// 2020, a return of -100% in floating point, and creeping up after.
+func wipedOut(t *testing.T) *analysis.StockDataMonthly {
+	t.Helper()
+	closes := map[string]float64{"2019-12-31": 100}
+	price := 100.0
+	for i := range 36 {
+		month := fmt.Sprintf("%d-%02d", 2020+i/12, i%12+1)
+		switch {
+		case month == "2020-08":
+			price = 1e-18
+		case month > "2020-08":
+			price *= 1.01
+		}
+		closes[month+"-28"] = price
+	}
+	return monthlyPrices(t, "AAA", closes)
+}
+
+func TestBacktestWipedOut(t *testing.T) {
+	data := []*analysis.StockDataMonthly{wipedOut(t), backtestData(t)[1]}
+	res, err := analysis.OrchestrateBacktest(context.Background(), data, analysis.BacktestConfig{Weights: map[string]float64{"AAA": 1}, Rebalance: analysis.RebalanceThreshold})
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := len(res.Months)
+	if n != 8 || res.Months[n-1] != "2020-08" || len(res.Equity) != n || res.Equity[n-1] != 0 || res.Returns[n-1] != -1 {
+		t.Fatalf("path ends %v with equity %v, want it to stop at 0 in 2020-08", res.Months, res.Equity)
+	}
+	if math.IsNaN(res.Turnover) || math.IsNaN(res.Risk.AnnualVolatility) || res.Risk.MaxDrawdown.Depth != 1 {
+		t.Errorf("turnover %v, volatility %v and drawdown %v after losing everything", res.Turnover, res.Risk.AnnualVolatility, res.Risk.MaxDrawdown.Depth)
+	}
+}
+
+func TestBacktestStrategy(t *testing.T) {
+	data := backtestData(t)
+	strategy := &analysis.OptimizerConfig{Mode: analysis.ModeMinVariance, MaxWeight: 1}
+
+	if _, err := analysis.OrchestrateBacktest(context.Background(), data, analysis.BacktestConfig{Strategy: strategy, TrainMonths: 24, Start: "2021-06"}); !errors.Is(err, analysis.ErrTooFewObservations) {
+		t.Errorf("got error %v for a start with 17 months of training data, want ErrTooFewObservations", err)
+	}
+
+	res, err := analysis.OrchestrateBacktest(context.Background(), data, analysis.BacktestConfig{Strategy: strategy, TrainMonths: 24, Rebalance: analysis.RebalanceQuarterly})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Months[0] != "2022-01" || len(res.Months) != 12 {
+		t.Errorf("months %v, want the 12 after two years of training", res.Months)
+	}
+	// each trade is the minimum-variance portfolio of the 24 months before it
+	panel, err := analysis.AlignMonthlyReturns(data, analysis.GapDrop)
+	if err != nil {
+		t.Fatal(err)
+	}
+	train := map[string][]float64{"AAA": panel.Returns["AAA"][:24], "BBB": panel.Returns["BBB"][:24]}
+	p, err := analysis.OptimizeMinVariance(train, 0, analysis.Constraints{MaxWeight: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for ticker, w := range p.Weights {
+		if math.Abs(res.Rebalances[0].Weights[ticker]-w) > 1e-9 {
+			t.Errorf("initial %s weight %v, want %v", ticker, res.Rebalances[0].Weights[ticker], w)
+		}
+	}
+	if len(res.Rebalances) != 4 {
+		t.Errorf("%d rebalances, want the purchase and three quarter-ends", len(res.Rebalances))
+	}
+}
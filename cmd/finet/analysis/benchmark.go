@@ -0,0 +1,111 @@
+package analysis
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+// ErrInvalidBenchmark is returned for a benchmark without constituents or with
+// unusable weights.
+var ErrInvalidBenchmark = errors.New("invalid benchmark")
+
+// Benchmark is the series a portfolio is measured against: a single stored
+// ticker, or an index of constituents rebalanced to fixed weights every month.
+type Benchmark struct {
+	Name         string // label for reports, e.g. "SPY" or "equal_weight"
+	Constituents []*StockDataMonthly
+	Weights      map[string]float64 // by symbol, scaled to sum to 1; nil means equal weights
+	Optional     bool               // not asked for; a month it misses drops the comparison instead of failing
+}
+
+// TickerBenchmark is the benchmark made of stock alone.
+func TickerBenchmark(stock *StockDataMonthly) *Benchmark {
+	return &Benchmark{Name: stock.MetaData.Symbol, Constituents: []*StockDataMonthly{stock}}
+}
+
+// BenchmarkComparison is the benchmark's return in each aligned month, for
+// charting, and how the portfolio fared against it over the same months.
+type BenchmarkComparison struct {
+	Name    string
+	Returns []float64 // one per month of the response's Months
+	BenchmarkRisk
+}
+
+// BenchmarkReturns lines the benchmark up with the panel's months. An index
+// month's return is the weighted mean over the constituents with a close for
+// that month and the one before, so constituents listed late or delisted
+// early only drop out of the months they miss. A month no constituent covers
+// returns ErrNoCommonHistory.
+func (p *ReturnPanel) BenchmarkReturns(b *Benchmark) ([]float64, error) {
+	if len(b.Constituents) == 0 {
+		return nil, fmt.Errorf("%w: %s has no constituents", ErrInvalidBenchmark, b.Name)
+	}
+	weights := make([]float64, len(b.Constituents))
+	for i, c := range b.Constituents {
+		weights[i] = 1
+		if b.Weights != nil {
+			weights[i] = b.Weights[c.MetaData.Symbol]
+		}
+		if !(weights[i] >= 0) || math.IsInf(weights[i], 1) {
+			return nil, fmt.Errorf("%w: %s has weight %v", ErrInvalidBenchmark, c.MetaData.Symbol, weights[i])
+		}
+	}
+
+	prices := monthlyPriceSeries(b.Constituents)
+	returns := make([]float64, len(p.Months))
+	for i, m := range p.Months {
+		prevMonth, err := previousMonth(m)
+		if err != nil {
+			return nil, err
+		}
+		sum, total := 0.0, 0.0
+		for k, c := range b.Constituents {
+			series := prices[c.MetaData.Symbol]
+			cur, ok1 := series[m]
+			prev, ok2 := series[prevMonth]
+			if !ok1 || !ok2 || weights[k] == 0 {
+				continue
+			}
+			sum += weights[k] * (cur - prev) / prev
+			total += weights[k]
+		}
+		if total == 0 {
+			return nil, fmt.Errorf("%w: %s has no close for %s", ErrNoCommonHistory, b.Name, m)
+		}
+		returns[i] = sum / total
+	}
+	return returns, nil
+}
+
+// alignBenchmark is BenchmarkReturns for the orchestrators. It passes a nil
+// benchmark through, and drops an Optional one that misses a month, returning
+// nil for both, so a comparison the client never asked for cannot fail the
+// request.
+func (p *ReturnPanel) alignBenchmark(b *Benchmark) (*Benchmark, []float64, error) {
+	if b == nil {
+		return nil, nil, nil
+	}
+	returns, err := p.BenchmarkReturns(b)
+	if err != nil {
+		if b.Optional && errors.Is(err, ErrNoCommonHistory) {
+			return nil, nil, nil
+		}
+		return nil, nil, fmt.Errorf("benchmark: %w", err)
+	}
+	return b, returns, nil
+}
+
+// compareWithBenchmark measures the portfolio holding weights against the
+// benchmark returns over the same periods.
+func compareWithBenchmark(name string, weights map[string]float64, returns map[string][]float64, benchmark []float64, riskFreeRate float64, f Frequency) (*BenchmarkComparison, error) {
+	series, err := weightedReturns(weights, returns)
+	if err != nil {
+		return nil, err
+	}
+	if len(series) != len(benchmark) {
+		return nil, fmt.Errorf("benchmark has %d returns, the portfolio %d", len(benchmark), len(series))
+	}
+	risk := benchmarkRisk(series, benchmark, riskFreeRate, f.orMonthly().PeriodsPerYear())
+	return &BenchmarkComparison{Name: name, Returns: benchmark, BenchmarkRisk: *risk}, nil
+}
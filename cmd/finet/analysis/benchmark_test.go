@@ -0,0 +1,82 @@
+package analysis_test
+
+import (
+	"errors"
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/AndrewBrickweg/Finet_v2/cmd/finet/analysis"
+)
+
+func TestBenchmarkReturns(t *testing.T) {
+	aaa := monthlyPrices(t, "AAA", map[string]float64{"2024-12-31": 100, "2025-01-31": 110, "2025-02-28": 121, "2025-03-31": 121})
+	// listed a month later, so it only joins the index from February
+	bbb := monthlyPrices(t, "BBB", map[string]float64{"2025-01-31": 50, "2025-02-28": 55, "2025-03-31": 66})
+	panel, err := analysis.AlignMonthlyReturns([]*analysis.StockDataMonthly{aaa}, analysis.GapDrop)
+	if err != nil {
+		t.Fatalf("AlignMonthlyReturns: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		weights map[string]float64
+		want    []float64
+	}{
+		{name: "equal weights", want: []float64{0.1, 0.1, 0.1}},
+		{name: "custom weights", weights: map[string]float64{"AAA": 0.75, "BBB": 0.25}, want: []float64{0.1, 0.1, 0.05}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := &analysis.Benchmark{Name: "index", Constituents: []*analysis.StockDataMonthly{aaa, bbb}, Weights: tt.weights}
+			got, err := panel.BenchmarkReturns(b)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i := range tt.want {
+				if math.Abs(got[i]-tt.want[i]) > 1e-12 {
+					t.Fatalf("returns %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+
+	late := &analysis.Benchmark{Name: "late", Constituents: []*analysis.StockDataMonthly{bbb}}
+	if _, err := panel.BenchmarkReturns(late); !errors.Is(err, analysis.ErrNoCommonHistory) {
+		t.Errorf("got error %v for a benchmark missing January, want ErrNoCommonHistory", err)
+	}
+	negative := &analysis.Benchmark{Name: "short", Constituents: []*analysis.StockDataMonthly{aaa}, Weights: map[string]float64{"AAA": -1}}
+	if _, err := panel.BenchmarkReturns(negative); !errors.Is(err, analysis.ErrInvalidBenchmark) {
+		t.Errorf("got error %v for a negative weight, want ErrInvalidBenchmark", err)
+	}
+
+	// the risk report charts the benchmark next to the portfolio over the same months
+	index := &analysis.Benchmark{Name: "index", Constituents: []*analysis.StockDataMonthly{aaa, bbb}}
+	result, err := analysis.OrchestrateRisk([]*analysis.StockDataMonthly{aaa}, map[string]float64{"AAA": 1}, index, analysis.GapDrop, analysis.RiskConfig{})
+	if err != nil {
+		t.Fatalf("OrchestrateRisk: %v", err)
+	}
+	if result.BenchmarkName != "index" || len(result.BenchmarkReturns) != len(result.Months) {
+		t.Errorf("benchmark %q with %d returns, want index with one per month of %v", result.BenchmarkName, len(result.BenchmarkReturns), result.Months)
+	}
+	if !reflect.DeepEqual(result.Returns, panel.Returns["AAA"]) {
+		t.Errorf("portfolio returns %v, want AAA's %v", result.Returns, panel.Returns["AAA"])
+	}
+	if result.Risk.Benchmark == nil {
+		t.Error("risk report has no benchmark comparison")
+	}
+
+	// a default benchmark with a shorter history than the portfolio is left
+	// out; one the client named fails the request
+	if _, err := analysis.OrchestrateRisk([]*analysis.StockDataMonthly{aaa}, map[string]float64{"AAA": 1}, late, analysis.GapDrop, analysis.RiskConfig{}); !errors.Is(err, analysis.ErrNoCommonHistory) {
+		t.Errorf("got error %v for a named benchmark missing January, want ErrNoCommonHistory", err)
+	}
+	late.Optional = true
+	result, err = analysis.OrchestrateRisk([]*analysis.StockDataMonthly{aaa}, map[string]float64{"AAA": 1}, late, analysis.GapDrop, analysis.RiskConfig{})
+	if err != nil {
+		t.Fatalf("OrchestrateRisk with an optional benchmark: %v", err)
+	}
+	if result.BenchmarkName != "" || result.BenchmarkReturns != nil || result.Risk.Benchmark != nil {
+		t.Errorf("optional benchmark missing January kept as %q", result.BenchmarkName)
+	}
+}
@@ -0,0 +1,206 @@
+package analysis
+
+import (
+	"errors"
+	"fmt"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// Black-Litterman (1992), in the form of He and Litterman (1999). The prior is
+// the equilibrium return Π = rf + δΣw_mkt that makes the market portfolio
+// optimal; views P·μ = Q with uncertainty Ω tilt it to the posterior
+//
+//	μ = Π + τΣPᵀ(PτΣPᵀ + Ω)⁻¹(Q - PΠ)
+//	Σ_post = Σ + τΣ - τΣPᵀ(PτΣPᵀ + Ω)⁻¹PτΣ
+//
+// Neither form inverts Ω, so a fully confident view (Ω = 0) holds exactly.
+
+const (
+	DefaultRiskAversion = 2.5  // δ; the same in any frequency since Π and Σ scale together
+	DefaultTau          = 0.05 // τ, the uncertainty of the prior relative to Σ
+)
+
+var ErrInvalidView = errors.New("invalid black-litterman view or market weights")
+
+// PriorEqualWeight is the Prior of a BlackLitterman without MarketWeights: its
+// equilibrium is that of an equally weighted basket, not of a market.
+const PriorEqualWeight = "equal_weight"
+
+// View is an opinion on one asset's return, or on its return over another's.
+type View struct {
+	Asset      string
+	Versus     string  // relative view when set: Asset outperforms Versus by Return
+	Return     float64 // per period of the return series
+	Confidence float64 // in (0, 1]; 1 makes the posterior honor the view exactly
+}
+
+// BlackLitterman configures the prior and the views blended into it.
+type BlackLitterman struct {
+	Views         []View
+	MarketWeights map[string]float64 // benchmark weights, scaled to sum to 1; nil means equal weights
+	Prior         string             // where MarketWeights came from, for the report; see PriorEqualWeight
+	RiskAversion  float64            // 0 uses DefaultRiskAversion
+	Tau           float64            // 0 uses DefaultTau
+}
+
+// BlackLittermanResult holds the prior and posterior moments, ordered like the universe.
+type BlackLittermanResult struct {
+	Prior         string        // BlackLitterman.Prior, PriorEqualWeight without market weights
+	MarketWeights *mat.VecDense // w_mkt, scaled to sum to 1 over the universe
+	Equilibrium   *mat.VecDense // Π
+	Mean        *mat.VecDense // posterior expected returns
+	Cov         *mat.SymDense // posterior covariance
+}
+
+// BlackLittermanPosterior blends the views in bl into the equilibrium returns
+// implied by in.Cov. riskFreeRate is per period and is added to Π, so absolute
+// views are total returns.
+func BlackLittermanPosterior(in *Universe, bl BlackLitterman, riskFreeRate float64) (*BlackLittermanResult, error) {
+	n := in.Len()
+	if n == 0 {
+		return nil, errors.New("black-litterman: no tickers")
+	}
+	delta, tau := bl.RiskAversion, bl.Tau
+	if delta == 0 {
+		delta = DefaultRiskAversion
+	}
+	if tau == 0 {
+		tau = DefaultTau
+	}
+	if delta < 0 || tau < 0 {
+		return nil, fmt.Errorf("black-litterman: risk aversion %v and tau %v must be positive", delta, tau)
+	}
+
+	wMkt, err := bl.marketWeights(in)
+	if err != nil {
+		return nil, err
+	}
+	pi := mat.NewVecDense(n, nil)
+	pi.MulVec(in.Cov, wMkt)
+	pi.ScaleVec(delta, pi)
+	for i := range n {
+		pi.SetVec(i, pi.AtVec(i)+riskFreeRate)
+	}
+
+	prior := bl.Prior
+	if bl.MarketWeights == nil {
+		prior = PriorEqualWeight
+	}
+	result := &BlackLittermanResult{Prior: prior, MarketWeights: wMkt, Equilibrium: pi, Mean: mat.VecDenseCopyOf(pi)}
+	// τΣ is added to Σ whatever the views; with none the posterior is the prior.
+	post := mat.NewSymDense(n, nil)
+	for i := range n {
+		for j := i; j < n; j++ {
+			post.SetSym(i, j, (1+tau)*in.Cov.At(i, j))
+		}
+	}
+	result.Cov = post
+	if len(bl.Views) == 0 {
+		return result, nil
+	}
+
+	P, Q, err := viewMatrix(in, bl.Views)
+	if err != nil {
+		return nil, err
+	}
+
+	var tauSigma mat.SymDense
+	tauSigma.ScaleSym(tau, in.Cov)
+	var sigmaPt mat.Dense // τΣPᵀ, n x k
+	sigmaPt.Mul(&tauSigma, P.T())
+	var middle mat.Dense // PτΣPᵀ + Ω, k x k
+	middle.Mul(P, &sigmaPt)
+	for v, view := range bl.Views {
+		// He-Litterman Ω scaled by confidence: c = 1/2 gives Ω = PτΣPᵀ
+		omega := middle.At(v, v) * (1 - view.Confidence) / view.Confidence
+		middle.Set(v, v, middle.At(v, v)+omega)
+	}
+
+	var surprise mat.VecDense // Q - PΠ
+	surprise.MulVec(P, pi)
+	surprise.SubVec(Q, &surprise)
+
+	var lu mat.LU
+	lu.Factorize(&middle)
+	var x mat.VecDense
+	if err := lu.SolveVecTo(&x, false, &surprise); err != nil {
+		return nil, fmt.Errorf("%w: the views are redundant or contradictory", ErrInvalidView)
+	}
+	var shift mat.VecDense
+	shift.MulVec(&sigmaPt, &x)
+	result.Mean.AddVec(pi, &shift)
+
+	var solved mat.Dense // (PτΣPᵀ + Ω)⁻¹PτΣ, k x n
+	if err := lu.SolveTo(&solved, false, sigmaPt.T()); err != nil {
+		return nil, fmt.Errorf("%w: the views are redundant or contradictory", ErrInvalidView)
+	}
+	var reduction mat.Dense
+	reduction.Mul(&sigmaPt, &solved)
+	for i := range n {
+		for j := i; j < n; j++ {
+			// average the two triangles to keep rounding symmetric
+			r := (reduction.At(i, j) + reduction.At(j, i)) / 2
+			post.SetSym(i, j, post.At(i, j)-r)
+		}
+	}
+	return result, nil
+}
+
+// marketWeights orders bl.MarketWeights like the universe, defaulting to equal weights.
+func (bl BlackLitterman) marketWeights(in *Universe) (*mat.VecDense, error) {
+	n := in.Len()
+	w := mat.NewVecDense(n, nil)
+	if bl.MarketWeights == nil {
+		for i := range n {
+			w.SetVec(i, 1/float64(n))
+		}
+		return w, nil
+	}
+	total := 0.0
+	for i, t := range in.Tickers {
+		v, ok := bl.MarketWeights[t]
+		if !ok || v < 0 {
+			return nil, fmt.Errorf("%w: market weight for %s is missing or negative", ErrInvalidView, t)
+		}
+		w.SetVec(i, v)
+		total += v
+	}
+	if total <= 0 {
+		return nil, fmt.Errorf("%w: market weights sum to zero", ErrInvalidView)
+	}
+	w.ScaleVec(1/total, w)
+	return w, nil
+}
+
+// viewMatrix builds the pick matrix P, one row per view, and the view returns Q.
+func viewMatrix(in *Universe, views []View) (*mat.Dense, *mat.VecDense, error) {
+	P := mat.NewDense(len(views), in.Len(), nil)
+	Q := mat.NewVecDense(len(views), nil)
+	for v, view := range views {
+		if !(view.Confidence > 0 && view.Confidence <= 1) {
+			return nil, nil, fmt.Errorf("%w: confidence %v for %s must be in (0, 1]", ErrInvalidView, view.Confidence, view.Asset)
+		}
+		i, ok := in.Index(view.Asset)
+		if !ok {
+			return nil, nil, fmt.Errorf("%w: %s is not in the basket", ErrInvalidView, view.Asset)
+		}
+		P.Set(v, i, 1)
+		if view.Versus != "" {
+			j, ok := in.Index(view.Versus)
+			if !ok || j == i {
+				return nil, nil, fmt.Errorf("%w: %s cannot be compared with %s", ErrInvalidView, view.Asset, view.Versus)
+			}
+			P.Set(v, j, -1)
+		}
+		Q.SetVec(v, view.Return)
+	}
+	return P, Q, nil
+}
+
+// withMoments is a copy of in with new expected returns and covariance.
+func (in *Universe) withMoments(mean *mat.VecDense, cov *mat.SymDense) *Universe {
+	out := *in
+	out.Mean, out.Cov = mean, cov
+	return &out
+}
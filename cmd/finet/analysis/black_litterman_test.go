@@ -0,0 +1,98 @@
+package analysis_test
+
+import (
+	"context"
+	"errors"
+	"math"
+	"testing"
+
+	"github.com/AndrewBrickweg/Finet_v2/cmd/finet/analysis"
+	"gonum.org/v1/gonum/mat"
+)
+
+func TestBlackLitterman(t *testing.T) {
+	returns := syntheticReturns(6, 120)
+	in := analysis.NewUniverse(returns)
+	const rf = 0.003
+	a, b := in.Tickers[0], in.Tickers[1]
+
+	// Without views the posterior mean is the equilibrium rf + δΣw.
+	market := map[string]float64{}
+	for i, ticker := range in.Tickers {
+		market[ticker] = float64(i + 1)
+	}
+	prior, err := analysis.BlackLittermanPosterior(in, analysis.BlackLitterman{MarketWeights: market, Prior: "market_weights"}, rf)
+	if err != nil {
+		t.Fatalf("BlackLittermanPosterior: %v", err)
+	}
+	if prior.Prior != "market_weights" || math.Abs(prior.MarketWeights.AtVec(0)-1.0/21) > 1e-15 {
+		t.Errorf("prior %q with %s weighing %v, want market_weights and 1/21", prior.Prior, in.Tickers[0], prior.MarketWeights.AtVec(0))
+	}
+	for i := range in.Len() {
+		want := rf
+		for j := range in.Len() {
+			want += analysis.DefaultRiskAversion * in.Cov.At(i, j) * float64(j+1) / 21
+		}
+		if math.Abs(prior.Equilibrium.AtVec(i)-want) > 1e-15 || prior.Mean.AtVec(i) != prior.Equilibrium.AtVec(i) {
+			t.Errorf("%s equilibrium %v and posterior %v, want %v", in.Tickers[i], prior.Equilibrium.AtVec(i), prior.Mean.AtVec(i), want)
+		}
+	}
+
+	// Fully confident views hold exactly.
+	views := analysis.BlackLitterman{Views: []analysis.View{
+		{Asset: a, Return: 0.02, Confidence: 1},
+		{Asset: b, Versus: in.Tickers[2], Return: 0.01, Confidence: 1},
+	}}
+	post, err := analysis.BlackLittermanPosterior(in, views, rf)
+	if err != nil {
+		t.Fatalf("BlackLittermanPosterior: %v", err)
+	}
+	if post.Prior != analysis.PriorEqualWeight {
+		t.Errorf("prior %q without market weights, want %s", post.Prior, analysis.PriorEqualWeight)
+	}
+	if got := post.Mean.AtVec(0); math.Abs(got-0.02) > 1e-12 {
+		t.Errorf("absolute view: %s posterior %v, want 0.02", a, got)
+	}
+	if got := post.Mean.AtVec(1) - post.Mean.AtVec(2); math.Abs(got-0.01) > 1e-12 {
+		t.Errorf("relative view: %s over %s by %v, want 0.01", b, in.Tickers[2], got)
+	}
+	if !mat.Equal(post.Cov, post.Cov.T()) {
+		t.Error("posterior covariance is not symmetric")
+	}
+
+	// A half-confident view lands between the equilibrium and the view.
+	half := analysis.BlackLitterman{Views: []analysis.View{{Asset: a, Return: 0.02, Confidence: 0.5}}}
+	post, err = analysis.BlackLittermanPosterior(in, half, rf)
+	if err != nil {
+		t.Fatalf("BlackLittermanPosterior: %v", err)
+	}
+	eq := post.Equilibrium.AtVec(0)
+	if want := (eq + 0.02) / 2; math.Abs(post.Mean.AtVec(0)-want) > 1e-12 {
+		t.Errorf("half-confident view: %s posterior %v, want %v", a, post.Mean.AtVec(0), want)
+	}
+
+	// The posterior feeds the optimizers: a bullish view buys more of the asset.
+	cfg := analysis.OptimizerConfig{Mode: analysis.ModeMaxSharpe, RiskFreeRate: rf, MaxWeight: 1, Views: &analysis.BlackLitterman{}}
+	_, neutral, err := analysis.Optimize(context.Background(), returns, cfg)
+	if err != nil {
+		t.Fatalf("Optimize without views: %v", err)
+	}
+	cfg.Views = &half
+	_, tilted, err := analysis.Optimize(context.Background(), returns, cfg)
+	if err != nil {
+		t.Fatalf("Optimize with views: %v", err)
+	}
+	if tilted.Weights[a] <= neutral.Weights[a] {
+		t.Errorf("%s weight %v with a bullish view, %v without", a, tilted.Weights[a], neutral.Weights[a])
+	}
+
+	for _, v := range []analysis.View{
+		{Asset: "NOPE", Return: 0.01, Confidence: 0.5},
+		{Asset: a, Versus: a, Return: 0.01, Confidence: 0.5},
+		{Asset: a, Return: 0.01, Confidence: 0},
+	} {
+		if _, err := analysis.BlackLittermanPosterior(in, analysis.BlackLitterman{Views: []analysis.View{v}}, rf); !errors.Is(err, analysis.ErrInvalidView) {
+			t.Errorf("view %+v: got error %v, want ErrInvalidView", v, err)
+		}
+	}
+}
@@ -0,0 +1,198 @@
+package analysis
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"gonum.org/v1/gonum/mat"
+	"gonum.org/v1/gonum/optimize/convex/lp"
+)
+
+var ErrInfeasibleConstraints = errors.New("weight and sector limits cannot all be satisfied")
+
+// Constraints describes the feasible set of weight vectors shared by every
+// optimizer mode: fully invested, long only, each weight in [MinWeight, MaxWeight],
+// and the combined weight of every limited sector within its bounds.
+type Constraints struct {
+	MinWeight    float64
+	MaxWeight    float64
+	Sectors      map[string]string // ticker -> sector, required when SectorLimits is set
+	SectorLimits []SectorLimit
+}
+
+// SectorLimit bounds the combined weight of all tickers in one sector.
+type SectorLimit struct {
+	Sector string
+	Min    float64
+	Max    float64
+}
+
+// EffectiveWeightBounds applies the same small-basket adjustments the Monte
+// Carlo search has always made, so every mode agrees on the feasible set.
+// Callers can use it to report the bounds a run actually used.
+func EffectiveWeightBounds(n int, minWeight, maxWeight float64) (float64, float64) {
+	// If basket is small, adjust maxWeight to 1/n if that is lower than the supplied maxWeight.
+	if n < 5 {
+		oneOverN := 1.0 / float64(n)
+		if maxWeight > oneOverN {
+			maxWeight = oneOverN
+		}
+	}
+
+	// Safety: if minWeight * n > 1, make minWeight smaller
+	if float64(n)*minWeight > 1.0 {
+		minWeight = 0.0
+	}
+	return minWeight, maxWeight
+}
+
+// prepare applies the small-basket weight adjustments and checks that the
+// constraints admit at least one portfolio of the given tickers.
+func (c Constraints) prepare(tickers []string) (Constraints, error) {
+	if len(tickers) == 0 {
+		return Constraints{}, errors.New("no tickers provided")
+	}
+	c.MinWeight, c.MaxWeight = EffectiveWeightBounds(len(tickers), c.MinWeight, c.MaxWeight)
+	if err := c.validate(len(tickers)); err != nil {
+		return Constraints{}, err
+	}
+	if len(c.SectorLimits) == 0 {
+		return c, nil
+	}
+
+	for _, lim := range c.SectorLimits {
+		if lim.Min < 0 || lim.Max <= 0 || lim.Min > lim.Max || lim.Max > 1 {
+			return Constraints{}, fmt.Errorf("invalid limits for sector %q: min %.4f, max %.4f", lim.Sector, lim.Min, lim.Max)
+		}
+	}
+	A, l, u := c.linearRows(tickers)
+	if _, err := solveLP(make([]float64, len(tickers)), A, l, u); err != nil {
+		return Constraints{}, ErrInfeasibleConstraints
+	}
+	return c, nil
+}
+
+// linearRows expresses the constraints over tickers as l <= A*w <= u.
+// Row 0 is the budget constraint, rows 1..n are the per-asset bounds and any
+// remaining rows are sector limits.
+func (c Constraints) linearRows(tickers []string) (*mat.Dense, []float64, []float64) {
+	n := len(tickers)
+	m := n + 1 + len(c.SectorLimits)
+	A := mat.NewDense(m, n, nil)
+	l := make([]float64, m)
+	u := make([]float64, m)
+
+	for j := range n {
+		A.Set(0, j, 1)
+	}
+	l[0], u[0] = 1, 1
+
+	for i := range n {
+		A.Set(i+1, i, 1)
+		l[i+1], u[i+1] = c.MinWeight, c.MaxWeight
+	}
+
+	for k, lim := range c.SectorLimits {
+		r := n + 1 + k
+		for j, t := range tickers {
+			if c.inSector(t, lim) {
+				A.Set(r, j, 1)
+			}
+		}
+		l[r], u[r] = lim.Min, lim.Max
+	}
+	return A, l, u
+}
+
+// inSector reports whether ticker belongs to the limited sector. Names match
+// case-insensitively, the way scenario factors match the industry column.
+func (c Constraints) inSector(ticker string, lim SectorLimit) bool {
+	return strings.EqualFold(c.Sectors[ticker], lim.Sector)
+}
+
+// validate checks the bounds are consistent for a basket of n assets.
+func (c Constraints) validate(n int) error {
+	if n == 0 {
+		return errors.New("no tickers provided")
+	}
+	if c.MinWeight < 0 || c.MaxWeight <= 0 || c.MinWeight > c.MaxWeight {
+		return errors.New("invalid min/max weights")
+	}
+	if float64(n)*c.MinWeight > 1.0+1e-12 {
+		return errors.New("sum of minimum weights exceeds 1.0; lower minWeight or reduce number of assets")
+	}
+	if float64(n)*c.MaxWeight < 1.0-1e-12 {
+		return errors.New("sum of maximum weights is below 1.0; raise maxWeight or add assets")
+	}
+	return nil
+}
+
+// solveLP minimizes cᵀx subject to l <= A*x <= u using gonum's simplex.
+func solveLP(c []float64, A *mat.Dense, l, u []float64) ([]float64, error) {
+	m, n := A.Dims()
+
+	var gRows, aRows [][]float64
+	var h, b []float64
+	for r := range m {
+		row := mat.Row(nil, r, A)
+		switch {
+		case l[r] == u[r]:
+			aRows = append(aRows, row)
+			b = append(b, u[r])
+		default:
+			if !math.IsInf(u[r], 1) {
+				gRows = append(gRows, row)
+				h = append(h, u[r])
+			}
+			if !math.IsInf(l[r], -1) {
+				neg := make([]float64, n)
+				for j, v := range row {
+					neg[j] = -v
+				}
+				gRows = append(gRows, neg)
+				h = append(h, -l[r])
+			}
+		}
+	}
+
+	var G, Aeq mat.Matrix
+	if len(gRows) > 0 {
+		G = stackRows(gRows, n)
+	}
+	if len(aRows) > 0 {
+		Aeq = stackRows(aRows, n)
+	}
+
+	cNew, aNew, bNew := lp.Convert(c, G, h, Aeq, b)
+	_, x, err := lp.Simplex(cNew, aNew, bNew, 1e-10, nil)
+	if err != nil {
+		return nil, fmt.Errorf("linear program: %w", err)
+	}
+	// Convert splits each free variable into x⁺ - x⁻ ahead of the slacks.
+	out := make([]float64, n)
+	for j := range n {
+		out[j] = x[j] - x[n+j]
+	}
+	return out, nil
+}
+
+// sortedTickers lists the keys of a ticker-keyed map alphabetically.
+func sortedTickers[V any](byTicker map[string]V) []string {
+	tickers := make([]string, 0, len(byTicker))
+	for t := range byTicker {
+		tickers = append(tickers, t)
+	}
+	sort.Strings(tickers)
+	return tickers
+}
+
+func stackRows(rows [][]float64, n int) *mat.Dense {
+	data := make([]float64, 0, len(rows)*n)
+	for _, r := range rows {
+		data = append(data, r...)
+	}
+	return mat.NewDense(len(rows), n, data)
+}
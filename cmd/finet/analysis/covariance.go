@@ -0,0 +1,258 @@
+package analysis
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+
+	"gonum.org/v1/gonum/floats"
+	"gonum.org/v1/gonum/mat"
+	"gonum.org/v1/gonum/stat"
+)
+
+// Covariance estimators. All of them expect the return series to cover the
+// same periods in the same order.
+
+// CovarianceEstimator selects how NewUniverseWith estimates covariance.
+type CovarianceEstimator string
+
+const (
+	CovarianceSample     CovarianceEstimator = "sample"         // unbiased sample covariance (N-1)
+	CovarianceLedoitWolf CovarianceEstimator = "ledoit_wolf"    // sample shrunk toward constant correlation
+	CovarianceEWMA       CovarianceEstimator = "ewma"           // exponentially weighted, recent periods count more
+	CovarianceSemi       CovarianceEstimator = "semicovariance" // co-movement below a threshold return only
+)
+
+// DefaultEWMALambda is the decay used for monthly returns when none is given.
+// RiskMetrics uses 0.94 for daily and 0.97 for monthly data.
+const DefaultEWMALambda = 0.97
+
+var ErrTooFewObservations = errors.New("not enough aligned observations to estimate covariance")
+
+// ParseCovarianceEstimator maps a request value onto an estimator. Empty selects the sample covariance.
+func ParseCovarianceEstimator(s string) (CovarianceEstimator, error) {
+	switch est := CovarianceEstimator(strings.ToLower(strings.TrimSpace(s))); est {
+	case "":
+		return CovarianceSample, nil
+	case CovarianceSample, CovarianceLedoitWolf, CovarianceEWMA, CovarianceSemi:
+		return est, nil
+	default:
+		return "", fmt.Errorf("unknown covariance estimator %q", s)
+	}
+}
+
+// Estimators selects how NewUniverseWith turns return series into optimizer inputs.
+type Estimators struct {
+	Frequency     Frequency // of the return series; zero means monthly
+	Covariance    CovarianceEstimator
+	Returns       ReturnEstimator
+	EWMALambda    float64   // CovarianceEWMA and ReturnEWMA; 0 uses the frequency's default
+	SemiThreshold float64   // CovarianceSemi only; returns below it count as downside
+	Benchmark     []float64 // ReturnCAPM only; benchmark returns over the same periods
+	RiskFreeRate  float64   // ReturnCAPM only
+}
+
+func (e Estimators) lambda() float64 {
+	if e.EWMALambda == 0 {
+		return e.Frequency.DefaultEWMALambda()
+	}
+	return e.EWMALambda
+}
+
+// covariance estimates the covariance of tickers with the selected estimator.
+func (e Estimators) covariance(tickers []string, returns map[string][]float64) (*mat.SymDense, error) {
+	switch e.Covariance {
+	case CovarianceSample, "":
+		return CovarianceMatrix(tickers, returns), nil
+	case CovarianceLedoitWolf:
+		cov, _, err := LedoitWolfCovariance(tickers, returns)
+		return cov, err
+	case CovarianceEWMA:
+		return EWMACovariance(tickers, returns, e.lambda())
+	case CovarianceSemi:
+		return Semicovariance(tickers, returns, e.SemiThreshold)
+	default:
+		return nil, fmt.Errorf("unknown covariance estimator %q", e.Covariance)
+	}
+}
+
+// observations stacks the return series into a T x n matrix, one column per ticker.
+func observations(tickers []string, returns map[string][]float64, minRows int) (*mat.Dense, error) {
+	if len(tickers) == 0 {
+		return nil, errors.New("no tickers provided")
+	}
+	t := len(returns[tickers[0]])
+	for _, ticker := range tickers {
+		if len(returns[ticker]) != t {
+			return nil, fmt.Errorf("return series differ in length: %s has %d, %s has %d", tickers[0], t, ticker, len(returns[ticker]))
+		}
+	}
+	if t < minRows {
+		return nil, fmt.Errorf("%w: have %d, need %d", ErrTooFewObservations, t, minRows)
+	}
+	x := mat.NewDense(t, len(tickers), nil)
+	for j, ticker := range tickers {
+		x.SetCol(j, returns[ticker])
+	}
+	return x, nil
+}
+
+// LedoitWolfCovariance shrinks the sample covariance toward the constant
+// correlation model of Ledoit and Wolf, "Honey, I Shrunk the Sample Covariance
+// Matrix" (2004): every pair gets the average sample correlation, scaled by the
+// two sample volatilities. It returns the shrunk matrix and the shrinkage
+// intensity in [0, 1]. Like the authors' reference code it normalizes by T, not T-1.
+func LedoitWolfCovariance(tickers []string, returns map[string][]float64) (*mat.SymDense, float64, error) {
+	x, err := observations(tickers, returns, 2)
+	if err != nil {
+		return nil, 0, err
+	}
+	t, n := x.Dims()
+	tf := float64(t)
+
+	// demean each column
+	for j := range n {
+		col := mat.Col(nil, j, x)
+		mean := stat.Mean(col, nil)
+		for i := range t {
+			x.Set(i, j, col[i]-mean)
+		}
+	}
+
+	var sample mat.SymDense
+	sample.SymOuterK(1/tf, x.T())
+
+	sqrtVar := make([]float64, n)
+	for i := range n {
+		sqrtVar[i] = math.Sqrt(sample.At(i, i))
+	}
+
+	// average correlation of the distinct pairs
+	rBar := 0.0
+	if n > 1 {
+		for i := range n {
+			for j := range n {
+				if i != j && sqrtVar[i] > 0 && sqrtVar[j] > 0 {
+					rBar += sample.At(i, j) / (sqrtVar[i] * sqrtVar[j])
+				}
+			}
+		}
+		rBar /= float64(n * (n - 1))
+	}
+
+	prior := mat.NewSymDense(n, nil)
+	for i := range n {
+		for j := i; j < n; j++ {
+			if i == j {
+				prior.SetSym(i, i, sample.At(i, i))
+			} else {
+				prior.SetSym(i, j, rBar*sqrtVar[i]*sqrtVar[j])
+			}
+		}
+	}
+
+	// pi-hat: asymptotic variance of the sample covariance entries
+	var phi, diagPhi float64
+	for i := range n {
+		for j := range n {
+			var sum float64
+			for k := range t {
+				d := x.At(k, i)*x.At(k, j) - sample.At(i, j)
+				sum += d * d
+			}
+			phi += sum / tf
+			if i == j {
+				diagPhi += sum / tf
+			}
+		}
+	}
+
+	// rho-hat: covariance of the target entries with the sample entries
+	rho := diagPhi
+	for i := range n {
+		for j := range n {
+			if i == j || sqrtVar[i] == 0 {
+				continue
+			}
+			var term1 float64
+			for k := range t {
+				xi := x.At(k, i)
+				term1 += xi * xi * xi * x.At(k, j)
+			}
+			theta := term1/tf - sample.At(i, i)*sample.At(i, j)
+			rho += rBar * sqrtVar[j] / sqrtVar[i] * theta
+		}
+	}
+
+	// gamma-hat: squared distance between target and sample
+	var gamma float64
+	for i := range n {
+		for j := range n {
+			d := sample.At(i, j) - prior.At(i, j)
+			gamma += d * d
+		}
+	}
+
+	shrinkage := 1.0
+	if gamma > 0 {
+		shrinkage = math.Max(0, math.Min(1, (phi-rho)/gamma/tf))
+	}
+
+	sigma := mat.NewSymDense(n, nil)
+	for i := range n {
+		for j := i; j < n; j++ {
+			sigma.SetSym(i, j, shrinkage*prior.At(i, j)+(1-shrinkage)*sample.At(i, j))
+		}
+	}
+	return sigma, shrinkage, nil
+}
+
+// EWMACovariance weights the period k steps before the latest by λᵏ, with the
+// weights normalized to sum to one, and measures deviations from the weighted mean.
+func EWMACovariance(tickers []string, returns map[string][]float64, lambda float64) (*mat.SymDense, error) {
+	if lambda <= 0 || lambda >= 1 {
+		return nil, fmt.Errorf("ewma decay must be in (0, 1), got %g", lambda)
+	}
+	x, err := observations(tickers, returns, 2)
+	if err != nil {
+		return nil, err
+	}
+	t, n := x.Dims()
+	weights := make([]float64, t)
+	for k := range t {
+		weights[t-1-k] = math.Pow(lambda, float64(k))
+	}
+	floats.Scale(1/floats.Sum(weights), weights)
+
+	// scale each demeaned row by sqrt(weight) so XᵀX is the weighted sum
+	for j := range n {
+		col := mat.Col(nil, j, x)
+		mean := floats.Dot(weights, col)
+		for i := range t {
+			x.Set(i, j, (col[i]-mean)*math.Sqrt(weights[i]))
+		}
+	}
+	cov := mat.NewSymDense(n, nil)
+	cov.SymOuterK(1, x.T())
+	return cov, nil
+}
+
+// Semicovariance measures co-movement below threshold only (Estrada 2007):
+// entry i,j averages min(rᵢ-B, 0)·min(rⱼ-B, 0) over the T periods. With B at the
+// risk-free rate, minimizing it minimizes downside rather than total volatility.
+func Semicovariance(tickers []string, returns map[string][]float64, threshold float64) (*mat.SymDense, error) {
+	x, err := observations(tickers, returns, 1)
+	if err != nil {
+		return nil, err
+	}
+	t, n := x.Dims()
+	downside := mat.NewDense(t, n, nil)
+	downside.Apply(func(_, _ int, v float64) float64 {
+		return math.Min(v-threshold, 0)
+	}, x)
+
+	cov := mat.NewSymDense(n, nil)
+	cov.SymOuterK(1/float64(t), downside.T())
+	return cov, nil
+}
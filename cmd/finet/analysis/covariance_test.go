@@ -0,0 +1,103 @@
+package analysis_test
+
+import (
+	"context"
+	"math"
+	"testing"
+
+	"github.com/AndrewBrickweg/Finet_v2/cmd/finet/analysis"
+)
+
+// shrinkageReturns is twelve months of four assets, A, B and D moving together
+// and C against them.
+var shrinkageReturns = map[string][]float64{
+	"A": {0.012, -0.034, 0.051, 0.007, -0.012, 0.029, 0.044, -0.021, 0.015, 0.003, -0.008, 0.026},
+	"B": {0.020, -0.015, 0.032, -0.004, -0.027, 0.018, 0.037, -0.030, 0.011, 0.009, -0.002, 0.031},
+	"C": {-0.005, 0.041, -0.012, 0.023, 0.006, -0.019, 0.015, 0.028, -0.033, 0.017, 0.024, -0.006},
+	"D": {0.031, -0.052, 0.064, 0.018, -0.041, 0.022, 0.055, -0.047, 0.027, -0.011, -0.019, 0.038},
+}
+
+func TestLedoitWolfShrinkage(t *testing.T) {
+	// Reference values from the authors' covCor.m run on the same data.
+	tests := []struct {
+		tickers   []string
+		intensity float64
+	}{
+		{tickers: []string{"A", "B", "C"}, intensity: 0.10148429445860278},
+		{tickers: []string{"A", "B", "C", "D"}, intensity: 0.09508424142177463},
+	}
+	for _, tt := range tests {
+		cov, intensity, err := analysis.LedoitWolfCovariance(tt.tickers, shrinkageReturns)
+		if err != nil {
+			t.Fatalf("LedoitWolfCovariance(%v): %v", tt.tickers, err)
+		}
+		if math.Abs(intensity-tt.intensity) > 1e-12 {
+			t.Errorf("%v: shrinkage intensity %.15f, want %.15f", tt.tickers, intensity, tt.intensity)
+		}
+		if len(tt.tickers) == 4 {
+			want := [][]float64{
+				{0.000603388888888889, 0.00043976660462177167, -0.0002927767066655774, 0.000827511825023118},
+				{0.00043976660462177167, 0.00046838888888888885, -0.0002156753557054664, 0.0007040902915564114},
+				{-0.0002927767066655774, -0.0002156753557054664, 0.0004379097222222222, -0.00044925450035183956},
+				{0.000827511825023118, 0.0007040902915564114, -0.00044925450035183956, 0.0014614097222222222},
+			}
+			for i := range want {
+				for j := range want[i] {
+					if math.Abs(cov.At(i, j)-want[i][j]) > 1e-15 {
+						t.Errorf("shrunk cov[%d][%d] = %v, want %v", i, j, cov.At(i, j), want[i][j])
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestCovarianceEstimators(t *testing.T) {
+	tickers := []string{"A", "B", "C", "D"}
+	sample := analysis.CovarianceMatrix(tickers, shrinkageReturns)
+	months := float64(len(shrinkageReturns["A"]))
+
+	// With almost no decay EWMA is the sample covariance normalized by T.
+	ewma, err := analysis.EWMACovariance(tickers, shrinkageReturns, 1-1e-9)
+	if err != nil {
+		t.Fatalf("EWMACovariance: %v", err)
+	}
+	for i := range tickers {
+		for j := range tickers {
+			if want := sample.At(i, j) * (months - 1) / months; math.Abs(ewma.At(i, j)-want) > 1e-6*math.Abs(want) {
+				t.Errorf("ewma[%d][%d] = %v, want %v", i, j, ewma.At(i, j), want)
+			}
+		}
+	}
+	if _, err := analysis.EWMACovariance(tickers, shrinkageReturns, 1); err == nil {
+		t.Error("EWMACovariance accepted a decay of 1")
+	}
+
+	// Nothing falls below a threshold of -10%, so there is no downside.
+	semi, err := analysis.Semicovariance(tickers, shrinkageReturns, -0.10)
+	if err != nil {
+		t.Fatalf("Semicovariance: %v", err)
+	}
+	for i := range tickers {
+		for j := range tickers {
+			if semi.At(i, j) != 0 {
+				t.Errorf("semicov[%d][%d] = %v, want 0", i, j, semi.At(i, j))
+			}
+		}
+	}
+
+	// A and C never fall below zero in the same month.
+	semi, _ = analysis.Semicovariance(tickers, shrinkageReturns, 0)
+	if semi.At(0, 2) != 0 || semi.At(0, 0) <= 0 {
+		t.Errorf("semicov A,C = %v and A,A = %v; want 0 and positive", semi.At(0, 2), semi.At(0, 0))
+	}
+
+	for _, est := range []analysis.CovarianceEstimator{analysis.CovarianceLedoitWolf, analysis.CovarianceEWMA, analysis.CovarianceSemi} {
+		cfg := analysis.OptimizerConfig{Mode: analysis.ModeMinVariance, MaxWeight: 0.6, Estimators: analysis.Estimators{Covariance: est}}
+		_, best, err := analysis.Optimize(context.Background(), shrinkageReturns, cfg)
+		if err != nil {
+			t.Fatalf("%s: %v", est, err)
+		}
+		checkWeights(t, best, 0, 0.6)
+	}
+}
@@ -0,0 +1,174 @@
+package analysis
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"gonum.org/v1/gonum/mat"
+	"gonum.org/v1/gonum/optimize/convex/lp"
+)
+
+// Conditional Value-at-Risk (expected shortfall) is the mean loss over the
+// worst 1-β share of periods. Unlike variance it ignores upside moves, and on
+// historical scenarios minimizing it is a linear program.
+
+const DefaultCVaRConfidence = 0.95
+
+// OptimizeMinCVaR returns the portfolio with the lowest historical CVaR at
+// confidence (0 uses DefaultCVaRConfidence), treating each period of returns
+// as one equally likely scenario. riskFreeRate is only used to report the
+// Sharpe ratio.
+func OptimizeMinCVaR(returns map[string][]float64, riskFreeRate float64, constraints Constraints, confidence float64) (Portfolio, error) {
+	return optimizeMinCVaR(NewUniverse(returns), returns, riskFreeRate, constraints, confidence)
+}
+
+func optimizeMinCVaR(in *Universe, returns map[string][]float64, riskFreeRate float64, constraints Constraints, confidence float64) (Portfolio, error) {
+	if confidence == 0 {
+		confidence = DefaultCVaRConfidence
+	}
+	if !(confidence > 0 && confidence < 1) {
+		return Portfolio{}, fmt.Errorf("cvar confidence must be in (0, 1), got %v", confidence)
+	}
+	cons, err := constraints.prepare(in.Tickers)
+	if err != nil {
+		return Portfolio{}, err
+	}
+	scenarios, err := observations(in.Tickers, returns, 2)
+	if err != nil {
+		return Portfolio{}, err
+	}
+	w, err := minCVaRWeights(scenarios, in.Tickers, cons, confidence)
+	if err != nil {
+		return Portfolio{}, err
+	}
+	return in.portfolio(w, riskFreeRate), nil
+}
+
+// minCVaRWeights solves the Rockafellar-Uryasev (2000) linear program over the
+// T x n scenario matrix R:
+//
+//	minimize   ζ + 1/((1-β)T) Σₜ uₜ
+//	subject to uₜ >= -Rₜw - ζ,  uₜ >= 0,  w in the constraint set
+//
+// At the optimum ζ is the Value-at-Risk and the objective the CVaR. The LP is
+// built directly in the standard form lp.Simplex takes, minimize cᵀx subject to
+// Ax = b, x >= 0, over w' = w - MinWeight, ζ = ζ⁺ - ζ⁻, u and one slack per
+// inequality. That is about a quarter of the size solveLP's general conversion
+// gives, which matters with one row per month of history.
+func minCVaRWeights(scenarios *mat.Dense, tickers []string, cons Constraints, confidence float64) ([]float64, error) {
+	t, n := scenarios.Dims()
+	k := len(cons.SectorLimits)
+
+	// column offsets
+	zeta := n
+	tail := zeta + 2
+	capSlack := tail + t
+	sectorSlack := capSlack + n
+	surplus := sectorSlack + 2*k
+	cols := surplus + t
+	rows := 1 + n + 2*k + t
+
+	A := mat.NewDense(rows, cols, nil)
+	b := make([]float64, rows)
+	row := 0
+
+	// Σw' = 1 - n·MinWeight
+	for j := range n {
+		A.Set(row, j, 1)
+	}
+	b[row] = 1 - float64(n)*cons.MinWeight
+	row++
+
+	// w'ᵢ + capᵢ = MaxWeight - MinWeight
+	for j := range n {
+		A.Set(row, j, 1)
+		A.Set(row, capSlack+j, 1)
+		b[row] = cons.MaxWeight - cons.MinWeight
+		row++
+	}
+
+	// Min <= Σ_sector w <= Max, one row per side
+	for s, lim := range cons.SectorLimits {
+		members := 0.0
+		for j, ticker := range tickers {
+			if cons.inSector(ticker, lim) {
+				A.Set(row, j, 1)
+				A.Set(row+1, j, 1)
+				members++
+			}
+		}
+		A.Set(row, sectorSlack+2*s, -1)
+		b[row] = lim.Min - members*cons.MinWeight
+		A.Set(row+1, sectorSlack+2*s+1, 1)
+		b[row+1] = lim.Max - members*cons.MinWeight
+		row += 2
+	}
+
+	// Rₜw' + ζ⁺ - ζ⁻ + uₜ - eₜ = -MinWeight·ΣⱼRₜⱼ
+	for s := range t {
+		sum := 0.0
+		for j := range n {
+			A.Set(row, j, scenarios.At(s, j))
+			sum += scenarios.At(s, j)
+		}
+		A.Set(row, zeta, 1)
+		A.Set(row, zeta+1, -1)
+		A.Set(row, tail+s, 1)
+		A.Set(row, surplus+s, -1)
+		b[row] = -cons.MinWeight * sum
+		row++
+	}
+
+	for r := range rows {
+		if b[r] < 0 {
+			b[r] = -b[r]
+			for j := range cols {
+				A.Set(r, j, -A.At(r, j))
+			}
+		}
+	}
+
+	c := make([]float64, cols)
+	c[zeta], c[zeta+1] = 1, -1
+	for s := range t {
+		c[tail+s] = 1 / ((1 - confidence) * float64(t))
+	}
+
+	_, x, err := lp.Simplex(c, A, b, 1e-10, nil)
+	if err != nil {
+		return nil, fmt.Errorf("minimum cvar: linear program: %w", err)
+	}
+	w := make([]float64, n)
+	for j := range n {
+		w[j] = x[j] + cons.MinWeight
+	}
+	return clampWeights(w, cons), nil
+}
+
+// HistoricalCVaR is the mean loss, as a positive fraction, over the worst
+// 1-confidence share of the portfolio returns. Fractional tail periods are
+// weighted in, so it matches the optimum of the linear program above.
+func HistoricalCVaR(portfolioReturns []float64, confidence float64) float64 {
+	t := len(portfolioReturns)
+	if t == 0 {
+		return 0
+	}
+	losses := make([]float64, t)
+	for i, r := range portfolioReturns {
+		losses[i] = -r
+	}
+	sort.Sort(sort.Reverse(sort.Float64Slice(losses)))
+
+	tail := (1 - confidence) * float64(t)
+	sum, left := 0.0, tail
+	for _, loss := range losses {
+		if left <= 0 {
+			break
+		}
+		take := math.Min(1, left)
+		sum += take * loss
+		left -= take
+	}
+	return sum / tail
+}
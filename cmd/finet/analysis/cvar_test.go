@@ -0,0 +1,84 @@
+package analysis_test
+
+import (
+	"context"
+	"math"
+	"testing"
+
+	"github.com/AndrewBrickweg/Finet_v2/cmd/finet/analysis"
+)
+
+// portfolioSeries applies weights to every period of returns.
+func portfolioSeries(returns map[string][]float64, weights map[string]float64) []float64 {
+	var series []float64
+	for ticker, w := range weights {
+		if series == nil {
+			series = make([]float64, len(returns[ticker]))
+		}
+		for t, r := range returns[ticker] {
+			series[t] += w * r
+		}
+	}
+	return series
+}
+
+func TestHistoricalCVaR(t *testing.T) {
+	returns := []float64{0.05, -0.10, 0.02, -0.04, 0.01, -0.02, 0.03, 0.00, -0.01, 0.04}
+	if got := analysis.HistoricalCVaR(returns, 0.8); math.Abs(got-0.07) > 1e-15 {
+		t.Errorf("CVaR 80%% = %v, want the mean of the two worst losses, 0.07", got)
+	}
+	// a quarter of 10 periods is the two worst losses plus half the third
+	if got, want := analysis.HistoricalCVaR(returns, 0.75), (0.10+0.04+0.5*0.02)/2.5; math.Abs(got-want) > 1e-15 {
+		t.Errorf("CVaR 75%% = %v, want %v", got, want)
+	}
+}
+
+func TestMinCVaR(t *testing.T) {
+	returns := syntheticReturns(8, 120)
+	const level, minW, maxW = 0.95, 0.02, 0.40
+	cons := analysis.Constraints{MinWeight: minW, MaxWeight: maxW}
+
+	cfg := analysis.OptimizerConfig{Mode: analysis.ModeMinCVaR, MinWeight: minW, MaxWeight: maxW, CVaRLevel: level}
+	_, best, err := analysis.Optimize(context.Background(), returns, cfg)
+	if err != nil {
+		t.Fatalf("Optimize(min_cvar): %v", err)
+	}
+	checkWeights(t, best, minW, maxW)
+	cvar := analysis.HistoricalCVaR(portfolioSeries(returns, best.Weights), level)
+
+	minVar, err := analysis.OptimizeMinVariance(returns, 0, cons)
+	if err != nil {
+		t.Fatalf("OptimizeMinVariance: %v", err)
+	}
+	if other := analysis.HistoricalCVaR(portfolioSeries(returns, minVar.Weights), level); cvar > other+1e-9 {
+		t.Errorf("min cvar portfolio has CVaR %v, above the min variance portfolio's %v", cvar, other)
+	}
+	equal := map[string]float64{}
+	for ticker := range returns {
+		equal[ticker] = 1.0 / 8
+	}
+	if other := analysis.HistoricalCVaR(portfolioSeries(returns, equal), level); cvar > other+1e-9 {
+		t.Errorf("min cvar portfolio has CVaR %v, above equal weights' %v", cvar, other)
+	}
+
+	// sector rows: hold at most 30% and at least 10% in the first half of the tickers
+	sectors := map[string]string{}
+	for i, ticker := range analysis.NewUniverse(returns).Tickers {
+		sectors[ticker] = map[bool]string{true: "first", false: "second"}[i < 4]
+	}
+	limited := cons
+	limited.Sectors = sectors
+	limited.SectorLimits = []analysis.SectorLimit{{Sector: "first", Min: 0.10, Max: 0.30}}
+	capped, err := analysis.OptimizeMinCVaR(returns, 0, limited, level)
+	if err != nil {
+		t.Fatalf("OptimizeMinCVaR with sector limits: %v", err)
+	}
+	checkWeights(t, capped, minW, maxW)
+	if got := analysis.SectorBreakdown(capped.Weights, sectors)["first"]; got < 0.10-1e-9 || got > 0.30+1e-9 {
+		t.Errorf("first sector holds %v, want 10%% to 30%%", got)
+	}
+
+	if _, err := analysis.OptimizeMinCVaR(returns, 0, cons, 1); err == nil {
+		t.Error("OptimizeMinCVaR accepted confidence 1")
+	}
+}
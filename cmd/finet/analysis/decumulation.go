@@ -0,0 +1,293 @@
+package analysis
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"gonum.org/v1/gonum/stat"
+)
+
+// Retirement decumulation. A portfolio funds monthly withdrawals under one of
+// a few spending rules, along bootstrapped paths for the odds and along the
+// actual history from every January for the worst sequences on record.
+
+// WithdrawalRule sets how much a retiree withdraws each month.
+type WithdrawalRule string
+
+const (
+	// WithdrawFixed takes Rate × Initial a year, raised with inflation every
+	// year whatever the markets do: the "4% rule".
+	WithdrawFixed WithdrawalRule = "fixed"
+	// WithdrawPercent takes Rate of the current wealth a year, so spending
+	// follows the markets and the money never quite runs out.
+	WithdrawPercent WithdrawalRule = "percent"
+	// WithdrawGuardrails starts like WithdrawFixed, but once a year, after
+	// the inflation raise, cuts spending by Adjustment when it has grown past
+	// (1+Guardrail) × Rate of the current wealth, and raises it by Adjustment
+	// when it has fallen below (1-Guardrail) × Rate (Guyton and Klinger 2006).
+	WithdrawGuardrails WithdrawalRule = "guardrails"
+)
+
+const (
+	DefaultGuardrail  = 0.2
+	DefaultAdjustment = 0.1
+)
+
+// ParseWithdrawalRule maps a request value onto a rule. Empty selects
+// WithdrawFixed.
+func ParseWithdrawalRule(s string) (WithdrawalRule, error) {
+	switch r := WithdrawalRule(strings.ToLower(strings.TrimSpace(s))); r {
+	case "":
+		return WithdrawFixed, nil
+	case WithdrawFixed, WithdrawPercent, WithdrawGuardrails:
+		return r, nil
+	default:
+		return "", fmt.Errorf("unknown withdrawal rule %q", s)
+	}
+}
+
+// DecumulationConfig describes a retirement. Rates are annual; withdrawals
+// are a twelfth of the year's amount, taken at the start of every month.
+type DecumulationConfig struct {
+	Rule       WithdrawalRule
+	Initial    float64
+	Rate       float64 // first year's withdrawal over Initial, or of current wealth for WithdrawPercent
+	Inflation  float64 // raises fixed and guardrail withdrawals, and deflates the reported wealth
+	Months     int     // horizon
+	Guardrail  float64 // WithdrawGuardrails only; 0 uses DefaultGuardrail
+	Adjustment float64 // WithdrawGuardrails only; 0 uses DefaultAdjustment
+
+	Paths       int   // bootstrapped paths; 0 uses DefaultSimulationPaths
+	BlockMonths int   // 0 uses DefaultBlockMonths
+	Seed        int64 // identical seeds give identical paths, 0 picks one
+}
+
+// HistoricalStart is a retirement begun at the start of one month of the
+// history and run through the months after it. A Wrapped one ran past the
+// end of the history and carried on from its beginning.
+type HistoricalStart struct {
+	Start          string
+	Depleted       string  `json:",omitempty"` // the month of the history the money ran out in
+	MonthsLasted   int     // Months unless depleted
+	TerminalWealth float64 // in today's money
+	TotalWithdrawn float64 // in today's money
+	Wrapped        bool
+}
+
+// Decumulation reports how a portfolio fared under a withdrawal rule. Wealth
+// and withdrawals are in today's money, deflated by the inflation rate.
+type Decumulation struct {
+	Rule  WithdrawalRule
+	Paths int
+
+	DepletionProbability float64 // share of bootstrapped paths that ran out before the horizon
+	MedianTerminal       float64
+	Percentiles          []float64 // the levels of TerminalPercentiles
+	TerminalPercentiles  []float64
+	MedianWithdrawn      float64 // total over the horizon
+
+	// HistoricalStarts holds one retirement per January of the history,
+	// worst first: earliest depleted, then least wealth left.
+	HistoricalStarts      []HistoricalStart
+	HistoricalSuccessRate float64 // share of HistoricalStarts never depleted
+}
+
+// DecumulationResult is a decumulation with the history it replayed.
+type DecumulationResult struct {
+	*Decumulation
+	Months []string
+	Gaps   GapReport
+}
+
+// OrchestrateDecumulation aligns the monthly data of the weighted tickers and
+// simulates withdrawals from the portfolio holding weights.
+func OrchestrateDecumulation(ctx context.Context, monthly []*StockDataMonthly, weights map[string]float64, policy GapPolicy, cfg DecumulationConfig) (*DecumulationResult, error) {
+	if len(monthly) == 0 {
+		return nil, fmt.Errorf("no monthly data provided")
+	}
+	panel, err := AlignMonthlyReturns(monthly, policy)
+	if err != nil {
+		return nil, err
+	}
+	series, err := weightedReturns(weights, panel.Returns)
+	if err != nil {
+		return nil, err
+	}
+	d, err := Decumulate(ctx, series, panel.Months, cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &DecumulationResult{Decumulation: d, Months: panel.Months, Gaps: panel.Gaps}, nil
+}
+
+// Decumulate runs cfg along bootstrapped paths of the monthly portfolio
+// returns in series, and along series itself from every January in months.
+func Decumulate(ctx context.Context, series []float64, months []string, cfg DecumulationConfig) (*Decumulation, error) {
+	if len(series) != len(months) {
+		return nil, fmt.Errorf("%d month labels for %d returns", len(months), len(series))
+	}
+	if len(series) < 2 {
+		return nil, fmt.Errorf("%w: have %d, need 2", ErrTooFewObservations, len(series))
+	}
+	if err := cfg.validate(len(series)); err != nil {
+		return nil, err
+	}
+	if cfg.Rule == "" {
+		cfg.Rule = WithdrawFixed
+	}
+	if cfg.Paths == 0 {
+		cfg.Paths = DefaultSimulationPaths
+	}
+	d := &Decumulation{Rule: cfg.Rule, Paths: cfg.Paths, Percentiles: WealthPercentiles}
+	terminal := make([]float64, cfg.Paths)
+	withdrawn := make([]float64, cfg.Paths)
+	depleted := 0
+	rng := newRand(cfg.Seed)
+	path := make([]float64, cfg.Months)
+	for p := range cfg.Paths {
+		if p%256 == 0 {
+			if err := ctx.Err(); err != nil {
+				return nil, fmt.Errorf("decumulation stopped: %w", err)
+			}
+		}
+		bootstrapPath(rng, series, cfg.blockMonths(), path)
+		out := cfg.withdraw(path)
+		terminal[p], withdrawn[p] = out.terminal, out.withdrawn
+		if out.depleted >= 0 {
+			depleted++
+		}
+	}
+	d.DepletionProbability = float64(depleted) / float64(cfg.Paths)
+	sort.Float64s(terminal)
+	sort.Float64s(withdrawn)
+	for _, q := range WealthPercentiles {
+		d.TerminalPercentiles = append(d.TerminalPercentiles, stat.Quantile(q, stat.Empirical, terminal, nil))
+	}
+	d.MedianTerminal = stat.Quantile(0.5, stat.Empirical, terminal, nil)
+	d.MedianWithdrawn = stat.Quantile(0.5, stat.Empirical, withdrawn, nil)
+
+	survived := 0
+	for i, m := range months {
+		if !strings.HasSuffix(m, "-01") {
+			continue
+		}
+		for k := range path {
+			path[k] = series[(i+k)%len(series)]
+		}
+		out := cfg.withdraw(path)
+		start := HistoricalStart{
+			Start:          m,
+			MonthsLasted:   cfg.Months,
+			TerminalWealth: out.terminal,
+			TotalWithdrawn: out.withdrawn,
+			Wrapped:        i+cfg.Months > len(series),
+		}
+		if out.depleted >= 0 {
+			start.Depleted = months[(i+out.depleted)%len(months)]
+			start.MonthsLasted = out.depleted
+		} else {
+			survived++
+		}
+		d.HistoricalStarts = append(d.HistoricalStarts, start)
+	}
+	sort.SliceStable(d.HistoricalStarts, func(a, b int) bool {
+		x, y := d.HistoricalStarts[a], d.HistoricalStarts[b]
+		if x.MonthsLasted != y.MonthsLasted {
+			return x.MonthsLasted < y.MonthsLasted
+		}
+		return x.TerminalWealth < y.TerminalWealth
+	})
+	if len(d.HistoricalStarts) > 0 {
+		d.HistoricalSuccessRate = float64(survived) / float64(len(d.HistoricalStarts))
+	}
+	return d, nil
+}
+
+func (cfg DecumulationConfig) validate(history int) error {
+	switch cfg.Rule {
+	case "", WithdrawFixed, WithdrawPercent, WithdrawGuardrails:
+	default:
+		return fmt.Errorf("unknown withdrawal rule %q", cfg.Rule)
+	}
+	switch {
+	case !(cfg.Initial > 0):
+		return fmt.Errorf("initial wealth must be positive, got %v", cfg.Initial)
+	case !(cfg.Rate > 0 && cfg.Rate < 1):
+		return fmt.Errorf("withdrawal rate must be in (0, 1), got %v", cfg.Rate)
+	case !(cfg.Inflation > -1):
+		return fmt.Errorf("inflation must be above -1, got %v", cfg.Inflation)
+	case cfg.Months < 1:
+		return fmt.Errorf("retirement horizon must be at least 1 month, got %d", cfg.Months)
+	case cfg.Paths < 0:
+		return fmt.Errorf("decumulation needs at least 1 path, got %d", cfg.Paths)
+	case cfg.Guardrail < 0 || cfg.Guardrail >= 1 || cfg.Adjustment < 0 || cfg.Adjustment >= 1:
+		return fmt.Errorf("guardrail and adjustment must be in [0, 1), got %v and %v", cfg.Guardrail, cfg.Adjustment)
+	case cfg.BlockMonths < 0:
+		return fmt.Errorf("bootstrap blocks must be at least 1 month, got %d", cfg.BlockMonths)
+	}
+	if block := cfg.blockMonths(); block > history {
+		return fmt.Errorf("%w: bootstrap blocks of %d months need as much history, have %d", ErrTooFewObservations, block, history)
+	}
+	return nil
+}
+
+func (cfg DecumulationConfig) blockMonths() int {
+	if cfg.BlockMonths == 0 {
+		return DefaultBlockMonths
+	}
+	return cfg.BlockMonths
+}
+
+// withdrawal is one retirement's outcome, in today's money.
+type withdrawal struct {
+	terminal  float64
+	withdrawn float64
+	depleted  int // months funded in full before the money ran out, -1 if it never did
+}
+
+// withdraw applies cfg's rule along path, one return per month.
+func (cfg DecumulationConfig) withdraw(path []float64) withdrawal {
+	guardrail, adjustment := cfg.Guardrail, cfg.Adjustment
+	if guardrail == 0 {
+		guardrail = DefaultGuardrail
+	}
+	if adjustment == 0 {
+		adjustment = DefaultAdjustment
+	}
+	monthlyInflation := math.Pow(1+cfg.Inflation, 1.0/12)
+
+	out := withdrawal{depleted: -1}
+	wealth := cfg.Initial
+	annual := cfg.Rate * cfg.Initial // nominal, for the fixed and guardrail rules
+	deflator := 1.0
+	for t, r := range path {
+		if t > 0 && t%12 == 0 && cfg.Rule != WithdrawPercent {
+			annual *= 1 + cfg.Inflation
+			if cfg.Rule == WithdrawGuardrails {
+				switch rate := annual / wealth; {
+				case rate > cfg.Rate*(1+guardrail):
+					annual *= 1 - adjustment
+				case rate < cfg.Rate*(1-guardrail):
+					annual *= 1 + adjustment
+				}
+			}
+		}
+		amount := annual / 12
+		if cfg.Rule == WithdrawPercent {
+			amount = wealth * cfg.Rate / 12
+		}
+		if wealth <= 0 || amount > wealth {
+			out.withdrawn += wealth / deflator
+			out.depleted = t
+			return out
+		}
+		out.withdrawn += amount / deflator
+		wealth = math.Max((wealth-amount)*(1+r), 0)
+		deflator *= monthlyInflation
+	}
+	out.terminal = wealth / deflator
+	return out
+}
@@ -0,0 +1,115 @@
+package analysis_test
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/AndrewBrickweg/Finet_v2/cmd/finet/analysis"
+)
+
+// flatHistory labels n monthly returns from January 2000, all zero but the
+// ones given by index.
+func flatHistory(n int, shocks map[int]float64) ([]float64, []string) {
+	series := make([]float64, n)
+	months := make([]string, n)
+	for i := range series {
+		series[i] = shocks[i]
+		months[i] = fmt.Sprintf("%d-%02d", 2000+i/12, i%12+1)
+	}
+	return series, months
+}
+
+func TestDecumulate(t *testing.T) {
+	ctx := context.Background()
+	series, months := flatHistory(36, nil)
+
+	t.Run("fixed without returns", func(t *testing.T) {
+		// 6% of 1000 a year is 5 a month, enough for 200 months
+		cfg := analysis.DecumulationConfig{Initial: 1000, Rate: 0.06, Months: 120, Paths: 50}
+		d, err := analysis.Decumulate(ctx, series, months, cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if d.Rule != analysis.WithdrawFixed || d.DepletionProbability != 0 || math.Abs(d.MedianTerminal-400) > 1e-9 || math.Abs(d.MedianWithdrawn-600) > 1e-9 {
+			t.Errorf("%s: depleted %v, median terminal %v and withdrawn %v, want 0, 400 and 600", d.Rule, d.DepletionProbability, d.MedianTerminal, d.MedianWithdrawn)
+		}
+		if len(d.HistoricalStarts) != 3 || d.HistoricalSuccessRate != 1 {
+			t.Errorf("%d historical starts with success rate %v, want 3 and 1", len(d.HistoricalStarts), d.HistoricalSuccessRate)
+		}
+
+		cfg.Months = 240
+		d, err = analysis.Decumulate(ctx, series, months, cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if d.DepletionProbability != 1 || d.HistoricalSuccessRate != 0 {
+			t.Errorf("depleted %v and historical success %v over 240 months, want 1 and 0", d.DepletionProbability, d.HistoricalSuccessRate)
+		}
+		worst := d.HistoricalStarts[0]
+		if worst.MonthsLasted != 200 || worst.Depleted != "2001-09" || !worst.Wrapped || math.Abs(worst.TotalWithdrawn-1000) > 1e-9 {
+			t.Errorf("worst start %+v, want 200 months ending in the history's 2001-09 after wrapping around", worst)
+		}
+	})
+
+	t.Run("inflation", func(t *testing.T) {
+		d, err := analysis.Decumulate(ctx, series, months, analysis.DecumulationConfig{Initial: 1000, Rate: 0.05, Inflation: 0.03, Months: 12, Paths: 10})
+		if err != nil {
+			t.Fatal(err)
+		}
+		// 950 left after a year, worth 3% less
+		if want := 950 / 1.03; math.Abs(d.MedianTerminal-want) > 1e-9 {
+			t.Errorf("terminal %v in today's money, want %v", d.MedianTerminal, want)
+		}
+	})
+
+	t.Run("percent never runs out", func(t *testing.T) {
+		d, err := analysis.Decumulate(ctx, series, months, analysis.DecumulationConfig{Rule: analysis.WithdrawPercent, Initial: 1000, Rate: 0.12, Months: 600, Paths: 10})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := 1000 * math.Pow(0.99, 600); d.DepletionProbability != 0 || math.Abs(d.MedianTerminal-want) > 1e-9 {
+			t.Errorf("depleted %v with terminal %v, want 0 and %v", d.DepletionProbability, d.MedianTerminal, want)
+		}
+	})
+
+	t.Run("sequence of returns", func(t *testing.T) {
+		crash, labels := flatHistory(24, map[int]float64{0: -0.4})
+		cfg := analysis.DecumulationConfig{Initial: 1000, Rate: 0.05, Months: 24, Paths: 10}
+		fixed, err := analysis.Decumulate(ctx, crash, labels, cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// retiring into the crash leaves less than meeting it a year later
+		if fixed.HistoricalStarts[0].Start != "2000-01" || fixed.HistoricalStarts[1].Start != "2001-01" || !fixed.HistoricalStarts[1].Wrapped {
+			t.Errorf("historical starts %+v, want 2000-01 first", fixed.HistoricalStarts)
+		}
+
+		cfg.Rule = analysis.WithdrawGuardrails
+		guarded, err := analysis.Decumulate(ctx, crash, labels, cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// after the crash 50 a year is over 6% of the wealth left, so the
+		// guardrail cuts the second year's spending by a tenth
+		f, g := fixed.HistoricalStarts[0], guarded.HistoricalStarts[0]
+		if math.Abs(f.TotalWithdrawn-g.TotalWithdrawn-5) > 1e-9 || math.Abs(g.TerminalWealth-f.TerminalWealth-5) > 1e-9 {
+			t.Errorf("guardrails withdrew %v and left %v, fixed %v and %v; want 5 less spent and 5 more left", g.TotalWithdrawn, g.TerminalWealth, f.TotalWithdrawn, f.TerminalWealth)
+		}
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		for name, cfg := range map[string]analysis.DecumulationConfig{
+			"unknown rule":   {Rule: "variable", Initial: 1000, Rate: 0.04, Months: 12},
+			"no wealth":      {Rate: 0.04, Months: 12},
+			"rate too high":  {Initial: 1000, Rate: 1.5, Months: 12},
+			"no horizon":     {Initial: 1000, Rate: 0.04},
+			"block too long": {Initial: 1000, Rate: 0.04, Months: 12, BlockMonths: 37},
+		} {
+			if _, err := analysis.Decumulate(ctx, series, months, cfg); err == nil {
+				t.Errorf("%s: no error", name)
+			}
+		}
+	})
+}
@@ -0,0 +1,131 @@
+package analysis
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"gonum.org/v1/gonum/stat"
+)
+
+// Expected return estimators. Every estimator returns per-period figures in
+// the frequency of the input series.
+
+// ReturnEstimator selects how NewUniverseWith estimates expected returns.
+type ReturnEstimator string
+
+const (
+	ReturnArithmetic ReturnEstimator = "arithmetic" // mean of the period returns
+	ReturnGeometric  ReturnEstimator = "geometric"  // compound growth rate (CAGR per period)
+	ReturnEWMA       ReturnEstimator = "ewma"       // mean weighted toward recent periods
+	ReturnCAPM       ReturnEstimator = "capm"       // rf + beta * (benchmark mean - rf)
+)
+
+var ErrNoBenchmark = errors.New("capm expected returns need a benchmark series")
+
+// ParseReturnEstimator maps a request value onto an estimator. Empty selects the arithmetic mean.
+func ParseReturnEstimator(s string) (ReturnEstimator, error) {
+	switch est := ReturnEstimator(strings.ToLower(strings.TrimSpace(s))); est {
+	case "":
+		return ReturnArithmetic, nil
+	case ReturnArithmetic, ReturnGeometric, ReturnEWMA, ReturnCAPM:
+		return est, nil
+	default:
+		return "", fmt.Errorf("unknown expected return estimator %q", s)
+	}
+}
+
+// expected estimates the expected return of each ticker with the selected estimator.
+func (e Estimators) expected(returns map[string][]float64) (map[string]float64, error) {
+	switch e.Returns {
+	case ReturnArithmetic, "":
+		return ExpectedReturn(returns), nil
+	case ReturnGeometric:
+		return GeometricReturn(returns), nil
+	case ReturnEWMA:
+		return EWMAReturn(returns, e.lambda())
+	case ReturnCAPM:
+		return CAPMReturn(returns, e.Benchmark, e.RiskFreeRate)
+	default:
+		return nil, fmt.Errorf("unknown expected return estimator %q", e.Returns)
+	}
+}
+
+// GeometricReturn is the compound growth rate per period, (∏(1+r))^(1/T) - 1.
+// It sits below the arithmetic mean by roughly half the variance, which is
+// what an investor holding the asset would actually have earned.
+func GeometricReturn(returns map[string][]float64) map[string]float64 {
+	expected := make(map[string]float64)
+
+	for ticker, stockReturns := range returns {
+		if len(stockReturns) == 0 {
+			continue
+		}
+
+		logGrowth := 0.0
+		for _, r := range stockReturns {
+			if r <= -1 {
+				// a total loss cannot be compounded back
+				logGrowth = math.Inf(-1)
+				break
+			}
+			logGrowth += math.Log1p(r)
+		}
+		expected[ticker] = math.Expm1(logGrowth / float64(len(stockReturns)))
+	}
+
+	return expected
+}
+
+// EWMAReturn weights the period k steps before the latest by λᵏ, normalized
+// so the weights sum to one.
+func EWMAReturn(returns map[string][]float64, lambda float64) (map[string]float64, error) {
+	if lambda <= 0 || lambda >= 1 {
+		return nil, fmt.Errorf("ewma decay must be in (0, 1), got %g", lambda)
+	}
+	expected := make(map[string]float64)
+
+	for ticker, stockReturns := range returns {
+		t := len(stockReturns)
+		if t == 0 {
+			continue
+		}
+		weights := make([]float64, t)
+		for k := range t {
+			weights[t-1-k] = math.Pow(lambda, float64(k))
+		}
+		expected[ticker] = stat.Mean(stockReturns, weights)
+	}
+
+	return expected, nil
+}
+
+// CAPMReturn prices each ticker off its beta to the benchmark,
+// rf + β·(E[benchmark] - rf), with E[benchmark] the benchmark's arithmetic mean.
+// Every series must cover the same periods as the benchmark.
+func CAPMReturn(returns map[string][]float64, benchmark []float64, riskFreeRate float64) (map[string]float64, error) {
+	if len(benchmark) < 2 {
+		return nil, ErrNoBenchmark
+	}
+	betas := BetaCoefficients(returns, benchmark)
+
+	var missing []string
+	for ticker := range returns {
+		if _, ok := betas[ticker]; !ok {
+			missing = append(missing, ticker)
+		}
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return nil, fmt.Errorf("no beta for %s: series must match the benchmark's %d periods", strings.Join(missing, ", "), len(benchmark))
+	}
+
+	premium := stat.Mean(benchmark, nil) - riskFreeRate
+	expected := make(map[string]float64, len(betas))
+	for ticker, beta := range betas {
+		expected[ticker] = riskFreeRate + beta*premium
+	}
+	return expected, nil
+}
@@ -0,0 +1,62 @@
+package analysis_test
+
+import (
+	"errors"
+	"math"
+	"testing"
+
+	"github.com/AndrewBrickweg/Finet_v2/cmd/finet/analysis"
+)
+
+func TestExpectedReturnEstimators(t *testing.T) {
+	returns := map[string][]float64{
+		"UP":   {0.10, -0.10, 0.10, -0.10},
+		"FLAT": {0.01, 0.01, 0.01, 0.01},
+	}
+
+	// +10% then -10% loses 1% every two periods even though the mean is zero.
+	geo := analysis.GeometricReturn(returns)
+	if want := math.Sqrt(0.99) - 1; math.Abs(geo["UP"]-want) > 1e-15 {
+		t.Errorf("geometric UP = %v, want %v", geo["UP"], want)
+	}
+	if math.Abs(geo["FLAT"]-0.01) > 1e-15 {
+		t.Errorf("geometric FLAT = %v, want 0.01", geo["FLAT"])
+	}
+
+	ewma, err := analysis.EWMAReturn(returns, 0.5)
+	if err != nil {
+		t.Fatalf("EWMAReturn: %v", err)
+	}
+	// weights 1/8, 1/4, 1/2, 1 normalized by 15/8, latest period last
+	if want := (0.10*0.125 - 0.10*0.25 + 0.10*0.5 - 0.10) / 1.875; math.Abs(ewma["UP"]-want) > 1e-15 {
+		t.Errorf("ewma UP = %v, want %v", ewma["UP"], want)
+	}
+
+	// CAPM: twice the benchmark's moves has beta 2.
+	benchmark := []float64{0.02, -0.01, 0.03, 0.00}
+	levered := map[string][]float64{"LEV": {0.05, -0.01, 0.07, 0.01}}
+	const rf = 0.002
+	capm, err := analysis.CAPMReturn(levered, benchmark, rf)
+	if err != nil {
+		t.Fatalf("CAPMReturn: %v", err)
+	}
+	if want := rf + 2*(0.01-rf); math.Abs(capm["LEV"]-want) > 1e-15 {
+		t.Errorf("capm LEV = %v, want %v", capm["LEV"], want)
+	}
+
+	if _, err := analysis.CAPMReturn(levered, nil, rf); !errors.Is(err, analysis.ErrNoBenchmark) {
+		t.Errorf("got error %v, want ErrNoBenchmark", err)
+	}
+	if _, err := analysis.CAPMReturn(returns, benchmark[:3], rf); err == nil {
+		t.Error("CAPMReturn accepted series longer than the benchmark")
+	}
+
+	// The chosen estimator feeds the optimizer inputs.
+	in, err := analysis.NewUniverseWith(levered, analysis.Estimators{Returns: analysis.ReturnCAPM, Benchmark: benchmark, RiskFreeRate: rf})
+	if err != nil {
+		t.Fatalf("NewUniverseWith: %v", err)
+	}
+	if in.Mean.AtVec(0) != capm["LEV"] {
+		t.Errorf("universe mean %v, want the capm estimate %v", in.Mean.AtVec(0), capm["LEV"])
+	}
+}
@@ -0,0 +1,72 @@
+package analysis
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// Frequency is the spacing of a return series. Every Return, Risk, Sharpe and
+// risk-free figure the optimizers take or produce is per period of the series.
+type Frequency string
+
+const (
+	Daily   Frequency = "daily"
+	Weekly  Frequency = "weekly"
+	Monthly Frequency = "monthly"
+)
+
+// ParseFrequency maps a request value onto a frequency. Empty selects monthly.
+func ParseFrequency(s string) (Frequency, error) {
+	switch f := Frequency(strings.ToLower(strings.TrimSpace(s))); f {
+	case "":
+		return Monthly, nil
+	case Daily, Weekly, Monthly:
+		return f, nil
+	default:
+		return "", fmt.Errorf("unknown frequency %q", s)
+	}
+}
+
+// PeriodsPerYear counts trading days, weeks or months in a year. The zero
+// Frequency is treated as monthly, the frequency of the stored price data.
+func (f Frequency) PeriodsPerYear() float64 {
+	switch f {
+	case Daily:
+		return 252
+	case Weekly:
+		return 52
+	default:
+		return 12
+	}
+}
+
+// PeriodicRate converts an annual rate, such as a 4% risk-free rate, to a
+// rate per period using the same simple scaling Annualize undoes.
+func (f Frequency) PeriodicRate(annual float64) float64 {
+	return annual / f.PeriodsPerYear()
+}
+
+// DefaultEWMALambda is the RiskMetrics decay for the frequency.
+func (f Frequency) DefaultEWMALambda() float64 {
+	if f == Daily {
+		return 0.94
+	}
+	return DefaultEWMALambda
+}
+
+// Annualize scales periodic figures to a year: return times the number of
+// periods, volatility times its square root. The annual Sharpe ratio is the
+// periodic one times the square root, which is also what annualizing the
+// return, volatility and risk-free rate separately gives.
+func (f Frequency) Annualize(ret, risk, sharpe float64) (annualReturn, annualRisk, annualSharpe float64) {
+	periods := f.PeriodsPerYear()
+	return ret * periods, risk * math.Sqrt(periods), sharpe * math.Sqrt(periods)
+}
+
+func (f Frequency) orMonthly() Frequency {
+	if f == "" {
+		return Monthly
+	}
+	return f
+}
@@ -0,0 +1,59 @@
+package analysis_test
+
+import (
+	"context"
+	"math"
+	"testing"
+
+	"github.com/AndrewBrickweg/Finet_v2/cmd/finet/analysis"
+)
+
+func TestFrequency(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    analysis.Frequency
+		periods float64
+	}{
+		{in: "", want: analysis.Monthly, periods: 12},
+		{in: "Weekly", want: analysis.Weekly, periods: 52},
+		{in: "daily", want: analysis.Daily, periods: 252},
+	}
+	for _, tt := range tests {
+		f, err := analysis.ParseFrequency(tt.in)
+		if err != nil || f != tt.want {
+			t.Fatalf("ParseFrequency(%q) = %q, %v; want %q", tt.in, f, err, tt.want)
+		}
+		if f.PeriodsPerYear() != tt.periods {
+			t.Errorf("%s: %v periods a year, want %v", f, f.PeriodsPerYear(), tt.periods)
+		}
+		if got := f.PeriodicRate(0.04) * tt.periods; math.Abs(got-0.04) > 1e-15 {
+			t.Errorf("%s: periodic rate does not scale back to 4%%: %v", f, got)
+		}
+	}
+	if _, err := analysis.ParseFrequency("hourly"); err == nil {
+		t.Error("ParseFrequency accepted hourly")
+	}
+
+	// Annualizing return, volatility and risk-free rate separately gives the annual Sharpe.
+	returns := analysis.MonthlyStockReturns(analysis.ExtractMonthlyAdjClosePrices(MockStockData()))
+	const annualRF = 0.04
+	cfg := analysis.OptimizerConfig{
+		Mode:         analysis.ModeMinVariance,
+		RiskFreeRate: analysis.Monthly.PeriodicRate(annualRF),
+		MinWeight:    0.02,
+		MaxWeight:    0.20,
+	}
+	_, best, err := analysis.Optimize(context.Background(), returns, cfg)
+	if err != nil {
+		t.Fatalf("Optimize: %v", err)
+	}
+	if best.Frequency != analysis.Monthly {
+		t.Errorf("frequency %q, want monthly", best.Frequency)
+	}
+	if math.Abs(best.AnnualReturn-12*best.Return) > 1e-12 || math.Abs(best.AnnualRisk-math.Sqrt(12)*best.Risk) > 1e-12 {
+		t.Errorf("annual return %v and risk %v do not scale monthly %v and %v", best.AnnualReturn, best.AnnualRisk, best.Return, best.Risk)
+	}
+	if want := (best.AnnualReturn - annualRF) / best.AnnualRisk; math.Abs(best.AnnualSharpe-want) > 1e-9 {
+		t.Errorf("annual sharpe %v, want %v", best.AnnualSharpe, want)
+	}
+}
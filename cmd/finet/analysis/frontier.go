@@ -0,0 +1,95 @@
+package analysis
+
+import (
+	"errors"
+	"fmt"
+)
+
+// RiskReturnPoint is a weightless summary of a portfolio, used for the
+// scatter of simulated portfolios behind the frontier.
+type RiskReturnPoint struct {
+	Return float64 // per period, like Portfolio
+	Risk   float64
+	Sharpe float64
+
+	AnnualReturn float64
+	AnnualRisk   float64
+	AnnualSharpe float64
+}
+
+// EfficientFrontier returns numPoints portfolios evenly spaced in expected return,
+// from the minimum-variance portfolio up to the maximum-return portfolio
+// attainable within the constraints. Each point is the minimum-variance
+// portfolio for its return.
+func EfficientFrontier(returns map[string][]float64, numPoints int, riskFreeRate float64, constraints Constraints) ([]Portfolio, error) {
+	return efficientFrontier(NewUniverse(returns), numPoints, riskFreeRate, constraints)
+}
+
+func efficientFrontier(in *Universe, numPoints int, riskFreeRate float64, constraints Constraints) ([]Portfolio, error) {
+	if numPoints < 2 {
+		return nil, errors.New("efficient frontier needs at least 2 points")
+	}
+	cons, err := constraints.prepare(in.Tickers)
+	if err != nil {
+		return nil, err
+	}
+
+	minVar, err := minVarianceWeights(in, cons)
+	if err != nil {
+		return nil, err
+	}
+	maxRet, err := maxReturnWeights(in, cons)
+	if err != nil {
+		return nil, err
+	}
+
+	low := in.portfolio(minVar, riskFreeRate)
+	high := in.portfolio(maxRet, riskFreeRate)
+
+	points := make([]Portfolio, 0, numPoints)
+	points = append(points, low)
+	step := (high.Return - low.Return) / float64(numPoints-1)
+	for k := 1; k < numPoints-1; k++ {
+		target := low.Return + float64(k)*step
+		w, err := targetReturnWeights(in, cons, target)
+		if err != nil {
+			return nil, fmt.Errorf("efficient frontier point %d: %w", k, err)
+		}
+		points = append(points, in.portfolio(w, riskFreeRate))
+	}
+	points = append(points, high)
+
+	return points, nil
+}
+
+// DownsamplePortfolios keeps at most maxPoints portfolios, taking every k-th
+// one so the cloud keeps the shape of the full simulation.
+func DownsamplePortfolios(portfolios []Portfolio, maxPoints int) []RiskReturnPoint {
+	points := make([]RiskReturnPoint, len(portfolios))
+	for i, p := range portfolios {
+		points[i] = RiskReturnPoint{
+			Return:       p.Return,
+			Risk:         p.Risk,
+			Sharpe:       p.Sharpe,
+			AnnualReturn: p.AnnualReturn,
+			AnnualRisk:   p.AnnualRisk,
+			AnnualSharpe: p.AnnualSharpe,
+		}
+	}
+	return downsamplePoints(points, maxPoints)
+}
+
+func downsamplePoints(points []RiskReturnPoint, maxPoints int) []RiskReturnPoint {
+	if maxPoints <= 0 || len(points) == 0 {
+		return nil
+	}
+	stride := 1
+	if len(points) > maxPoints {
+		stride = (len(points) + maxPoints - 1) / maxPoints
+	}
+	cloud := make([]RiskReturnPoint, 0, len(points)/stride+1)
+	for i := 0; i < len(points); i += stride {
+		cloud = append(cloud, points[i])
+	}
+	return cloud
+}
@@ -0,0 +1,280 @@
+package analysis
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"gonum.org/v1/gonum/floats"
+	"gonum.org/v1/gonum/mat"
+)
+
+// Hierarchical Risk Parity (López de Prado 2016). HRP never inverts the
+// covariance matrix: it clusters the assets by correlation, orders them so
+// similar assets sit next to each other, then splits the budget top down
+// between halves of that order in inverse proportion to their variance.
+
+// Dendrogram is the single-linkage clustering behind an HRP portfolio, in the
+// layout scipy's linkage uses. Leaf i is Tickers[i]; merge k creates cluster
+// len(Tickers)+k.
+type Dendrogram struct {
+	Tickers []string
+	Order   []string // leaves left to right, the quasi-diagonal order
+	Merges  []ClusterMerge
+}
+
+// ClusterMerge joins clusters Left and Right at Distance into a cluster of Size leaves.
+type ClusterMerge struct {
+	Left     int
+	Right    int
+	Distance float64
+	Size     int
+}
+
+// OptimizeHRP returns the Hierarchical Risk Parity portfolio within the weight
+// bounds and sector limits, with its dendrogram in Clusters. riskFreeRate is only used to report
+// the Sharpe ratio.
+func OptimizeHRP(returns map[string][]float64, riskFreeRate float64, constraints Constraints) (Portfolio, error) {
+	return optimizeHRP(NewUniverse(returns), CorrelationMatrixSample(returns), riskFreeRate, constraints)
+}
+
+func optimizeHRP(in *Universe, corr map[string]map[string]float64, riskFreeRate float64, constraints Constraints) (Portfolio, error) {
+	cons, err := constraints.prepare(in.Tickers)
+	if err != nil {
+		return Portfolio{}, err
+	}
+	for i, t := range in.Tickers {
+		if !(in.Cov.At(i, i) > 0) {
+			return Portfolio{}, fmt.Errorf("hierarchical risk parity: %s has no variance", t)
+		}
+	}
+
+	tree := singleLinkage(in.Tickers, corr)
+	order := tree.leafOrder()
+	w, err := hrpBisect(in, cons, order)
+	if err != nil {
+		return Portfolio{}, err
+	}
+
+	for _, i := range order {
+		tree.Order = append(tree.Order, in.Tickers[i])
+	}
+	p := in.portfolio(w, riskFreeRate)
+	p.Clusters = tree
+	return p, nil
+}
+
+// singleLinkage clusters tickers on the distance between their correlation
+// distance profiles. dᵢⱼ = √(½(1-ρᵢⱼ)) is a metric on the assets; comparing
+// whole columns of d, d̃ᵢⱼ = ‖d·ᵢ - d·ⱼ‖, clusters assets that relate to the
+// rest of the basket alike. Single linkage merges in the order of the minimum
+// spanning tree's edges, so Prim's algorithm builds it in O(n²).
+func singleLinkage(tickers []string, corr map[string]map[string]float64) *Dendrogram {
+	n := len(tickers)
+	d := make([][]float64, n)
+	for i, a := range tickers {
+		d[i] = make([]float64, n)
+		for j, b := range tickers {
+			rho := 1.0
+			if i != j {
+				rho = corr[a][b]
+			}
+			d[i][j] = math.Sqrt(math.Max(0, (1-rho)/2))
+		}
+	}
+	dist := func(i, j int) float64 {
+		s := 0.0
+		for k := range n {
+			diff := d[k][i] - d[k][j]
+			s += diff * diff
+		}
+		return math.Sqrt(s)
+	}
+
+	type edge struct {
+		a, b int
+		w    float64
+	}
+	edges := make([]edge, 0, n)
+	inTree := make([]bool, n)
+	best := make([]float64, n)
+	from := make([]int, n)
+	for i := range best {
+		best[i] = math.Inf(1)
+	}
+	next := 0
+	for range n {
+		inTree[next] = true
+		cur := next
+		next = -1
+		for j := range n {
+			if inTree[j] {
+				continue
+			}
+			if dj := dist(cur, j); dj < best[j] {
+				best[j], from[j] = dj, cur
+			}
+			if next < 0 || best[j] < best[next] {
+				next = j
+			}
+		}
+		if next < 0 {
+			break
+		}
+		edges = append(edges, edge{from[next], next, best[next]})
+	}
+	sort.SliceStable(edges, func(i, j int) bool { return edges[i].w < edges[j].w })
+
+	// union-find over the edges; cluster holds the dendrogram id of each root
+	parent := make([]int, n)
+	cluster := make([]int, n)
+	size := make([]int, n)
+	for i := range parent {
+		parent[i], cluster[i], size[i] = i, i, 1
+	}
+	var find func(int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+
+	tree := &Dendrogram{Tickers: tickers}
+	for k, e := range edges {
+		ra, rb := find(e.a), find(e.b)
+		left, right := cluster[ra], cluster[rb]
+		if left > right {
+			left, right = right, left
+		}
+		parent[rb] = ra
+		size[ra] += size[rb]
+		cluster[ra] = n + k
+		tree.Merges = append(tree.Merges, ClusterMerge{Left: left, Right: right, Distance: e.w, Size: size[ra]})
+	}
+	return tree
+}
+
+// leafOrder lists the leaf indices left to right, the quasi-diagonalization
+// step that puts correlated assets next to each other.
+func (t *Dendrogram) leafOrder() []int {
+	n := len(t.Tickers)
+	if n == 0 {
+		return nil
+	}
+	var order []int
+	stack := []int{n + len(t.Merges) - 1}
+	for len(stack) > 0 {
+		id := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if id < n {
+			order = append(order, id)
+			continue
+		}
+		m := t.Merges[id-n]
+		stack = append(stack, m.Right, m.Left)
+	}
+	return order
+}
+
+// hrpBisect splits weight down the quasi-diagonal order. Each half gets a share
+// inversely proportional to the variance of its inverse-variance portfolio,
+// clamped so both halves can still hold MinWeight to MaxWeight per asset.
+// With sector limits the clamp comes from two linear programs instead: the
+// least and most the left half can hold given the limits and every split made
+// so far, which keeps a feasible portfolio within reach at each step.
+func hrpBisect(in *Universe, cons Constraints, order []int) ([]float64, error) {
+	n := len(order)
+	w := make([]float64, n)
+	A, l, u := cons.linearRows(in.Tickers)
+	rows := make([][]float64, 0, 2*n)
+	for r := range len(l) {
+		rows = append(rows, mat.Row(nil, r, A))
+	}
+
+	// halfRange returns the least and most weight items can hold.
+	halfRange := func(items []int) (float64, float64, error) {
+		c := make([]float64, n)
+		for _, i := range items {
+			c[i] = 1
+		}
+		A := stackRows(rows, n)
+		least, err := solveLP(c, A, l, u)
+		if err != nil {
+			return 0, 0, fmt.Errorf("hierarchical risk parity: %w", err)
+		}
+		floats.Scale(-1, c)
+		most, err := solveLP(c, A, l, u)
+		if err != nil {
+			return 0, 0, fmt.Errorf("hierarchical risk parity: %w", err)
+		}
+		floats.Scale(-1, c)
+		return floats.Dot(c, least), floats.Dot(c, most), nil
+	}
+
+	var split func(items []int, total float64) error
+	split = func(items []int, total float64) error {
+		if len(items) == 1 {
+			w[items[0]] = total
+			return nil
+		}
+		if total <= 0 {
+			return nil // the limits leave this cluster nothing to split
+		}
+		left, right := items[:len(items)/2], items[len(items)/2:]
+		vl, vr := clusterVariance(in, left), clusterVariance(in, right)
+		alpha := 1 - vl/(vl+vr)
+
+		var lo, hi float64
+		if len(cons.SectorLimits) == 0 {
+			nl, nr := float64(len(left)), float64(len(right))
+			lo = math.Max(nl*cons.MinWeight, total-nr*cons.MaxWeight) / total
+			hi = math.Min(nl*cons.MaxWeight, total-nr*cons.MinWeight) / total
+		} else {
+			least, most, err := halfRange(left)
+			if err != nil {
+				return err
+			}
+			lo, hi = least/total, most/total
+		}
+		alpha = math.Min(math.Max(alpha, lo), hi)
+
+		if len(cons.SectorLimits) > 0 {
+			// fix the left half's total; the right half's follows from its parent
+			row := make([]float64, n)
+			for _, i := range left {
+				row[i] = 1
+			}
+			rows = append(rows, row)
+			l = append(l, total*alpha)
+			u = append(u, total*alpha)
+		}
+		if err := split(left, total*alpha); err != nil {
+			return err
+		}
+		return split(right, total*(1-alpha))
+	}
+	if n > 0 {
+		if err := split(order, 1); err != nil {
+			return nil, err
+		}
+	}
+	return clampWeights(w, cons), nil
+}
+
+// clusterVariance is the variance of the inverse-variance portfolio of items.
+func clusterVariance(in *Universe, items []int) float64 {
+	ivp := make([]float64, len(items))
+	total := 0.0
+	for k, i := range items {
+		ivp[k] = 1 / in.Cov.At(i, i)
+		total += ivp[k]
+	}
+	v := 0.0
+	for a, i := range items {
+		for b, j := range items {
+			v += ivp[a] * ivp[b] * in.Cov.At(i, j)
+		}
+	}
+	return v / (total * total)
+}
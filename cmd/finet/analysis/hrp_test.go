@@ -0,0 +1,142 @@
+package analysis_test
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/AndrewBrickweg/Finet_v2/cmd/finet/analysis"
+)
+
+// clusteredReturns builds groups of tickers that move with their own factor.
+func clusteredReturns(groups, perGroup, months int) map[string][]float64 {
+	r := rand.New(rand.NewSource(5))
+	returns := make(map[string][]float64, groups*perGroup)
+	for g := range groups {
+		factor := make([]float64, months)
+		for m := range factor {
+			factor[m] = 0.05 * r.NormFloat64()
+		}
+		for k := range perGroup {
+			series := make([]float64, months)
+			for m := range series {
+				series[m] = 0.005 + factor[m] + 0.01*r.NormFloat64()
+			}
+			// interleave the groups alphabetically so the order has to come from the clustering
+			returns[fmt.Sprintf("%c%d", 'A'+k, g)] = series
+		}
+	}
+	return returns
+}
+
+func TestHRP(t *testing.T) {
+	const groups, perGroup = 3, 4
+	returns := clusteredReturns(groups, perGroup, 120)
+
+	cfg := analysis.OptimizerConfig{Mode: analysis.ModeHRP, MaxWeight: 1}
+	_, hrp, err := analysis.Optimize(context.Background(), returns, cfg)
+	if err != nil {
+		t.Fatalf("Optimize(hrp): %v", err)
+	}
+	checkWeights(t, hrp, 0, 1)
+
+	tree := hrp.Clusters
+	if tree == nil {
+		t.Fatal("no dendrogram")
+	}
+	n := groups * perGroup
+	if len(tree.Merges) != n-1 || tree.Merges[n-2].Size != n || len(tree.Order) != n {
+		t.Fatalf("dendrogram has %d merges and %d leaves, want %d and %d", len(tree.Merges), len(tree.Order), n-1, n)
+	}
+	for k, m := range tree.Merges {
+		if m.Left >= n+k || m.Right >= n+k || (k > 0 && m.Distance < tree.Merges[k-1].Distance) {
+			t.Fatalf("merge %d %+v is out of order", k, m)
+		}
+	}
+	// every group's tickers end up next to each other
+	for i := 0; i < n; i += perGroup {
+		group := tree.Order[i][1:]
+		for _, ticker := range tree.Order[i : i+perGroup] {
+			if !strings.HasSuffix(ticker, group) {
+				t.Fatalf("order %v splits the groups", tree.Order)
+			}
+		}
+	}
+
+	// The first bisection splits the order in inverse proportion to the
+	// variance of each half's inverse-variance portfolio.
+	in := analysis.NewUniverse(returns)
+	ivpVariance := func(tickers []string) float64 {
+		total, v := 0.0, 0.0
+		for _, a := range tickers {
+			i, _ := in.Index(a)
+			total += 1 / in.Cov.At(i, i)
+			for _, b := range tickers {
+				j, _ := in.Index(b)
+				v += in.Cov.At(i, j) / (in.Cov.At(i, i) * in.Cov.At(j, j))
+			}
+		}
+		return v / (total * total)
+	}
+	vl, vr := ivpVariance(tree.Order[:n/2]), ivpVariance(tree.Order[n/2:])
+	leftWeight := 0.0
+	for _, ticker := range tree.Order[:n/2] {
+		leftWeight += hrp.Weights[ticker]
+	}
+	if want := vr / (vl + vr); math.Abs(leftWeight-want) > 1e-12 {
+		t.Errorf("left half holds %v, want %v", leftWeight, want)
+	}
+
+	// The weight bounds still hold.
+	capped, err := analysis.OptimizeHRP(returns, 0, analysis.Constraints{MinWeight: 0.05, MaxWeight: 0.10})
+	if err != nil {
+		t.Fatalf("OptimizeHRP with bounds: %v", err)
+	}
+	checkWeights(t, capped, 0.05, 0.10)
+}
+
+func TestHRPSectorLimits(t *testing.T) {
+	returns := clusteredReturns(3, 4, 120)
+	sectors := make(map[string]string, len(returns))
+	for ticker := range returns {
+		sectors[ticker] = "group " + ticker[1:]
+	}
+	free, err := analysis.OptimizeHRP(returns, 0, analysis.Constraints{MaxWeight: 1})
+	if err != nil {
+		t.Fatalf("OptimizeHRP: %v", err)
+	}
+	group0 := analysis.SectorBreakdown(free.Weights, sectors)["group 0"]
+
+	// A limit that does not bind leaves the splits alone.
+	loose := analysis.Constraints{MaxWeight: 1, Sectors: sectors, SectorLimits: []analysis.SectorLimit{{Sector: "group 0", Max: group0 + 0.05}}}
+	p, err := analysis.OptimizeHRP(returns, 0, loose)
+	if err != nil {
+		t.Fatalf("OptimizeHRP with a loose limit: %v", err)
+	}
+	for ticker, w := range free.Weights {
+		if math.Abs(p.Weights[ticker]-w) > 1e-9 {
+			t.Errorf("%s weight %.6f, want the unconstrained %.6f", ticker, p.Weights[ticker], w)
+		}
+	}
+
+	// Limits that bind are met, including a floor on a sector the splits underweight.
+	limits := []analysis.SectorLimit{{Sector: "group 0", Max: group0 / 2}, {Sector: "group 1", Min: 0.5, Max: 0.6}}
+	p, err = analysis.OptimizeHRP(returns, 0, analysis.Constraints{MaxWeight: 0.2, Sectors: sectors, SectorLimits: limits})
+	if err != nil {
+		t.Fatalf("OptimizeHRP with binding limits: %v", err)
+	}
+	checkWeights(t, p, 0, 0.2)
+	breakdown := analysis.SectorBreakdown(p.Weights, sectors)
+	if breakdown["group 0"] > group0/2+1e-6 {
+		t.Errorf("group 0 holds %.6f, above its cap %.6f", breakdown["group 0"], group0/2)
+	}
+	if g1 := breakdown["group 1"]; g1 < 0.5-1e-6 || g1 > 0.6+1e-6 {
+		t.Errorf("group 1 holds %.6f, outside [0.5, 0.6]", g1)
+	}
+	if p.Clusters == nil || len(p.Clusters.Order) != len(returns) {
+		t.Errorf("missing dendrogram for the limited portfolio")
+	}
+}
@@ -0,0 +1,305 @@
+package analysis
+
+import (
+	"errors"
+	"fmt"
+	"math"
+
+	"gonum.org/v1/gonum/floats"
+	"gonum.org/v1/gonum/mat"
+)
+
+// Exact mean-variance optimization. Where OptimizePortfolio samples random
+// weight vectors, these solve the underlying quadratic programs directly and
+// always return the same portfolio for the same inputs.
+
+var (
+	ErrNoExcessReturn   = errors.New("no feasible portfolio earns more than the risk-free rate")
+	ErrInfeasibleTarget = errors.New("target is outside the attainable frontier")
+)
+
+// OptimizeMinVariance returns the global minimum-variance portfolio within
+// the constraints. riskFreeRate is only used to report the Sharpe ratio.
+func OptimizeMinVariance(returns map[string][]float64, riskFreeRate float64, constraints Constraints) (Portfolio, error) {
+	return optimizeMinVariance(NewUniverse(returns), riskFreeRate, constraints)
+}
+
+func optimizeMinVariance(in *Universe, riskFreeRate float64, constraints Constraints) (Portfolio, error) {
+	cons, err := constraints.prepare(in.Tickers)
+	if err != nil {
+		return Portfolio{}, err
+	}
+	w, err := minVarianceWeights(in, cons)
+	if err != nil {
+		return Portfolio{}, err
+	}
+	return in.portfolio(w, riskFreeRate), nil
+}
+
+// OptimizeMaxSharpe returns the tangency portfolio within the constraints.
+func OptimizeMaxSharpe(returns map[string][]float64, riskFreeRate float64, constraints Constraints) (Portfolio, error) {
+	return optimizeMaxSharpe(NewUniverse(returns), riskFreeRate, constraints)
+}
+
+func optimizeMaxSharpe(in *Universe, riskFreeRate float64, constraints Constraints) (Portfolio, error) {
+	cons, err := constraints.prepare(in.Tickers)
+	if err != nil {
+		return Portfolio{}, err
+	}
+	w, err := maxSharpeWeights(in, riskFreeRate, cons)
+	if err != nil {
+		return Portfolio{}, err
+	}
+	return in.portfolio(w, riskFreeRate), nil
+}
+
+// OptimizeTargetReturn returns the least risky portfolio whose expected return
+// is at least targetReturn. Targets above the maximum attainable return fail
+// with ErrInfeasibleTarget; targets below the minimum-variance return simply
+// get the minimum-variance portfolio.
+func OptimizeTargetReturn(returns map[string][]float64, riskFreeRate float64, constraints Constraints, targetReturn float64) (Portfolio, error) {
+	return optimizeTargetReturn(NewUniverse(returns), riskFreeRate, constraints, targetReturn)
+}
+
+func optimizeTargetReturn(in *Universe, riskFreeRate float64, constraints Constraints, targetReturn float64) (Portfolio, error) {
+	cons, err := constraints.prepare(in.Tickers)
+	if err != nil {
+		return Portfolio{}, err
+	}
+	w, err := targetReturnFrontierWeights(in, cons, targetReturn)
+	if err != nil {
+		return Portfolio{}, err
+	}
+	return in.portfolio(w, riskFreeRate), nil
+}
+
+// OptimizeTargetRisk returns the highest-return portfolio whose volatility does
+// not exceed targetRisk. Caps below the minimum-variance risk fail with
+// ErrInfeasibleTarget.
+func OptimizeTargetRisk(returns map[string][]float64, riskFreeRate float64, constraints Constraints, targetRisk float64) (Portfolio, error) {
+	return optimizeTargetRisk(NewUniverse(returns), riskFreeRate, constraints, targetRisk)
+}
+
+func optimizeTargetRisk(in *Universe, riskFreeRate float64, constraints Constraints, targetRisk float64) (Portfolio, error) {
+	cons, err := constraints.prepare(in.Tickers)
+	if err != nil {
+		return Portfolio{}, err
+	}
+	w, err := targetRiskWeights(in, cons, targetRisk)
+	if err != nil {
+		return Portfolio{}, err
+	}
+	return in.portfolio(w, riskFreeRate), nil
+}
+
+// minVarianceWeights solves min wᵀΣw over the constraint set.
+func minVarianceWeights(in *Universe, cons Constraints) ([]float64, error) {
+	A, l, u := cons.linearRows(in.Tickers)
+	w, err := solveQP(qpProblem{
+		P: in.Cov,
+		q: make([]float64, len(in.Tickers)),
+		A: A,
+		l: l,
+		u: u,
+	}, defaultQPSettings)
+	if err != nil {
+		return nil, fmt.Errorf("minimum variance: %w", err)
+	}
+	return clampWeights(w, cons), nil
+}
+
+// maxSharpeWeights uses the Cornuejols-Tütüncü change of variables
+// y = w/κ, κ = 1/((μ-rf)ᵀw), which turns the Sharpe ratio into the convex QP
+//
+//	minimize yᵀΣy  s.t.  (μ-rf)ᵀy = 1,  l·κ <= A·y <= u·κ,  κ >= 0
+//
+// and recovers w = y/κ.
+func maxSharpeWeights(in *Universe, riskFreeRate float64, cons Constraints) ([]float64, error) {
+	n := len(in.Tickers)
+	excess := make([]float64, n)
+	for i, m := range in.mu() {
+		excess[i] = m - riskFreeRate
+	}
+
+	A, l, u := cons.linearRows(in.Tickers)
+
+	// Only attempt the tangency portfolio if some feasible mix beats the risk-free rate.
+	neg := make([]float64, n)
+	for i, e := range excess {
+		neg[i] = -e
+	}
+	best, err := solveLP(neg, A, l, u)
+	if err != nil {
+		return nil, fmt.Errorf("maximum sharpe: %w", err)
+	}
+	if floats.Dot(excess, best) <= 0 {
+		return nil, ErrNoExcessReturn
+	}
+
+	hA, hl, hu := homogenize(A, l, u)
+	m, _ := hA.Dims()
+	rows := mat.NewDense(m+2, n+1, nil)
+	rows.Slice(0, m, 0, n+1).(*mat.Dense).Copy(hA)
+	lo := append(hl, 1, 0)
+	hi := append(hu, 1, math.Inf(1))
+	for i, e := range excess {
+		rows.Set(m, i, e)
+	}
+	rows.Set(m+1, n, 1)
+
+	P := mat.NewSymDense(n+1, nil)
+	for i := range n {
+		for j := i; j < n; j++ {
+			P.SetSym(i, j, in.Cov.At(i, j))
+		}
+	}
+
+	y, err := solveQP(qpProblem{P: P, q: make([]float64, n+1), A: rows, l: lo, u: hi}, defaultQPSettings)
+	if err != nil {
+		return nil, fmt.Errorf("maximum sharpe: %w", err)
+	}
+	kappa := y[n]
+	if kappa <= 0 {
+		return nil, fmt.Errorf("maximum sharpe: degenerate solution (kappa=%g)", kappa)
+	}
+	w := make([]float64, n)
+	for i := range n {
+		w[i] = y[i] / kappa
+	}
+	return clampWeights(w, cons), nil
+}
+
+// homogenize rewrites each row l <= aᵀw <= u as aᵀy - l·κ >= 0 and
+// aᵀy - u·κ <= 0 over the extended variable (y, κ). Equality rows stay a single row.
+func homogenize(A *mat.Dense, l, u []float64) (*mat.Dense, []float64, []float64) {
+	m, n := A.Dims()
+	var data, lo, hi []float64
+	addRow := func(r int, k, rl, ru float64) {
+		data = append(data, mat.Row(nil, r, A)...)
+		data = append(data, -k)
+		lo = append(lo, rl)
+		hi = append(hi, ru)
+	}
+	for r := range m {
+		switch {
+		case l[r] == u[r]:
+			addRow(r, u[r], 0, 0)
+		default:
+			if !math.IsInf(l[r], -1) {
+				addRow(r, l[r], 0, math.Inf(1))
+			}
+			if !math.IsInf(u[r], 1) {
+				addRow(r, u[r], math.Inf(-1), 0)
+			}
+		}
+	}
+	return mat.NewDense(len(lo), n+1, data), lo, hi
+}
+
+// clampWeights removes solver noise at the bounds (~1e-9) so the reported
+// weights satisfy the constraints exactly.
+func clampWeights(w []float64, cons Constraints) []float64 {
+	for i, v := range w {
+		w[i] = math.Min(math.Max(v, cons.MinWeight), cons.MaxWeight)
+	}
+	return w
+}
+
+// maxReturnWeights solves the linear program max μᵀw over the constraint set.
+func maxReturnWeights(in *Universe, cons Constraints) ([]float64, error) {
+	A, l, u := cons.linearRows(in.Tickers)
+	neg := make([]float64, len(in.mu()))
+	for i, m := range in.mu() {
+		neg[i] = -m
+	}
+	w, err := solveLP(neg, A, l, u)
+	if err != nil {
+		return nil, fmt.Errorf("maximum return: %w", err)
+	}
+	return clampWeights(w, cons), nil
+}
+
+// targetReturnWeights solves min wᵀΣw subject to μᵀw = target over the constraint set.
+func targetReturnWeights(in *Universe, cons Constraints, target float64) ([]float64, error) {
+	n := len(in.Tickers)
+	A, l, u := cons.linearRows(in.Tickers)
+	m, _ := A.Dims()
+	rows := mat.NewDense(m+1, n, nil)
+	rows.Slice(0, m, 0, n).(*mat.Dense).Copy(A)
+	rows.SetRow(m, in.mu())
+
+	w, err := solveQP(qpProblem{
+		P: in.Cov,
+		q: make([]float64, n),
+		A: rows,
+		l: append(l, target),
+		u: append(u, target),
+	}, defaultQPSettings)
+	if err != nil {
+		return nil, fmt.Errorf("target return %.6f: %w", target, err)
+	}
+	return clampWeights(w, cons), nil
+}
+
+// targetReturnFrontierWeights handles the ends of the frontier before solving
+// the equality-constrained QP in between.
+func targetReturnFrontierWeights(in *Universe, cons Constraints, target float64) ([]float64, error) {
+	maxRet, err := maxReturnWeights(in, cons)
+	if err != nil {
+		return nil, err
+	}
+	highest := floats.Dot(in.mu(), maxRet)
+	if target > highest+1e-12 {
+		return nil, fmt.Errorf("%w: target return %.6f exceeds the maximum attainable %.6f", ErrInfeasibleTarget, target, highest)
+	}
+
+	minVar, err := minVarianceWeights(in, cons)
+	if err != nil {
+		return nil, err
+	}
+	if target <= floats.Dot(in.mu(), minVar) {
+		return minVar, nil
+	}
+	if target >= highest-1e-12 {
+		return maxRet, nil
+	}
+	return targetReturnWeights(in, cons, target)
+}
+
+// targetRiskWeights bisects on the target return: along the efficient frontier
+// risk increases with return, so the answer is the largest return whose
+// minimum-variance portfolio still fits under the cap.
+func targetRiskWeights(in *Universe, cons Constraints, targetRisk float64) ([]float64, error) {
+	minVar, err := minVarianceWeights(in, cons)
+	if err != nil {
+		return nil, err
+	}
+	lowest := in.portfolio(minVar, 0)
+	if targetRisk < lowest.Risk-1e-9 {
+		return nil, fmt.Errorf("%w: target risk %.6f is below the minimum attainable %.6f", ErrInfeasibleTarget, targetRisk, lowest.Risk)
+	}
+
+	maxRet, err := maxReturnWeights(in, cons)
+	if err != nil {
+		return nil, err
+	}
+	if in.portfolio(maxRet, 0).Risk <= targetRisk {
+		return maxRet, nil
+	}
+
+	lo, hi := lowest.Return, floats.Dot(in.mu(), maxRet)
+	best := minVar
+	for iter := 0; iter < 40 && hi-lo > 1e-9*math.Max(1, math.Abs(hi)); iter++ {
+		mid := 0.5 * (lo + hi)
+		w, err := targetReturnWeights(in, cons, mid)
+		if err != nil {
+			return nil, err
+		}
+		if in.portfolio(w, 0).Risk <= targetRisk {
+			lo, best = mid, w
+		} else {
+			hi = mid
+		}
+	}
+	return best, nil
+}
@@ -0,0 +1,146 @@
+package analysis_test
+
+import (
+	"errors"
+	"math"
+	"testing"
+
+	"github.com/AndrewBrickweg/Finet_v2/cmd/finet/analysis"
+)
+
+func checkWeights(t *testing.T, p analysis.Portfolio, minWeight, maxWeight float64) {
+	t.Helper()
+	sum := 0.0
+	for ticker, w := range p.Weights {
+		if w < minWeight-1e-9 || w > maxWeight+1e-9 {
+			t.Errorf("%s weight %.6f outside [%.2f, %.2f]", ticker, w, minWeight, maxWeight)
+		}
+		sum += w
+	}
+	if math.Abs(sum-1) > 1e-6 {
+		t.Errorf("weights sum to %.8f, want 1", sum)
+	}
+}
+
+func TestQPMatchesMonteCarlo(t *testing.T) {
+	returns := analysis.MonthlyStockReturns(analysis.ExtractMonthlyAdjClosePrices(MockStockData()))
+	const rf, minW, maxW = 0.0, 0.02, 0.20
+	cons := analysis.Constraints{MinWeight: minW, MaxWeight: maxW}
+
+	portfolios, best := analysis.OptimizePortfolio(returns, 5000, rf, minW, maxW, 42)
+
+	maxSharpe, err := analysis.OptimizeMaxSharpe(returns, rf, cons)
+	if err != nil {
+		t.Fatalf("OptimizeMaxSharpe: %v", err)
+	}
+	checkWeights(t, maxSharpe, minW, maxW)
+	if maxSharpe.Sharpe < best.Sharpe-1e-6 {
+		t.Errorf("QP Sharpe %.6f below Monte Carlo best %.6f", maxSharpe.Sharpe, best.Sharpe)
+	}
+
+	minVar, err := analysis.OptimizeMinVariance(returns, rf, cons)
+	if err != nil {
+		t.Fatalf("OptimizeMinVariance: %v", err)
+	}
+	checkWeights(t, minVar, minW, maxW)
+	for _, p := range portfolios {
+		if minVar.Risk > p.Risk+1e-6 {
+			t.Fatalf("QP min variance risk %.6f above sampled portfolio risk %.6f", minVar.Risk, p.Risk)
+		}
+	}
+
+	// Deterministic: a second solve returns identical weights.
+	again, _ := analysis.OptimizeMaxSharpe(returns, rf, cons)
+	for ticker, w := range maxSharpe.Weights {
+		if again.Weights[ticker] != w {
+			t.Fatalf("%s weight changed between runs: %v vs %v", ticker, w, again.Weights[ticker])
+		}
+	}
+}
+
+func TestMaxSharpeNoExcessReturn(t *testing.T) {
+	returns := analysis.MonthlyStockReturns(analysis.ExtractMonthlyAdjClosePrices(MockStockData()))
+	if _, err := analysis.OptimizeMaxSharpe(returns, 1.0, analysis.Constraints{MaxWeight: 0.20}); err != analysis.ErrNoExcessReturn {
+		t.Fatalf("got %v, want ErrNoExcessReturn", err)
+	}
+}
+
+func TestEfficientFrontier(t *testing.T) {
+	returns := analysis.MonthlyStockReturns(analysis.ExtractMonthlyAdjClosePrices(MockStockData()))
+	const rf, minW, maxW = 0.0, 0.02, 0.20
+	cons := analysis.Constraints{MinWeight: minW, MaxWeight: maxW}
+
+	points, err := analysis.EfficientFrontier(returns, 12, rf, cons)
+	if err != nil {
+		t.Fatalf("EfficientFrontier: %v", err)
+	}
+	if len(points) != 12 {
+		t.Fatalf("got %d points, want 12", len(points))
+	}
+
+	minVar, _ := analysis.OptimizeMinVariance(returns, rf, cons)
+	if math.Abs(points[0].Risk-minVar.Risk) > 1e-6 {
+		t.Errorf("first point risk %.6f, want min variance %.6f", points[0].Risk, minVar.Risk)
+	}
+	for i, p := range points {
+		checkWeights(t, p, minW, maxW)
+		if i > 0 && p.Return < points[i-1].Return {
+			t.Errorf("point %d return %.6f below previous %.6f", i, p.Return, points[i-1].Return)
+		}
+		if i > 0 && p.Risk < points[i-1].Risk-1e-6 {
+			t.Errorf("point %d risk %.6f below previous %.6f", i, p.Risk, points[i-1].Risk)
+		}
+	}
+
+	// No sampled portfolio may beat the frontier's maximum return.
+	portfolios, _ := analysis.OptimizePortfolio(returns, 2000, rf, minW, maxW, 7)
+	top := points[len(points)-1]
+	for _, p := range portfolios {
+		if p.Return > top.Return+1e-9 {
+			t.Fatalf("sampled return %.6f above max return point %.6f", p.Return, top.Return)
+		}
+	}
+
+	cloud := analysis.DownsamplePortfolios(portfolios, 100)
+	if len(cloud) == 0 || len(cloud) > 100 {
+		t.Errorf("cloud has %d points, want 1..100", len(cloud))
+	}
+}
+
+func TestTargetReturnAndRisk(t *testing.T) {
+	returns := analysis.MonthlyStockReturns(analysis.ExtractMonthlyAdjClosePrices(MockStockData()))
+	const rf, minW, maxW = 0.0, 0.02, 0.20
+	cons := analysis.Constraints{MinWeight: minW, MaxWeight: maxW}
+
+	points, err := analysis.EfficientFrontier(returns, 5, rf, cons)
+	if err != nil {
+		t.Fatalf("EfficientFrontier: %v", err)
+	}
+	mid := points[2]
+
+	byReturn, err := analysis.OptimizeTargetReturn(returns, rf, cons, mid.Return)
+	if err != nil {
+		t.Fatalf("OptimizeTargetReturn: %v", err)
+	}
+	checkWeights(t, byReturn, minW, maxW)
+	if byReturn.Return < mid.Return-1e-6 || math.Abs(byReturn.Risk-mid.Risk) > 1e-6 {
+		t.Errorf("target return portfolio %+v, want frontier point %+v", byReturn, mid)
+	}
+
+	byRisk, err := analysis.OptimizeTargetRisk(returns, rf, cons, mid.Risk)
+	if err != nil {
+		t.Fatalf("OptimizeTargetRisk: %v", err)
+	}
+	checkWeights(t, byRisk, minW, maxW)
+	if byRisk.Risk > mid.Risk+1e-6 || byRisk.Return < mid.Return-1e-6 {
+		t.Errorf("target risk portfolio %+v, want at least frontier point %+v", byRisk, mid)
+	}
+
+	top := points[len(points)-1]
+	if _, err := analysis.OptimizeTargetReturn(returns, rf, cons, top.Return+0.01); !errors.Is(err, analysis.ErrInfeasibleTarget) {
+		t.Errorf("unreachable return: got %v, want ErrInfeasibleTarget", err)
+	}
+	if _, err := analysis.OptimizeTargetRisk(returns, rf, cons, points[0].Risk/2); !errors.Is(err, analysis.ErrInfeasibleTarget) {
+		t.Errorf("unreachable risk: got %v, want ErrInfeasibleTarget", err)
+	}
+}
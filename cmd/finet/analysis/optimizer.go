@@ -1,34 +1,223 @@
 package analysis
 
-//monte carlo portfolio optimization for now, implement QP solver later
+//monte carlo portfolio optimization, see mean_variance.go for the exact QP solver
 import (
+	"context"
 	"errors"
 	"fmt"
 	"math"
 	"math/rand"
+	"runtime"
+	"strings"
+	"sync"
 	"time"
+
+	"gonum.org/v1/gonum/floats"
+	"gonum.org/v1/gonum/mat"
 )
 
 type Portfolio struct {
 	Weights map[string]float64
-	Return  float64
+	Return  float64 // per period of Frequency
 	Risk    float64
 	Sharpe  float64
+
+	Frequency    Frequency
+	AnnualReturn float64
+	AnnualRisk   float64
+	AnnualSharpe float64
+
+	Clusters          *Dendrogram        `json:",omitempty"` // ModeHRP only
+	RiskContributions *RiskContributions `json:",omitempty"` // set on the orchestrators' pick
+}
+
+// newPortfolio packages a weight map and its periodic figures, adding the
+// annualized ones for frequency f.
+func newPortfolio(weights map[string]float64, p RiskReturnPoint, f Frequency) Portfolio {
+	f = f.orMonthly()
+	annualReturn, annualRisk, annualSharpe := f.Annualize(p.Return, p.Risk, p.Sharpe)
+	return Portfolio{
+		Weights:      weights,
+		Return:       p.Return,
+		Risk:         p.Risk,
+		Sharpe:       p.Sharpe,
+		Frequency:    f,
+		AnnualReturn: annualReturn,
+		AnnualRisk:   annualRisk,
+		AnnualSharpe: annualSharpe,
+	}
+}
+
+// OptimizerMode selects how OrchestratePortfolio picks the best portfolio.
+type OptimizerMode string
+
+const (
+	ModeMonteCarlo   OptimizerMode = "monte_carlo"   // best Sharpe among random weight vectors
+	ModeMaxSharpe    OptimizerMode = "max_sharpe"    // exact tangency portfolio via QP
+	ModeMinVariance  OptimizerMode = "min_variance"  // exact minimum-variance portfolio via QP
+	ModeTargetReturn OptimizerMode = "target_return" // least variance reaching TargetReturn
+	ModeTargetRisk   OptimizerMode = "target_risk"   // most return with volatility <= TargetRisk
+	ModeRiskParity   OptimizerMode = "risk_parity"   // equal risk contribution from every holding
+	ModeRiskBudget   OptimizerMode = "risk_budget"   // risk contributions in the proportions of RiskBudgets
+	ModeHRP          OptimizerMode = "hrp"           // hierarchical risk parity over correlation clusters
+	ModeMinCVaR      OptimizerMode = "min_cvar"      // lowest historical expected shortfall at CVaRConfidence
+)
+
+// ParseOptimizerMode maps a request value onto a mode. Empty selects Monte Carlo.
+func ParseOptimizerMode(s string) (OptimizerMode, error) {
+	switch mode := OptimizerMode(strings.ToLower(strings.TrimSpace(s))); mode {
+	case "":
+		return ModeMonteCarlo, nil
+	case ModeMonteCarlo, ModeMaxSharpe, ModeMinVariance, ModeTargetReturn, ModeTargetRisk, ModeRiskParity, ModeRiskBudget, ModeHRP, ModeMinCVaR:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("unknown optimizer mode %q", s)
+	}
+}
+
+// OptimizerConfig collects the settings for a single optimizer run.
+// Returns, risks and the risk-free rate share the frequency of the return
+// series, Estimators.Frequency; use Frequency.PeriodicRate to convert annual rates.
+type OptimizerConfig struct {
+	Mode          OptimizerMode
+	NumPortfolios int // Monte Carlo only
+	RiskFreeRate  float64
+	MinWeight     float64
+	MaxWeight     float64
+	TargetReturn  float64            // ModeTargetReturn only
+	TargetRisk    float64            // ModeTargetRisk only
+	RiskBudgets   map[string]float64 // ModeRiskBudget only; ticker -> share of total risk
+	CVaRLevel     float64            // ModeMinCVaR only; confidence level, 0 uses DefaultCVaRConfidence
+	Seed          int64              // Monte Carlo only; identical seeds give identical results, 0 picks one
+	Workers       int                // Monte Carlo goroutines, 0 uses GOMAXPROCS; does not change results
+	Estimators    Estimators
+	GapPolicy     GapPolicy       // how the orchestrators align months across tickers; zero drops gaps
+	Benchmark     *Benchmark      // the orchestrators align it, fill Estimators.Benchmark and compare the pick with it
+	Views         *BlackLitterman // replaces the estimated mean and covariance with the Black-Litterman posterior
+
+	Sectors      map[string]string // ticker -> sector, used for limits and the sector breakdown
+	SectorLimits []SectorLimit
 }
 
-func newRand() *rand.Rand {
-	// Seed with current time for randomness
-	seed := time.Now().UnixNano()
+func (cfg OptimizerConfig) constraints() Constraints {
+	return Constraints{
+		MinWeight:    cfg.MinWeight,
+		MaxWeight:    cfg.MaxWeight,
+		Sectors:      cfg.Sectors,
+		SectorLimits: cfg.SectorLimits,
+	}
+}
+
+// Optimize runs the optimizer selected by cfg.Mode. The simulated portfolios
+// are only returned by the Monte Carlo mode, which also stops when ctx is done.
+func Optimize(ctx context.Context, returns map[string][]float64, cfg OptimizerConfig) ([]Portfolio, Portfolio, error) {
+	in, _, err := cfg.universe(returns)
+	if err != nil {
+		return nil, Portfolio{}, err
+	}
+	if cfg.Mode == ModeMonteCarlo || cfg.Mode == "" {
+		run, err := monteCarlo(ctx, in, cfg)
+		if err != nil {
+			return nil, Portfolio{}, err
+		}
+		return run.portfolios(), run.bestPortfolio(), nil
+	}
+	best, err := optimizeBest(ctx, in, returns, cfg)
+	return nil, best, err
+}
+
+// universe builds the optimizer inputs for returns. With Views set the
+// estimated covariance only serves as the Black-Litterman prior, and the
+// posterior, also returned, takes the place of the mean and covariance.
+func (cfg OptimizerConfig) universe(returns map[string][]float64) (*Universe, *BlackLittermanResult, error) {
+	in, err := NewUniverseWith(returns, cfg.Estimators)
+	if err != nil || cfg.Views == nil {
+		return in, nil, err
+	}
+	bl, err := BlackLittermanPosterior(in, *cfg.Views, cfg.RiskFreeRate)
+	if err != nil {
+		return nil, nil, err
+	}
+	return in.withMoments(bl.Mean, bl.Cov), bl, nil
+}
+
+// optimizeBest is Optimize without building a weight map for every simulated
+// portfolio. in must be built from returns.
+func optimizeBest(ctx context.Context, in *Universe, returns map[string][]float64, cfg OptimizerConfig) (Portfolio, error) {
+	var best Portfolio
+	var err error
+	cons := cfg.constraints()
+	switch cfg.Mode {
+	case ModeMaxSharpe:
+		best, err = optimizeMaxSharpe(in, cfg.RiskFreeRate, cons)
+	case ModeMinVariance:
+		best, err = optimizeMinVariance(in, cfg.RiskFreeRate, cons)
+	case ModeTargetReturn:
+		best, err = optimizeTargetReturn(in, cfg.RiskFreeRate, cons, cfg.TargetReturn)
+	case ModeTargetRisk:
+		best, err = optimizeTargetRisk(in, cfg.RiskFreeRate, cons, cfg.TargetRisk)
+	case ModeRiskParity:
+		best, err = optimizeRiskBudget(in, cfg.RiskFreeRate, cons, nil)
+	case ModeRiskBudget:
+		if cfg.RiskBudgets == nil {
+			return Portfolio{}, fmt.Errorf("%s optimization failed: %w", cfg.Mode, ErrInvalidRiskBudget)
+		}
+		best, err = optimizeRiskBudget(in, cfg.RiskFreeRate, cons, cfg.RiskBudgets)
+	case ModeHRP:
+		best, err = optimizeHRP(in, CorrelationMatrixSample(returns), cfg.RiskFreeRate, cons)
+	case ModeMinCVaR:
+		best, err = optimizeMinCVaR(in, returns, cfg.RiskFreeRate, cons, cfg.CVaRLevel)
+	case ModeMonteCarlo, "":
+		run, err := monteCarlo(ctx, in, cfg)
+		if err != nil {
+			return Portfolio{}, err
+		}
+		return run.bestPortfolio(), nil
+	default:
+		return Portfolio{}, fmt.Errorf("unknown optimizer mode %q", cfg.Mode)
+	}
+	if err != nil {
+		return Portfolio{}, fmt.Errorf("%s optimization failed: %w", cfg.Mode, err)
+	}
+	return best, nil
+}
+
+// monteCarlo checks the sector limits are satisfiable and runs the simulation for cfg.
+func monteCarlo(ctx context.Context, in *Universe, cfg OptimizerConfig) (monteCarloRun, error) {
+	cons := cfg.constraints()
+	if len(cons.SectorLimits) > 0 {
+		if _, err := cons.prepare(in.Tickers); err != nil {
+			return monteCarloRun{}, fmt.Errorf("%s optimization failed: %w", ModeMonteCarlo, err)
+		}
+	}
+	run, err := optimizeMonteCarlo(ctx, in, cfg.NumPortfolios, cfg.RiskFreeRate, cons, cfg.Seed, cfg.Workers)
+	if err != nil {
+		return monteCarloRun{}, fmt.Errorf("%s optimization stopped: %w", ModeMonteCarlo, err)
+	}
+	if len(run.points) == 0 {
+		return monteCarloRun{}, fmt.Errorf("no portfolios generated")
+	}
+	return run, nil
+}
+
+// NewSeed picks a seed for callers that did not supply one. It stays below
+// 2^53 so the value survives a round trip through JSON in the browser.
+func NewSeed() int64 {
+	return rand.New(rand.NewSource(time.Now().UnixNano())).Int63n(1<<53-1) + 1
+}
+
+// newRand returns a generator for seed; a zero seed picks one from the clock.
+func newRand(seed int64) *rand.Rand {
+	if seed == 0 {
+		seed = NewSeed()
+	}
 	src := rand.NewSource(seed)
 	return rand.New(src)
 }
 
-//still need to add sector constraints, tag stocks by sector first, sum weights by sector <= sector max
-
-// generateWeightConstraints returns weights that satisfy minWeight <= w[i] <= maxWeight and sum(w)=1.
+// generateWeightConstraints returns n weights that satisfy minWeight <= w[i] <= maxWeight and sum(w)=1.
 // It is robust: starts with mins, splits remaining using random exponential draws, then caps+redistributes surplus.
-func generateWeightConstraints(tickers []string, minWeight, maxWeight float64, randGen *rand.Rand, maxAttempts int) (map[string]float64, error) {
-	n := len(tickers)
+func generateWeightConstraints(n int, minWeight, maxWeight float64, randGen *rand.Rand, maxAttempts int) ([]float64, error) {
 	if n == 0 {
 		return nil, errors.New("no tickers provided")
 	}
@@ -43,10 +232,10 @@ func generateWeightConstraints(tickers []string, minWeight, maxWeight float64, r
 	// Try attempts
 	for attempt := 0; attempt < maxAttempts; attempt++ {
 		// Start with minimum weights
-		weights := make(map[string]float64, n)
+		weights := make([]float64, n)
 		sumMin := 0.0
-		for _, t := range tickers {
-			weights[t] = minWeight
+		for i := range weights {
+			weights[i] = minWeight
 			sumMin += minWeight
 		}
 		remaining := 1.0 - sumMin
@@ -66,18 +255,18 @@ func generateWeightConstraints(tickers []string, minWeight, maxWeight float64, r
 			props[i] = v
 			sumProps += v
 		}
-		for i, t := range tickers {
-			weights[t] += remaining * (props[i] / sumProps)
+		for i := range weights {
+			weights[i] += remaining * (props[i] / sumProps)
 		}
 
 		// Iteratively cap at max and redistribute surplus
 		for iter := 0; iter < 20; iter++ {
 			surplus := 0.0
 			// find any over-cap and cap it
-			for _, t := range tickers {
-				if weights[t] > maxWeight {
-					surplus += weights[t] - maxWeight
-					weights[t] = maxWeight
+			for i, w := range weights {
+				if w > maxWeight {
+					surplus += w - maxWeight
+					weights[i] = maxWeight
 				}
 			}
 			if surplus <= 1e-12 {
@@ -85,9 +274,9 @@ func generateWeightConstraints(tickers []string, minWeight, maxWeight float64, r
 			}
 			// compute total room available under maxWeight
 			room := 0.0
-			for _, t := range tickers {
-				if weights[t] < maxWeight-1e-12 {
-					room += maxWeight - weights[t]
+			for _, w := range weights {
+				if w < maxWeight-1e-12 {
+					room += maxWeight - w
 				}
 			}
 			if room <= 1e-12 {
@@ -95,30 +284,25 @@ func generateWeightConstraints(tickers []string, minWeight, maxWeight float64, r
 				break
 			}
 			// distribute surplus proportionally to available room
-			for _, t := range tickers {
-				if weights[t] < maxWeight-1e-12 {
-					available := maxWeight - weights[t]
-					weights[t] += surplus * (available / room)
+			for i, w := range weights {
+				if w < maxWeight-1e-12 {
+					available := maxWeight - w
+					weights[i] += surplus * (available / room)
 				}
 			}
 		}
 
 		// Final normalization to correct tiny numeric error
-		sumW := 0.0
-		for _, t := range tickers {
-			sumW += weights[t]
-		}
+		sumW := floats.Sum(weights)
 		if sumW == 0 {
 			continue
 		}
-		for _, t := range tickers {
-			weights[t] = weights[t] / sumW
-		}
+		floats.Scale(1/sumW, weights)
 
 		// Validate constraints
 		valid := true
-		for _, t := range tickers {
-			if weights[t] < minWeight-1e-9 || weights[t] > maxWeight+1e-9 {
+		for _, w := range weights {
+			if w < minWeight-1e-9 || w > maxWeight+1e-9 {
 				valid = false
 				break
 			}
@@ -133,92 +317,163 @@ func generateWeightConstraints(tickers []string, minWeight, maxWeight float64, r
 }
 
 
-// consider goroutine parallelism later.
-func OptimizePortfolio(returns map[string][]float64, numPortfolios int, riskFreeRate float64, minWeight float64, maxWeight float64) ([]Portfolio, Portfolio) {
-	fmt.Println("DEBUG: OptimizePortfolio called")
-    var bestPortfolio Portfolio
-    bestPortfolio.Sharpe = math.Inf(-1)
+// OptimizePortfolio runs the Monte Carlo search without cancellation on all CPUs.
+// The same seed always yields the same portfolios; pass 0 to seed from the clock.
+func OptimizePortfolio(returns map[string][]float64, numPortfolios int, riskFreeRate float64, minWeight float64, maxWeight float64, seed int64) ([]Portfolio, Portfolio) {
+	run, _ := optimizeMonteCarlo(context.Background(), NewUniverse(returns), numPortfolios, riskFreeRate, Constraints{MinWeight: minWeight, MaxWeight: maxWeight}, seed, 0)
+	return run.portfolios(), run.bestPortfolio()
+}
 
-    // Slice to store all generated portfolios
-    portfolios := make([]Portfolio, 0, numPortfolios)
-	randGen := newRand()
+// monteCarloShardSize is the number of portfolios drawn from one RNG stream.
+// Work is split into shards rather than one block per worker so the output
+// for a seed does not depend on how many workers ran it.
+const monteCarloShardSize = 256
 
-    // Precompute expected returns and covariance matrix once
-    expectedReturns := ExpectedReturn(returns)
-    covMatrix := CovarianceMatrixSample(returns)
+// monteCarloRun keeps the simulated portfolios as dense weight vectors in
+// universe order; weight maps are only built for portfolios that are returned.
+type monteCarloRun struct {
+	universe *Universe
+	weights  []*mat.VecDense
+	points   []RiskReturnPoint
+	best     int // index of the highest Sharpe ratio, -1 when nothing was sampled
+}
 
+func (r monteCarloRun) portfolio(i int) Portfolio {
+	return newPortfolio(r.universe.WeightMap(r.weights[i]), r.points[i], r.universe.Frequency)
+}
 
-    tickers := make([]string, 0, len(returns))
-    for t := range returns {
-        tickers = append(tickers, t)
-    }
-	n := len(tickers)
-	if n == 0 {
-		return portfolios, bestPortfolio
+func (r monteCarloRun) portfolios() []Portfolio {
+	portfolios := make([]Portfolio, len(r.points))
+	for i := range portfolios {
+		portfolios[i] = r.portfolio(i)
 	}
+	return portfolios
+}
 
-	// If basket is small, adjust maxWeight to 1/n if that is lower than the supplied maxWeight.
-	if n < 5 {
-		oneOverN := 1.0 / float64(n)
-		if maxWeight > oneOverN {
-			maxWeight = oneOverN
-		}
+func (r monteCarloRun) bestPortfolio() Portfolio {
+	if r.best < 0 {
+		return Portfolio{Sharpe: math.Inf(-1)}
 	}
+	return r.portfolio(r.best)
+}
 
-	// Safety: if minWeight * n > 1, make minWeight smaller
-	if float64(n)*minWeight > 1.0 {
-		minWeight = 0.0
+// optimizeMonteCarlo samples numPortfolios weight vectors within cons and keeps the best Sharpe.
+// Shards are spread over workers goroutines (0 uses GOMAXPROCS) and merged in
+// shard order, so the result matches a sequential run with the same seed.
+// It stops early with ctx.Err() when ctx is cancelled.
+func optimizeMonteCarlo(ctx context.Context, in *Universe, numPortfolios int, riskFreeRate float64, cons Constraints, seed int64, workers int) (monteCarloRun, error) {
+	run := monteCarloRun{universe: in, best: -1}
+	n := in.Len()
+	if n == 0 || numPortfolios <= 0 {
+		return run, nil
 	}
 
-		for i := 0; i < numPortfolios; i++ {
-		// generate constrained weights
-		weights, err := generateWeightConstraints(tickers, minWeight, maxWeight, randGen, 200)
-		if err != nil {
-			// if generation fails, fallback to equal weights (but in practice this shouldn't happen)
-			eq := 1.0 / float64(n)
-			weights = make(map[string]float64, n)
-			for _, t := range tickers {
-				weights[t] = math.Min(math.Max(eq, minWeight), maxWeight)
-			}
-			// normalize
-			sum := 0.0
-			for _, v := range weights {
-				sum += v
+	cons.MinWeight, cons.MaxWeight = EffectiveWeightBounds(n, cons.MinWeight, cons.MaxWeight)
+	if seed == 0 {
+		seed = NewSeed()
+	}
+
+	numShards := (numPortfolios + monteCarloShardSize - 1) / monteCarloShardSize
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	workers = min(workers, numShards)
+
+	type shardResult struct {
+		weights []*mat.VecDense
+		points  []RiskReturnPoint
+	}
+	shards := make([]shardResult, numShards)
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for shard := range next {
+				size := min(monteCarloShardSize, numPortfolios-shard*monteCarloShardSize)
+				randGen := newRand(shardSeed(seed, shard))
+				out := shardResult{
+					weights: make([]*mat.VecDense, 0, size),
+					points:  make([]RiskReturnPoint, 0, size),
+				}
+				for range size {
+					if ctx.Err() != nil {
+						break
+					}
+					weights, ok := cons.sampleWeights(in, randGen)
+					if !ok {
+						continue
+					}
+					w := mat.NewVecDense(n, weights)
+					out.weights = append(out.weights, w)
+					out.points = append(out.points, in.evaluate(w, riskFreeRate))
+				}
+				shards[shard] = out
 			}
-			for k := range weights {
-				weights[k] = weights[k] / sum
+		}()
+	}
+
+dispatch:
+	for shard := range numShards {
+		select {
+		case next <- shard:
+		case <-ctx.Done():
+			break dispatch
+		}
+	}
+	close(next)
+	wg.Wait()
+	if err := ctx.Err(); err != nil {
+		return monteCarloRun{}, err
+	}
+
+	run.weights = make([]*mat.VecDense, 0, numPortfolios)
+	run.points = make([]RiskReturnPoint, 0, numPortfolios)
+	bestSharpe := math.Inf(-1)
+	for _, out := range shards {
+		for i, p := range out.points {
+			if p.Sharpe > bestSharpe {
+				bestSharpe, run.best = p.Sharpe, len(run.points)
 			}
+			run.weights = append(run.weights, out.weights[i])
+			run.points = append(run.points, p)
 		}
+	}
 
-        // Calculate portfolio return and risk
-        var portReturn, portVariance float64
-        for a, wa := range weights {
-            portReturn += wa * expectedReturns[a]
-            for b, wb := range weights {
-                portVariance += wa * wb * covMatrix[a][b]
-            }
-        }
-        portRisk := math.Sqrt(portVariance)
-
-        // Calculate Sharpe ratio
-        sharpe := 0.0
-        if portRisk != 0 {
-            sharpe = (portReturn - riskFreeRate) / portRisk
-        }
-
-        portfolio := Portfolio{
-            Weights: weights,
-            Return:  portReturn,
-            Risk:    portRisk,
-            Sharpe:  sharpe,
-        }
-
-        portfolios = append(portfolios, portfolio)
-
-        if sharpe > bestPortfolio.Sharpe {
-            bestPortfolio = portfolio
-        }
-    }
-
-    return portfolios, bestPortfolio
+	return run, nil
+}
+
+// shardSeed derives an independent stream for shard from the run's seed
+// using the splitmix64 finalizer, so neighbouring shards are uncorrelated.
+func shardSeed(seed int64, shard int) int64 {
+	z := uint64(seed) + uint64(shard+1)*0x9e3779b97f4a7c15
+	z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+	z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+	z ^= z >> 31
+	return int64(z >> 1)
+}
+
+// sampleWeights draws one weight vector within c in universe order.
+// Sector-limited draws can fail and are skipped; unrestricted draws fall back
+// to equal weights.
+func (c Constraints) sampleWeights(in *Universe, randGen *rand.Rand) ([]float64, bool) {
+	// generate constrained weights
+	if len(c.SectorLimits) > 0 {
+		weights, err := c.sampleSectorWeights(in.Tickers, randGen, 200)
+		return weights, err == nil
+	}
+	n := in.Len()
+	weights, err := generateWeightConstraints(n, c.MinWeight, c.MaxWeight, randGen, 200)
+	if err != nil {
+		// if generation fails, fallback to equal weights (but in practice this shouldn't happen)
+		eq := math.Min(math.Max(1.0/float64(n), c.MinWeight), c.MaxWeight)
+		weights = make([]float64, n)
+		for i := range weights {
+			weights[i] = eq
+		}
+		// normalize
+		floats.Scale(1/floats.Sum(weights), weights)
+	}
+	return weights, true
 }
@@ -0,0 +1,84 @@
+package analysis_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"reflect"
+	"runtime"
+	"testing"
+
+	"github.com/AndrewBrickweg/Finet_v2/cmd/finet/analysis"
+)
+
+func TestMonteCarloSeed(t *testing.T) {
+	returns := analysis.MonthlyStockReturns(analysis.ExtractMonthlyAdjClosePrices(MockStockData()))
+
+	portfolios, best := analysis.OptimizePortfolio(returns, 500, 0.0, 0.02, 0.20, 1234)
+	again, bestAgain := analysis.OptimizePortfolio(returns, 500, 0.0, 0.02, 0.20, 1234)
+	if !reflect.DeepEqual(portfolios, again) || !reflect.DeepEqual(best, bestAgain) {
+		t.Fatal("same seed produced different portfolios")
+	}
+
+	other, _ := analysis.OptimizePortfolio(returns, 500, 0.0, 0.02, 0.20, 4321)
+	if reflect.DeepEqual(portfolios, other) {
+		t.Error("different seeds produced identical portfolios")
+	}
+
+	// The worker count only changes how the work is spread, never the result.
+	for _, workers := range []int{1, 3, 8} {
+		cfg := analysis.OptimizerConfig{NumPortfolios: 500, MinWeight: 0.02, MaxWeight: 0.20, Seed: 1234, Workers: workers}
+		got, viaConfig, err := analysis.Optimize(context.Background(), returns, cfg)
+		if err != nil {
+			t.Fatalf("Optimize with %d workers: %v", workers, err)
+		}
+		if !reflect.DeepEqual(got, portfolios) || !reflect.DeepEqual(viaConfig, best) {
+			t.Errorf("%d workers disagree with OptimizePortfolio for the same seed", workers)
+		}
+	}
+}
+
+func TestMonteCarloCancelled(t *testing.T) {
+	returns := analysis.MonthlyStockReturns(analysis.ExtractMonthlyAdjClosePrices(MockStockData()))
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	cfg := analysis.OptimizerConfig{NumPortfolios: 100000, MinWeight: 0.02, MaxWeight: 0.20, Seed: 1}
+	if _, _, err := analysis.Optimize(ctx, returns, cfg); !errors.Is(err, context.Canceled) {
+		t.Fatalf("got error %v, want context.Canceled", err)
+	}
+}
+
+// syntheticReturns builds months of returns for n tickers driven by one common factor.
+func syntheticReturns(n, months int) map[string][]float64 {
+	r := rand.New(rand.NewSource(99))
+	returns := make(map[string][]float64, n)
+	market := make([]float64, months)
+	for m := range market {
+		market[m] = 0.008 + 0.04*r.NormFloat64()
+	}
+	for i := range n {
+		beta := 0.5 + r.Float64()
+		series := make([]float64, months)
+		for m := range series {
+			series[m] = beta*market[m] + 0.002*r.NormFloat64() + 0.05*r.NormFloat64()
+		}
+		returns[fmt.Sprintf("T%03d", i)] = series
+	}
+	return returns
+}
+
+func BenchmarkMonteCarlo(b *testing.B) {
+	returns := syntheticReturns(100, 120)
+	for _, workers := range []int{1, 2, 4, runtime.GOMAXPROCS(0)} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			cfg := analysis.OptimizerConfig{NumPortfolios: 2000, MaxWeight: 0.05, Seed: 7, Workers: workers}
+			for range b.N {
+				if _, _, err := analysis.Optimize(context.Background(), returns, cfg); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -1,18 +1,48 @@
 package analysis
 
-import "fmt"
+import (
+	"context"
+	"fmt"
+)
 
 type Portfolios struct {
 	BestPortfolio Portfolio
 	Returns map[string][]float64
+	Months  []string  // month of each entry in Returns
+	Gaps    GapReport // how the tickers' months were aligned
+	SectorWeights map[string]float64 `json:",omitempty"`
+	BindingSectors []string          `json:",omitempty"` // sector limits the pick sits at
+	BlackLitterman *ViewReport `json:",omitempty"`
+	Benchmark      *BenchmarkComparison `json:",omitempty"` // the pick against cfg.Benchmark
+}
+
+// ViewReport shows what Black-Litterman views did to the expected returns,
+// per period of Frequency.
+type ViewReport struct {
+	Frequency     Frequency
+	Prior         string             // where MarketWeights came from; equal_weight is no market equilibrium
+	MarketWeights map[string]float64 // the portfolio the equilibrium makes optimal
+	Equilibrium   map[string]float64 // implied by the market weights
+	Posterior     map[string]float64 // after blending in the views
+}
+
+func newViewReport(in *Universe, bl *BlackLittermanResult) *ViewReport {
+	if bl == nil {
+		return nil
+	}
+	return &ViewReport{
+		Frequency:     in.Frequency,
+		Prior:         bl.Prior,
+		MarketWeights: in.WeightMap(bl.MarketWeights),
+		Equilibrium:   in.WeightMap(bl.Equilibrium),
+		Posterior:     in.WeightMap(bl.Mean),
+	}
 }
 
 func OrchestratePortfolio(
+	ctx context.Context,
 	monthly []*StockDataMonthly,
-	numPortfolios int,
-	riskFreeRate float64,
-	minWeight float64,
-	maxWeight float64,
+	cfg OptimizerConfig,
 ) (*Portfolios, error) {
 
 	if len(monthly) == 0 {
@@ -20,19 +50,152 @@ func OrchestratePortfolio(
 	}
 	fmt.Println("DEBUG: Inside OrchestratePortfolio")
 
-	adjClose := ExtractMonthlyAdjClosePrices(monthly)
-	monthlyReturns := MonthlyStockReturns(adjClose)
-
-	portfolios, bestPortfolio := OptimizePortfolio(monthlyReturns, numPortfolios, riskFreeRate, minWeight, maxWeight)
+	panel, err := AlignMonthlyReturns(monthly, cfg.GapPolicy)
+	if err != nil {
+		return nil, err
+	}
+	monthlyReturns := panel.Returns
+	cfg.Benchmark, cfg.Estimators.Benchmark, err = panel.alignBenchmark(cfg.Benchmark)
+	if err != nil {
+		return nil, err
+	}
 
-	if len(portfolios) == 0 {
-		return nil, fmt.Errorf("no portfolios generated")
+	in, bl, err := cfg.universe(monthlyReturns)
+	if err != nil {
+		return nil, err
+	}
+	bestPortfolio, err := optimizeBest(ctx, in, monthlyReturns, cfg)
+	if err != nil {
+		return nil, err
+	}
+	bestPortfolio.RiskContributions, err = in.RiskContributions(bestPortfolio.Weights)
+	if err != nil {
+		return nil, err
 	}
 
 	result := &Portfolios{
 		BestPortfolio: bestPortfolio,
 		Returns:      monthlyReturns,
+		Months:       panel.Months,
+		Gaps:         panel.Gaps,
+		BlackLitterman: newViewReport(in, bl),
+	}
+	if cfg.Sectors != nil {
+		result.SectorWeights = SectorBreakdown(bestPortfolio.Weights, cfg.Sectors)
+		result.BindingSectors = BindingSectors(bestPortfolio.Weights, cfg.Sectors, cfg.SectorLimits)
+	}
+	if cfg.Benchmark != nil {
+		result.Benchmark, err = compareWithBenchmark(cfg.Benchmark.Name, bestPortfolio.Weights, monthlyReturns, cfg.Estimators.Benchmark, cfg.RiskFreeRate, in.Frequency)
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	return result, nil
-}
\ No newline at end of file
+}
+
+type FrontierResult struct {
+	Frontier []Portfolio
+	Cloud    []RiskReturnPoint `json:",omitempty"`
+	Gaps     GapReport
+	BlackLitterman *ViewReport `json:",omitempty"`
+}
+
+// OrchestrateFrontier builds the efficient frontier for the monthly data and,
+// when cloudSize > 0, a down-sampled cloud of Monte Carlo portfolios.
+func OrchestrateFrontier(
+	ctx context.Context,
+	monthly []*StockDataMonthly,
+	numPoints int,
+	cloudSize int,
+	cfg OptimizerConfig,
+) (*FrontierResult, error) {
+
+	if len(monthly) == 0 {
+		return nil, fmt.Errorf("no monthly data provided")
+	}
+
+	panel, err := AlignMonthlyReturns(monthly, cfg.GapPolicy)
+	if err != nil {
+		return nil, err
+	}
+	monthlyReturns := panel.Returns
+	cfg.Benchmark, cfg.Estimators.Benchmark, err = panel.alignBenchmark(cfg.Benchmark)
+	if err != nil {
+		return nil, err
+	}
+
+	in, bl, err := cfg.universe(monthlyReturns)
+	if err != nil {
+		return nil, err
+	}
+	frontier, err := efficientFrontier(in, numPoints, cfg.RiskFreeRate, cfg.constraints())
+	if err != nil {
+		return nil, err
+	}
+
+	result := &FrontierResult{Frontier: frontier, Gaps: panel.Gaps, BlackLitterman: newViewReport(in, bl)}
+	if cloudSize > 0 {
+		run, err := optimizeMonteCarlo(ctx, in, cfg.NumPortfolios, cfg.RiskFreeRate, cfg.constraints(), cfg.Seed, cfg.Workers)
+		if err != nil {
+			return nil, err
+		}
+		result.Cloud = downsamplePoints(run.points, cloudSize)
+		for i, p := range result.Cloud {
+			result.Cloud[i].AnnualReturn, result.Cloud[i].AnnualRisk, result.Cloud[i].AnnualSharpe = in.Frequency.Annualize(p.Return, p.Risk, p.Sharpe)
+		}
+	}
+
+	return result, nil
+}
+
+// RiskResult is the risk report for a set of weights plus the months it
+// covers and the return series behind it, for charting.
+type RiskResult struct {
+	Risk    *PortfolioRisk
+	Months  []string
+	Gaps    GapReport
+	Returns []float64 // the portfolio's, one per month
+
+	BenchmarkName    string    `json:",omitempty"`
+	BenchmarkReturns []float64 `json:",omitempty"`
+}
+
+// OrchestrateRisk aligns the monthly data of the weighted tickers and reports
+// on the portfolio holding weights. benchmark may be nil.
+func OrchestrateRisk(
+	monthly []*StockDataMonthly,
+	weights map[string]float64,
+	benchmark *Benchmark,
+	policy GapPolicy,
+	cfg RiskConfig,
+) (*RiskResult, error) {
+
+	if len(monthly) == 0 {
+		return nil, fmt.Errorf("no monthly data provided")
+	}
+
+	panel, err := AlignMonthlyReturns(monthly, policy)
+	if err != nil {
+		return nil, err
+	}
+	benchmark, benchmarkReturns, err := panel.alignBenchmark(benchmark)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg.Months = panel.Months
+	risk, err := RiskReport(weights, panel.Returns, benchmarkReturns, cfg)
+	if err != nil {
+		return nil, err
+	}
+	series, err := weightedReturns(weights, panel.Returns)
+	if err != nil {
+		return nil, err
+	}
+	result := &RiskResult{Risk: risk, Months: panel.Months, Gaps: panel.Gaps, Returns: series}
+	if benchmark != nil {
+		result.BenchmarkName, result.BenchmarkReturns = benchmark.Name, benchmarkReturns
+	}
+	return result, nil
+}
@@ -0,0 +1,263 @@
+package analysis
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// GapPolicy decides what happens when a ticker has no price for a month the
+// other tickers trade in.
+type GapPolicy string
+
+const (
+	GapDrop        GapPolicy = "drop"   // drop the month for every ticker
+	GapForwardFill GapPolicy = "ffill"  // carry the last price forward, a zero return that month
+	GapReject      GapPolicy = "reject" // drop the ticker
+)
+
+var ErrNoCommonHistory = errors.New("tickers do not share enough months of history")
+
+// ParseGapPolicy maps a request value onto a policy. Empty selects GapDrop.
+func ParseGapPolicy(s string) (GapPolicy, error) {
+	switch p := GapPolicy(strings.ToLower(strings.TrimSpace(s))); p {
+	case "":
+		return GapDrop, nil
+	case GapDrop, GapForwardFill, GapReject:
+		return p, nil
+	default:
+		return "", fmt.Errorf("unknown gap policy %q", s)
+	}
+}
+
+// ReturnPanel holds monthly returns for several tickers on one shared month
+// index: Returns[t][i] is ticker t's return over the month Months[i], from the
+// previous month's close to that month's close.
+type ReturnPanel struct {
+	Months  []string // "2006-01"
+	Returns map[string][]float64
+	Gaps    GapReport
+}
+
+// GapReport records how a panel was aligned. Start and End bound the months
+// every remaining ticker has prices for; months outside them are not gaps.
+type GapReport struct {
+	Policy          GapPolicy
+	Start           string
+	End             string
+	DroppedMonths   []string            `json:",omitempty"` // GapDrop
+	FilledMonths    map[string][]string `json:",omitempty"` // GapForwardFill, ticker -> months
+	RejectedTickers []string            `json:",omitempty"` // GapReject
+}
+
+// Affected reports whether alignment changed anything.
+func (g GapReport) Affected() bool {
+	return len(g.DroppedMonths) > 0 || len(g.FilledMonths) > 0 || len(g.RejectedTickers) > 0
+}
+
+// AlignMonthlyReturns builds a ReturnPanel from monthly prices. A return is only
+// computed between consecutive calendar months, so a missing month never turns
+// into a silent two-month return.
+func AlignMonthlyReturns(data []*StockDataMonthly, policy GapPolicy) (*ReturnPanel, error) {
+	if policy == "" {
+		policy = GapDrop
+	}
+	prices := monthlyPriceSeries(data)
+	report := GapReport{Policy: policy}
+
+	for {
+		if len(prices) == 0 {
+			return nil, fmt.Errorf("%w: no tickers left to align", ErrNoCommonHistory)
+		}
+		start, end := commonWindow(prices)
+		months := monthRange(start, end)
+		if len(months) < 2 {
+			return nil, fmt.Errorf("%w: overlap %s to %s", ErrNoCommonHistory, start, end)
+		}
+		report.Start, report.End = start, end
+
+		if policy != GapReject {
+			return buildPanel(prices, months, policy, report)
+		}
+		var rejected []string
+		for ticker, p := range prices {
+			for _, m := range months {
+				if _, ok := p[m]; !ok {
+					rejected = append(rejected, ticker)
+					break
+				}
+			}
+		}
+		if len(rejected) == 0 {
+			return buildPanel(prices, months, policy, report)
+		}
+		// dropping a ticker can widen the window, so check the rest again
+		for _, ticker := range rejected {
+			delete(prices, ticker)
+		}
+		report.RejectedTickers = append(report.RejectedTickers, rejected...)
+		sort.Strings(report.RejectedTickers)
+	}
+}
+
+func buildPanel(prices map[string]map[string]float64, months []string, policy GapPolicy, report GapReport) (*ReturnPanel, error) {
+	tickers := make([]string, 0, len(prices))
+	for t := range prices {
+		tickers = append(tickers, t)
+	}
+	sort.Strings(tickers)
+
+	// resolve missing prices; months[0] only supplies the first return's base
+	filled := make(map[string][]float64, len(tickers))
+	missing := make(map[string][]bool, len(tickers))
+	for _, t := range tickers {
+		series := make([]float64, len(months))
+		gaps := make([]bool, len(months))
+		for i, m := range months {
+			p, ok := prices[t][m]
+			if !ok {
+				gaps[i] = true
+				if i == 0 {
+					p = lastPriceBefore(prices[t], m)
+				} else {
+					p = series[i-1]
+				}
+				if policy == GapForwardFill {
+					report.addFilled(t, m)
+				}
+			}
+			series[i] = p
+		}
+		filled[t], missing[t] = series, gaps
+	}
+
+	panel := &ReturnPanel{Returns: make(map[string][]float64, len(tickers))}
+	for i := 1; i < len(months); i++ {
+		if policy == GapDrop {
+			drop := false
+			for _, t := range tickers {
+				if missing[t][i] || missing[t][i-1] {
+					drop = true
+					break
+				}
+			}
+			if drop {
+				report.DroppedMonths = append(report.DroppedMonths, months[i])
+				continue
+			}
+		}
+		panel.Months = append(panel.Months, months[i])
+		for _, t := range tickers {
+			prev, cur := filled[t][i-1], filled[t][i]
+			panel.Returns[t] = append(panel.Returns[t], (cur-prev)/prev)
+		}
+	}
+	if len(panel.Months) < 2 {
+		return nil, fmt.Errorf("%w: %d aligned months left after dropping gaps", ErrNoCommonHistory, len(panel.Months))
+	}
+	panel.Gaps = report
+	return panel, nil
+}
+
+// SeriesReturns computes another ticker's returns, such as a benchmark's, over
+// the panel's months. Each month needs that month's close and the one before.
+func (p *ReturnPanel) SeriesReturns(stock *StockDataMonthly) ([]float64, error) {
+	return p.BenchmarkReturns(TickerBenchmark(stock))
+}
+
+func (g *GapReport) addFilled(ticker, month string) {
+	if g.FilledMonths == nil {
+		g.FilledMonths = make(map[string][]string)
+	}
+	g.FilledMonths[ticker] = append(g.FilledMonths[ticker], month)
+}
+
+// monthlyPriceSeries parses adjusted closes into ticker -> "2006-01" -> price.
+// Keys may be full dates; the last trading day of a month wins.
+func monthlyPriceSeries(data []*StockDataMonthly) map[string]map[string]float64 {
+	prices := make(map[string]map[string]float64, len(data))
+	for _, stock := range data {
+		if len(stock.TimeSeriesMonthly) == 0 {
+			continue
+		}
+		dates := make([]string, 0, len(stock.TimeSeriesMonthly))
+		for date := range stock.TimeSeriesMonthly {
+			dates = append(dates, date)
+		}
+		sort.Strings(dates)
+
+		series := make(map[string]float64, len(dates))
+		for _, date := range dates {
+			v, err := strconv.ParseFloat(stock.TimeSeriesMonthly[date].AdjClose, 64)
+			if err != nil || v <= 0 || len(date) < 7 {
+				log.Printf("Skipping price for %s on %s: %q", stock.MetaData.Symbol, date, stock.TimeSeriesMonthly[date].AdjClose)
+				continue
+			}
+			series[date[:7]] = v
+		}
+		if len(series) > 0 {
+			prices[stock.MetaData.Symbol] = series
+		}
+	}
+	return prices
+}
+
+// commonWindow is the latest first month and earliest last month over all tickers.
+func commonWindow(prices map[string]map[string]float64) (string, string) {
+	var start, end string
+	for _, p := range prices {
+		first, last := "", ""
+		for m := range p {
+			if first == "" || m < first {
+				first = m
+			}
+			if m > last {
+				last = m
+			}
+		}
+		if start == "" || first > start {
+			start = first
+		}
+		if end == "" || last < end {
+			end = last
+		}
+	}
+	return start, end
+}
+
+// monthRange lists every calendar month from start to end inclusive.
+func monthRange(start, end string) []string {
+	from, err1 := time.Parse("2006-01", start)
+	to, err2 := time.Parse("2006-01", end)
+	if err1 != nil || err2 != nil || to.Before(from) {
+		return nil
+	}
+	var months []string
+	for m := from; !m.After(to); m = m.AddDate(0, 1, 0) {
+		months = append(months, m.Format("2006-01"))
+	}
+	return months
+}
+
+// previousMonth is the calendar month before a "2006-01" month.
+func previousMonth(month string) (string, error) {
+	m, err := time.Parse("2006-01", month)
+	if err != nil {
+		return "", err
+	}
+	return m.AddDate(0, -1, 0).Format("2006-01"), nil
+}
+
+func lastPriceBefore(series map[string]float64, month string) float64 {
+	best, price := "", 0.0
+	for m, p := range series {
+		if m < month && m > best {
+			best, price = m, p
+		}
+	}
+	return price
+}
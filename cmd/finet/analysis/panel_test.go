@@ -0,0 +1,135 @@
+package analysis_test
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/AndrewBrickweg/Finet_v2/cmd/finet/analysis"
+)
+
+// monthlyPrices builds API-shaped monthly data from date -> adjusted close.
+func monthlyPrices(t *testing.T, symbol string, closes map[string]float64) *analysis.StockDataMonthly {
+	t.Helper()
+	series := make(map[string]map[string]string, len(closes))
+	for date, p := range closes {
+		series[date] = map[string]string{"5. adjusted close": fmt.Sprint(p)}
+	}
+	raw, err := json.Marshal(map[string]any{
+		"Meta Data":                    map[string]string{"2. Symbol": symbol},
+		"Monthly Adjusted Time Series": series,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var s analysis.StockDataMonthly
+	if err := json.Unmarshal(raw, &s); err != nil {
+		t.Fatal(err)
+	}
+	return &s
+}
+
+func TestAlignMonthlyReturns(t *testing.T) {
+	data := []*analysis.StockDataMonthly{
+		monthlyPrices(t, "AAA", map[string]float64{
+			"2024-12-31": 100, "2025-01-31": 110, "2025-02-28": 121, "2025-03-31": 121, "2025-04-30": 133.1, "2025-05-30": 146.41,
+		}),
+		// no March close; history starts and ends a month later
+		monthlyPrices(t, "BBB", map[string]float64{
+			"2025-01-31": 50, "2025-02-28": 55, "2025-04-30": 60.5, "2025-05-30": 66.55, "2025-06-30": 73.205,
+		}),
+		monthlyPrices(t, "CCC", map[string]float64{
+			"2024-11-29": 10, "2024-12-31": 10, "2025-01-31": 10, "2025-02-28": 10, "2025-03-31": 10, "2025-04-30": 10, "2025-05-30": 10, "2025-06-30": 10,
+		}),
+	}
+
+	t.Run("drop", func(t *testing.T) {
+		panel, err := analysis.AlignMonthlyReturns(data, analysis.GapDrop)
+		if err != nil {
+			t.Fatalf("AlignMonthlyReturns: %v", err)
+		}
+		// March and April both need BBB's missing March close
+		if want := []string{"2025-02", "2025-05"}; !reflect.DeepEqual(panel.Months, want) {
+			t.Errorf("months %v, want %v", panel.Months, want)
+		}
+		if want := []string{"2025-03", "2025-04"}; !reflect.DeepEqual(panel.Gaps.DroppedMonths, want) {
+			t.Errorf("dropped %v, want %v", panel.Gaps.DroppedMonths, want)
+		}
+		if panel.Gaps.Start != "2025-01" || panel.Gaps.End != "2025-05" {
+			t.Errorf("window %s to %s, want 2025-01 to 2025-05", panel.Gaps.Start, panel.Gaps.End)
+		}
+		for ticker, r := range panel.Returns {
+			if len(r) != len(panel.Months) {
+				t.Errorf("%s has %d returns for %d months", ticker, len(r), len(panel.Months))
+			}
+		}
+		if math.Abs(panel.Returns["AAA"][1]-0.10) > 1e-12 {
+			t.Errorf("AAA May return %v, want 0.10", panel.Returns["AAA"][1])
+		}
+	})
+
+	t.Run("ffill", func(t *testing.T) {
+		panel, err := analysis.AlignMonthlyReturns(data, analysis.GapForwardFill)
+		if err != nil {
+			t.Fatalf("AlignMonthlyReturns: %v", err)
+		}
+		if len(panel.Months) != 4 {
+			t.Fatalf("months %v, want Feb to May", panel.Months)
+		}
+		if want := map[string][]string{"BBB": {"2025-03"}}; !reflect.DeepEqual(panel.Gaps.FilledMonths, want) {
+			t.Errorf("filled %v, want %v", panel.Gaps.FilledMonths, want)
+		}
+		// a zero return in March, the whole move in April
+		if got := panel.Returns["BBB"]; got[1] != 0 || math.Abs(got[2]-0.10) > 1e-12 {
+			t.Errorf("BBB returns %v, want 0 then 0.10 for March and April", got)
+		}
+	})
+
+	t.Run("reject", func(t *testing.T) {
+		panel, err := analysis.AlignMonthlyReturns(data, analysis.GapReject)
+		if err != nil {
+			t.Fatalf("AlignMonthlyReturns: %v", err)
+		}
+		if want := []string{"BBB"}; !reflect.DeepEqual(panel.Gaps.RejectedTickers, want) {
+			t.Errorf("rejected %v, want %v", panel.Gaps.RejectedTickers, want)
+		}
+		if _, ok := panel.Returns["BBB"]; ok {
+			t.Error("BBB kept after being rejected")
+		}
+		// without BBB the window reaches back to AAA's December close
+		if want := []string{"2025-01", "2025-02", "2025-03", "2025-04", "2025-05"}; !reflect.DeepEqual(panel.Months, want) {
+			t.Errorf("months %v, want %v", panel.Months, want)
+		}
+	})
+
+	// a benchmark lines up with whichever months survived
+	panel, err := analysis.AlignMonthlyReturns(data, analysis.GapDrop)
+	if err != nil {
+		t.Fatalf("AlignMonthlyReturns: %v", err)
+	}
+	bench, err := panel.SeriesReturns(data[0])
+	if err != nil || !reflect.DeepEqual(bench, panel.Returns["AAA"]) {
+		t.Errorf("SeriesReturns(AAA) = %v, %v; want the panel's %v", bench, err, panel.Returns["AAA"])
+	}
+	filled, err := analysis.AlignMonthlyReturns(data, analysis.GapForwardFill)
+	if err != nil {
+		t.Fatalf("AlignMonthlyReturns: %v", err)
+	}
+	if _, err := filled.SeriesReturns(data[1]); !errors.Is(err, analysis.ErrNoCommonHistory) {
+		t.Errorf("got error %v for a benchmark missing a month, want ErrNoCommonHistory", err)
+	}
+
+	lone := []*analysis.StockDataMonthly{
+		data[0],
+		monthlyPrices(t, "LATE", map[string]float64{"2025-05-30": 10, "2025-06-30": 11}),
+	}
+	if _, err := analysis.AlignMonthlyReturns(lone, analysis.GapDrop); !errors.Is(err, analysis.ErrNoCommonHistory) {
+		t.Errorf("got error %v, want ErrNoCommonHistory", err)
+	}
+	if _, err := analysis.ParseGapPolicy("interpolate"); err == nil {
+		t.Error("ParseGapPolicy accepted interpolate")
+	}
+}
@@ -3,38 +3,42 @@ package analysis
 import (
 	"math"
 
+	"gonum.org/v1/gonum/mat"
 	"gonum.org/v1/gonum/stat"
 )
 
-// CovarianceMatrixSample computes sample covariance (N-1)
-// consider refactoring double map
-func CovarianceMatrixSample(returns map[string][]float64) map[string]map[string]float64 {
-	covMatrix := make(map[string]map[string]float64)
-	tickers := make([]string, 0, len(returns))
-	for t := range returns {
-		tickers = append(tickers, t)
+// CovarianceMatrix computes the sample covariance (N-1) of the tickers' returns,
+// with row and column i belonging to tickers[i].
+func CovarianceMatrix(tickers []string, returns map[string][]float64) *mat.SymDense {
+	if len(tickers) == 0 {
+		return &mat.SymDense{}
 	}
-
+	cov := mat.NewSymDense(len(tickers), nil)
 	for i, a := range tickers {
-		if covMatrix[a] == nil {
-			covMatrix[a] = make(map[string]float64)
-		}
-		for j, b := range tickers {
-			if i > j {
-				continue
-			}
-			if a == b {
-				covMatrix[a][b] = stat.Variance(returns[a], nil)
+		for j := i; j < len(tickers); j++ {
+			if i == j {
+				cov.SetSym(i, i, stat.Variance(returns[a], nil))
 			} else {
-				cov := stat.Covariance(returns[a], returns[b], nil)
-				covMatrix[a][b] = cov
-				if covMatrix[b] == nil {
-					covMatrix[b] = make(map[string]float64)
-				}
-				covMatrix[b][a] = cov
+				cov.SetSym(i, j, stat.Covariance(returns[a], returns[tickers[j]], nil))
 			}
 		}
 	}
+	return cov
+}
+
+// CovarianceMatrixSample computes sample covariance (N-1) keyed by ticker.
+// The optimizers use the dense CovarianceMatrix; this view is for display.
+func CovarianceMatrixSample(returns map[string][]float64) map[string]map[string]float64 {
+	tickers := sortedTickers(returns)
+	cov := CovarianceMatrix(tickers, returns)
+
+	covMatrix := make(map[string]map[string]float64, len(tickers))
+	for i, a := range tickers {
+		covMatrix[a] = make(map[string]float64, len(tickers))
+		for j, b := range tickers {
+			covMatrix[a][b] = cov.At(i, j)
+		}
+	}
 	return covMatrix
 }
 
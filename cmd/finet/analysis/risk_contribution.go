@@ -0,0 +1,98 @@
+package analysis
+
+import (
+	"errors"
+	"math"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// Euler decomposition of portfolio volatility. σ(w) = √(wᵀΣw) is homogeneous
+// of degree one, so the component contributions wᵢ·∂σ/∂wᵢ add up to σ exactly
+// and say how much of the risk each holding is responsible for.
+
+// RiskContributions attributes a portfolio's volatility to its tickers.
+// Marginal and Component are volatility per period of the covariance, like
+// Portfolio.Risk.
+type RiskContributions struct {
+	Marginal  map[string]float64 // ∂σ/∂wᵢ = (Σw)ᵢ/σ
+	Component map[string]float64 // wᵢ·Marginalᵢ; sums to σ
+	Percent   map[string]float64 // Component/σ; sums to 1
+
+	// DiversificationRatio is the weighted average of the holdings' own
+	// volatilities over the portfolio's; 1 means no diversification at all.
+	DiversificationRatio float64
+	// EffectiveBets is Meucci's (2009) effective number of bets: the exponential
+	// of the entropy of the risk shares of the principal components. It runs
+	// from 1, all risk in one uncorrelated bet, to the number of tickers.
+	EffectiveBets float64
+}
+
+// RiskContributions decomposes the risk of the portfolio holding weights under
+// in.Cov. Tickers missing from weights hold nothing.
+func (in *Universe) RiskContributions(weights map[string]float64) (*RiskContributions, error) {
+	n := in.Len()
+	rc := &RiskContributions{
+		Marginal:  make(map[string]float64, n),
+		Component: make(map[string]float64, n),
+		Percent:   make(map[string]float64, n),
+	}
+	if n == 0 {
+		return rc, nil
+	}
+	w := mat.NewVecDense(n, nil)
+	for i, t := range in.Tickers {
+		w.SetVec(i, weights[t])
+	}
+
+	var sigmaW mat.VecDense
+	sigmaW.MulVec(in.Cov, w)
+	variance := mat.Dot(w, &sigmaW)
+	if !(variance > 0) {
+		for _, t := range in.Tickers {
+			rc.Marginal[t], rc.Component[t], rc.Percent[t] = 0, 0, 0
+		}
+		return rc, nil
+	}
+	vol := math.Sqrt(variance)
+
+	standalone := 0.0
+	for i, t := range in.Tickers {
+		marginal := sigmaW.AtVec(i) / vol
+		rc.Marginal[t] = marginal
+		rc.Component[t] = w.AtVec(i) * marginal
+		rc.Percent[t] = w.AtVec(i) * marginal / vol
+		standalone += w.AtVec(i) * math.Sqrt(math.Max(in.Cov.At(i, i), 0))
+	}
+	rc.DiversificationRatio = standalone / vol
+
+	bets, err := effectiveBets(in.Cov, w, variance)
+	if err != nil {
+		return nil, err
+	}
+	rc.EffectiveBets = bets
+	return rc, nil
+}
+
+// effectiveBets rotates w onto the eigenvectors of cov. The principal
+// portfolios are uncorrelated, so exposure eₖ on one with variance λₖ
+// contributes eₖ²λₖ of the variance with no cross terms.
+func effectiveBets(cov *mat.SymDense, w *mat.VecDense, variance float64) (float64, error) {
+	var eig mat.EigenSym
+	if !eig.Factorize(cov, true) {
+		return 0, errors.New("effective number of bets: eigendecomposition failed")
+	}
+	var vectors mat.Dense
+	eig.VectorsTo(&vectors)
+	var exposure mat.VecDense
+	exposure.MulVec(vectors.T(), w)
+
+	entropy := 0.0
+	for k, lambda := range eig.Values(nil) {
+		p := exposure.AtVec(k) * exposure.AtVec(k) * math.Max(lambda, 0) / variance
+		if p > 0 {
+			entropy -= p * math.Log(p)
+		}
+	}
+	return math.Exp(entropy), nil
+}
@@ -0,0 +1,79 @@
+package analysis_test
+
+import (
+	"math"
+	"testing"
+
+	"github.com/AndrewBrickweg/Finet_v2/cmd/finet/analysis"
+)
+
+func TestRiskContributionsAddUp(t *testing.T) {
+	returns := clusteredReturns(3, 3, 120)
+	in := analysis.NewUniverse(returns)
+	p, err := analysis.OptimizeMinVariance(returns, 0, analysis.Constraints{MaxWeight: 0.4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rc, err := in.RiskContributions(p.Weights)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	component, percent := 0.0, 0.0
+	for _, ticker := range in.Tickers {
+		component += rc.Component[ticker]
+		percent += rc.Percent[ticker]
+		if want := p.Weights[ticker] * rc.Marginal[ticker]; math.Abs(rc.Component[ticker]-want) > 1e-15 {
+			t.Errorf("%s component %v, want weight times marginal %v", ticker, rc.Component[ticker], want)
+		}
+	}
+	if math.Abs(component-p.Risk) > 1e-12 {
+		t.Errorf("components sum to %v, want the portfolio risk %v", component, p.Risk)
+	}
+	if math.Abs(percent-1) > 1e-12 {
+		t.Errorf("percent contributions sum to %v, want 1", percent)
+	}
+	if rc.DiversificationRatio <= 1 {
+		t.Errorf("diversification ratio %v, want above 1 for a spread basket", rc.DiversificationRatio)
+	}
+	if rc.EffectiveBets < 1 || rc.EffectiveBets > float64(in.Len()) {
+		t.Errorf("effective bets %v, want between 1 and %d", rc.EffectiveBets, in.Len())
+	}
+}
+
+func TestRiskContributionsUncorrelated(t *testing.T) {
+	// Two uncorrelated series with the same volatility: equal weights split the
+	// risk evenly into two independent bets.
+	returns := map[string][]float64{
+		"A": {0.01, -0.01, 0.01, -0.01},
+		"B": {0.01, 0.01, -0.01, -0.01},
+	}
+	in := analysis.NewUniverse(returns)
+
+	tests := []struct {
+		name      string
+		weights   map[string]float64
+		wantRatio float64
+		wantBets  float64
+	}{
+		{name: "equal weights", weights: map[string]float64{"A": 0.5, "B": 0.5}, wantRatio: math.Sqrt2, wantBets: 2},
+		{name: "one holding", weights: map[string]float64{"A": 1}, wantRatio: 1, wantBets: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rc, err := in.RiskContributions(tt.weights)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if math.Abs(rc.DiversificationRatio-tt.wantRatio) > 1e-12 {
+				t.Errorf("diversification ratio %v, want %v", rc.DiversificationRatio, tt.wantRatio)
+			}
+			if math.Abs(rc.EffectiveBets-tt.wantBets) > 1e-9 {
+				t.Errorf("effective bets %v, want %v", rc.EffectiveBets, tt.wantBets)
+			}
+			if math.Abs(rc.Percent["A"]-tt.weights["A"]) > 1e-12 {
+				t.Errorf("A carries %v of the risk, want %v", rc.Percent["A"], tt.weights["A"])
+			}
+		})
+	}
+}
@@ -0,0 +1,325 @@
+package analysis
+
+import (
+	"errors"
+	"fmt"
+	"math"
+
+	"gonum.org/v1/gonum/floats"
+	"gonum.org/v1/gonum/mat"
+)
+
+// Risk budgeting. Instead of trading return against risk, these portfolios
+// split the total variance wᵀΣw between the holdings in fixed proportions:
+// holding i contributes wᵢ(Σw)ᵢ, and equal risk contribution (ERC) gives every
+// holding the same share.
+
+var ErrInvalidRiskBudget = errors.New("risk budgets must be positive and cover every ticker")
+
+// OptimizeRiskParity returns the equal-risk-contribution portfolio within the
+// weight bounds. riskFreeRate is only used to report the Sharpe ratio.
+func OptimizeRiskParity(returns map[string][]float64, riskFreeRate float64, constraints Constraints) (Portfolio, error) {
+	return optimizeRiskBudget(NewUniverse(returns), riskFreeRate, constraints, nil)
+}
+
+// OptimizeRiskBudget returns the portfolio whose risk contributions match
+// budgets, a ticker -> share map scaled to sum to 1. A nil map means equal
+// shares. Weight bounds or sector limits that bind pull the contributions away
+// from their targets; within the limits the budgets are met exactly.
+func OptimizeRiskBudget(returns map[string][]float64, riskFreeRate float64, constraints Constraints, budgets map[string]float64) (Portfolio, error) {
+	return optimizeRiskBudget(NewUniverse(returns), riskFreeRate, constraints, budgets)
+}
+
+func optimizeRiskBudget(in *Universe, riskFreeRate float64, constraints Constraints, budgets map[string]float64) (Portfolio, error) {
+	cons, err := constraints.prepare(in.Tickers)
+	if err != nil {
+		return Portfolio{}, err
+	}
+	b, err := riskBudgetShares(in.Tickers, budgets)
+	if err != nil {
+		return Portfolio{}, err
+	}
+	for i, t := range in.Tickers {
+		if !(in.Cov.At(i, i) > 0) {
+			return Portfolio{}, fmt.Errorf("risk budgeting: %s has no variance", t)
+		}
+	}
+	var w []float64
+	if len(cons.SectorLimits) > 0 {
+		w, err = riskBudgetSectorWeights(in, cons, b)
+	} else {
+		w, err = riskBudgetWeights(in, cons, b)
+	}
+	if err != nil {
+		return Portfolio{}, err
+	}
+	return in.portfolio(w, riskFreeRate), nil
+}
+
+// riskBudgetShares orders budgets like tickers and scales them to sum to 1.
+func riskBudgetShares(tickers []string, budgets map[string]float64) ([]float64, error) {
+	b := make([]float64, len(tickers))
+	if budgets == nil {
+		for i := range b {
+			b[i] = 1 / float64(len(tickers))
+		}
+		return b, nil
+	}
+	total := 0.0
+	for i, t := range tickers {
+		v, ok := budgets[t]
+		if !ok || !(v > 0) || math.IsInf(v, 1) {
+			return nil, fmt.Errorf("%w: %s has budget %v", ErrInvalidRiskBudget, t, v)
+		}
+		b[i] = v
+		total += v
+	}
+	for i := range b {
+		b[i] /= total
+	}
+	return b, nil
+}
+
+// riskBudgetWeights follows Richard and Roncalli (2019): for a scale λ,
+//
+//	x(λ) = argmin ½xᵀΣx - λ Σ bᵢ ln xᵢ  s.t.  MinWeight <= xᵢ <= MaxWeight
+//
+// is convex, and at the interior optimum xᵢ(Σx)ᵢ = λbᵢ, i.e. the risk
+// contributions are in proportion b. Σx(λ) grows with λ, so bisecting on λ
+// until the weights sum to 1 gives a fully invested portfolio. Each x(λ) is
+// found by cyclical coordinate descent, which has a closed-form step per
+// coordinate and handles the box by clamping.
+func riskBudgetWeights(in *Universe, cons Constraints, b []float64) ([]float64, error) {
+	n := len(in.Tickers)
+	x := make([]float64, n)
+	for i := range x {
+		x[i] = 1 / float64(n)
+	}
+	sum := func(lambda float64) (float64, error) {
+		if err := riskBudgetDescent(in, cons, b, lambda, x); err != nil {
+			return 0, err
+		}
+		s := 0.0
+		for _, v := range x {
+			s += v
+		}
+		return s, nil
+	}
+
+	// Without bounds x(λ) = √λ·x(1), which puts the answer near 1/Σx(1)².
+	s, err := sum(1)
+	if err != nil {
+		return nil, err
+	}
+	// Bracket the λ giving Σx = 1. The bounds already admit a fully invested
+	// portfolio, so Σx spans 1 between the all-minimum and all-maximum ends.
+	lo, hi := 1/(s*s), 1/(s*s)
+	for range 100 {
+		if s, err = sum(lo); err != nil {
+			return nil, err
+		}
+		if s <= 1 {
+			break
+		}
+		lo /= 4
+	}
+	for range 100 {
+		if s, err = sum(hi); err != nil {
+			return nil, err
+		}
+		if s >= 1 {
+			break
+		}
+		hi *= 4
+	}
+
+	for range 200 {
+		mid := math.Sqrt(lo * hi)
+		s, err := sum(mid)
+		if err != nil {
+			return nil, err
+		}
+		if math.Abs(s-1) < 1e-12 {
+			break
+		}
+		if s < 1 {
+			lo = mid
+		} else {
+			hi = mid
+		}
+	}
+	return clampWeights(x, cons), nil
+}
+
+// riskBudgetDescent minimizes ½xᵀΣx - λΣbᵢln xᵢ over the weight box in place,
+// starting from x. Setting the derivative in xᵢ to zero gives
+// σᵢᵢxᵢ² + cᵢxᵢ - λbᵢ = 0 with cᵢ = Σⱼ≠ᵢ σᵢⱼxⱼ, whose positive root, clamped to
+// the box, is the exact minimizer along that coordinate.
+func riskBudgetDescent(in *Universe, cons Constraints, b []float64, lambda float64, x []float64) error {
+	n := len(x)
+	lower := math.Max(cons.MinWeight, 1e-12) // ln xᵢ needs xᵢ > 0
+	for range 10000 {
+		moved := 0.0
+		for i := range n {
+			sii := in.Cov.At(i, i)
+			c := 0.0
+			for j := range n {
+				if j != i {
+					c += in.Cov.At(i, j) * x[j]
+				}
+			}
+			xi := (-c + math.Sqrt(c*c+4*sii*lambda*b[i])) / (2 * sii)
+			xi = math.Min(math.Max(xi, lower), cons.MaxWeight)
+			moved = math.Max(moved, math.Abs(xi-x[i]))
+			x[i] = xi
+		}
+		if moved < 1e-14 {
+			return nil
+		}
+	}
+	return errors.New("risk budgeting: coordinate descent did not converge")
+}
+
+// riskBudgetSectorWeights handles sector limits, which bound shares of the
+// invested total and so do not fit the bisection on λ above. Writing w = y/κ
+// with κ = Σy turns every constraint into a homogeneous row over (y, κ), as in
+// maxSharpeWeights, and
+//
+//	minimize ½yᵀΣy - Σ bᵢ ln yᵢ  s.t.  l·κ <= A·y <= u·κ
+//
+// is convex with yᵢ(Σy)ᵢ = bᵢ wherever no limit binds, so the budgets are met
+// until a weight or sector limit pulls the contributions away from them. Each
+// Newton step is a QP over the same rows, damped to keep y positive.
+func riskBudgetSectorWeights(in *Universe, cons Constraints, b []float64) ([]float64, error) {
+	n := len(in.Tickers)
+	A, l, u := cons.linearRows(in.Tickers)
+	w, err := positiveWeights(A, l, u)
+	if err != nil {
+		return nil, err
+	}
+	hA, hl, hu := homogenize(A, l, u)
+
+	sy := mat.NewVecDense(n, nil)
+	objective := func(y []float64) float64 {
+		sy.MulVec(in.Cov, mat.NewVecDense(n, y))
+		f := 0.0
+		for i := range n {
+			f += 0.5*y[i]*sy.AtVec(i) - b[i]*math.Log(y[i])
+		}
+		return f
+	}
+
+	// the unconstrained optimum has unit variance, so start there
+	y := make([]float64, n)
+	floats.ScaleTo(y, 1/math.Sqrt(mat.Inner(mat.NewVecDense(n, w), in.Cov, mat.NewVecDense(n, w))), w)
+	f := objective(y)
+
+	m, _ := hA.Dims()
+	scaled := mat.NewDense(m, n+1, nil)
+	P := mat.NewSymDense(n+1, nil)
+	q := make([]float64, n+1)
+	d := make([]float64, n)
+	next := make([]float64, n)
+	for iter := 0; ; iter++ {
+		if iter == 100 {
+			return nil, errors.New("risk budgeting: Newton steps did not converge")
+		}
+		// gradient g = Σy - b/y and Hessian H = Σ + diag(b/y²). The QP
+		// minimizes the quadratic model ½zᵀHz + (g - Hy)ᵀz over the new point
+		// z = D·s with D = diag(y, κ); unscaled, the b/y² of a small weight
+		// swamps Σ and ADMM stalls.
+		sy.MulVec(in.Cov, mat.NewVecDense(n, y))
+		scale := append(append([]float64(nil), y...), floats.Sum(y))
+		for i := range n {
+			hy := in.Cov.At(i, i)*y[i] + b[i]/y[i] // (Hy)ᵢ without the off-diagonal terms
+			for j := range n {
+				h := in.Cov.At(i, j)
+				if j == i {
+					h += b[i] / (y[i] * y[i])
+				} else {
+					hy += h * y[j]
+				}
+				if j >= i {
+					P.SetSym(i, j, scale[i]*h*scale[j])
+				}
+			}
+			q[i] = scale[i] * (sy.AtVec(i) - b[i]/y[i] - hy)
+		}
+		// the rows' bounds are all 0 or infinite, so each row can also be
+		// scaled to unit size, which keeps ADMM's step size in proportion
+		for r := range m {
+			norm := 0.0
+			for j := range n + 1 {
+				scaled.Set(r, j, hA.At(r, j)*scale[j])
+				norm = math.Max(norm, math.Abs(scaled.At(r, j)))
+			}
+			if norm == 0 {
+				continue // a limit on a sector none of the tickers is in
+			}
+			for j := range n + 1 {
+				scaled.Set(r, j, scaled.At(r, j)/norm)
+			}
+		}
+		z, err := solveQP(qpProblem{P: P, q: q, A: scaled, l: hl, u: hu}, defaultQPSettings)
+		if err != nil {
+			return nil, fmt.Errorf("risk budgeting: %w", err)
+		}
+		for i := range n {
+			z[i] *= scale[i]
+		}
+
+		slope := 0.0
+		for i := range n {
+			d[i] = z[i] - y[i]
+			slope += (sy.AtVec(i) - b[i]/y[i]) * d[i]
+		}
+		if slope > -1e-12 {
+			break // the Newton decrement is within the QP's accuracy
+		}
+		t := 1.0
+		for ; t > 1e-10; t /= 2 {
+			floats.AddScaledTo(next, y, t, d)
+			if floats.Min(next) > 0 {
+				if fn := objective(next); fn <= f+1e-4*t*slope {
+					f = fn
+					break
+				}
+			}
+		}
+		if t <= 1e-10 {
+			break
+		}
+		copy(y, next)
+	}
+
+	floats.Scale(1/floats.Sum(y), y)
+	return clampWeights(y, cons), nil
+}
+
+// positiveWeights finds the feasible weights whose smallest weight is as large
+// as possible, a starting point inside the domain of ln w. It fails when the
+// limits leave some ticker no weight at all, since risk budgeting gives every
+// ticker a share of the risk.
+func positiveWeights(A *mat.Dense, l, u []float64) ([]float64, error) {
+	m, n := A.Dims()
+	// maximize t subject to the rows and wᵢ - t >= 0
+	ext := mat.NewDense(m+n, n+1, nil)
+	ext.Slice(0, m, 0, n).(*mat.Dense).Copy(A)
+	lo := append(append([]float64(nil), l...), make([]float64, n)...)
+	hi := append([]float64(nil), u...)
+	for i := range n {
+		ext.Set(m+i, i, 1)
+		ext.Set(m+i, n, -1)
+		hi = append(hi, math.Inf(1))
+	}
+	c := make([]float64, n+1)
+	c[n] = -1
+	x, err := solveLP(c, ext, lo, hi)
+	if err != nil {
+		return nil, fmt.Errorf("risk budgeting: %w", err)
+	}
+	if x[n] < 1e-9 {
+		return nil, fmt.Errorf("%w: risk budgeting needs every ticker held, and the limits leave some at zero", ErrInfeasibleConstraints)
+	}
+	return x[:n], nil
+}
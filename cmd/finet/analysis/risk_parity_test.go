@@ -0,0 +1,154 @@
+package analysis_test
+
+import (
+	"context"
+	"errors"
+	"math"
+	"testing"
+
+	"github.com/AndrewBrickweg/Finet_v2/cmd/finet/analysis"
+	"gonum.org/v1/gonum/mat"
+)
+
+// riskShares returns each holding's share wᵢ(Σw)ᵢ / wᵀΣw of the portfolio variance.
+func riskShares(in *analysis.Universe, p analysis.Portfolio) map[string]float64 {
+	w := mat.NewVecDense(in.Len(), nil)
+	for i, t := range in.Tickers {
+		w.SetVec(i, p.Weights[t])
+	}
+	var sw mat.VecDense
+	sw.MulVec(in.Cov, w)
+	variance := mat.Dot(w, &sw)
+	shares := make(map[string]float64, in.Len())
+	for i, t := range in.Tickers {
+		shares[t] = w.AtVec(i) * sw.AtVec(i) / variance
+	}
+	return shares
+}
+
+func TestRiskParity(t *testing.T) {
+	returns := syntheticReturns(8, 120)
+	in := analysis.NewUniverse(returns)
+
+	erc, err := analysis.OptimizeRiskParity(returns, 0, analysis.Constraints{MaxWeight: 1})
+	if err != nil {
+		t.Fatalf("OptimizeRiskParity: %v", err)
+	}
+	checkWeights(t, erc, 0, 1)
+	for ticker, share := range riskShares(in, erc) {
+		if math.Abs(share-1.0/8) > 1e-6 {
+			t.Errorf("%s contributes %.6f of the risk, want 1/8", ticker, share)
+		}
+	}
+
+	// Risk parity sits between minimum variance and equal weights.
+	minVar, err := analysis.OptimizeMinVariance(returns, 0, analysis.Constraints{MaxWeight: 1})
+	if err != nil {
+		t.Fatalf("OptimizeMinVariance: %v", err)
+	}
+	if erc.Risk < minVar.Risk-1e-9 {
+		t.Errorf("risk parity risk %v below the minimum variance %v", erc.Risk, minVar.Risk)
+	}
+
+	budgets := make(map[string]float64, in.Len())
+	for i, ticker := range in.Tickers {
+		budgets[ticker] = float64(i + 1) // scaled to sum to 1
+	}
+	cfg := analysis.OptimizerConfig{Mode: analysis.ModeRiskBudget, MaxWeight: 1, RiskBudgets: budgets}
+	_, budgeted, err := analysis.Optimize(context.Background(), returns, cfg)
+	if err != nil {
+		t.Fatalf("Optimize(risk_budget): %v", err)
+	}
+	checkWeights(t, budgeted, 0, 1)
+	shares := riskShares(in, budgeted)
+	for i, ticker := range in.Tickers {
+		if want := float64(i+1) / 36; math.Abs(shares[ticker]-want) > 1e-6 {
+			t.Errorf("%s contributes %.6f of the risk, want %.6f", ticker, shares[ticker], want)
+		}
+	}
+
+	// A binding cap holds and leaves the other holdings sharing the rest equally.
+	capped, err := analysis.OptimizeRiskParity(returns, 0, analysis.Constraints{MaxWeight: 0.13})
+	if err != nil {
+		t.Fatalf("OptimizeRiskParity with cap: %v", err)
+	}
+	checkWeights(t, capped, 0, 0.13)
+	var free []float64
+	cappedShares := riskShares(in, capped)
+	for ticker, w := range capped.Weights {
+		if w < 0.13-1e-9 {
+			free = append(free, cappedShares[ticker])
+		}
+	}
+	if len(free) == 0 || len(free) == in.Len() {
+		t.Fatalf("cap binds on %d of %d holdings, want some", in.Len()-len(free), in.Len())
+	}
+	for _, share := range free {
+		if math.Abs(share-free[0]) > 1e-6 {
+			t.Errorf("uncapped holdings contribute %v, want equal shares", free)
+			break
+		}
+	}
+
+	delete(budgets, in.Tickers[0])
+	if _, err := analysis.OptimizeRiskBudget(returns, 0, analysis.Constraints{MaxWeight: 1}, budgets); !errors.Is(err, analysis.ErrInvalidRiskBudget) {
+		t.Errorf("got error %v for a missing budget, want ErrInvalidRiskBudget", err)
+	}
+}
+
+func TestRiskBudgetSectorLimits(t *testing.T) {
+	returns := syntheticReturns(8, 120)
+	in := analysis.NewUniverse(returns)
+	sectors := make(map[string]string, in.Len())
+	budgets := make(map[string]float64, in.Len())
+	for i, ticker := range in.Tickers {
+		sectors[ticker] = []string{"first", "second"}[i%2]
+		budgets[ticker] = float64(i + 1)
+	}
+	free, err := analysis.OptimizeRiskBudget(returns, 0, analysis.Constraints{MaxWeight: 1}, budgets)
+	if err != nil {
+		t.Fatalf("OptimizeRiskBudget: %v", err)
+	}
+	first := analysis.SectorBreakdown(free.Weights, sectors)["first"]
+
+	// A limit that does not bind leaves the budgets met exactly.
+	loose := analysis.Constraints{MaxWeight: 1, Sectors: sectors, SectorLimits: []analysis.SectorLimit{{Sector: "first", Max: first + 0.05}}}
+	p, err := analysis.OptimizeRiskBudget(returns, 0, loose, budgets)
+	if err != nil {
+		t.Fatalf("OptimizeRiskBudget with a loose limit: %v", err)
+	}
+	shares := riskShares(in, p)
+	for i, ticker := range in.Tickers {
+		if want := float64(i+1) / 36; math.Abs(shares[ticker]-want) > 1e-6 {
+			t.Errorf("%s contributes %.6f of the risk, want %.6f", ticker, shares[ticker], want)
+		}
+	}
+	if binding := analysis.BindingSectors(p.Weights, sectors, loose.SectorLimits); len(binding) > 0 {
+		t.Errorf("loose limit reported binding: %v", binding)
+	}
+
+	// A cap below the unconstrained weight holds and is reported as binding.
+	capped := analysis.Constraints{MaxWeight: 1, Sectors: sectors, SectorLimits: []analysis.SectorLimit{{Sector: "First", Max: first - 0.1}}}
+	p, err = analysis.OptimizeRiskBudget(returns, 0, capped, budgets)
+	if err != nil {
+		t.Fatalf("OptimizeRiskBudget with a binding limit: %v", err)
+	}
+	checkWeights(t, p, 0, 1)
+	if got := analysis.SectorBreakdown(p.Weights, sectors)["first"]; math.Abs(got-(first-0.1)) > 1e-6 {
+		t.Errorf("sector first holds %.6f, want the cap %.6f", got, first-0.1)
+	}
+	if binding := analysis.BindingSectors(p.Weights, sectors, capped.SectorLimits); len(binding) != 1 || binding[0] != "First" {
+		t.Errorf("binding sectors %v, want [First]", binding)
+	}
+	for ticker, w := range p.Weights {
+		if !(w > 0) {
+			t.Errorf("%s has weight %v, want every ticker held", ticker, w)
+		}
+	}
+
+	// Limits that force a ticker out leave it no share of the risk to carry.
+	out := analysis.Constraints{MaxWeight: 1, Sectors: sectors, SectorLimits: []analysis.SectorLimit{{Sector: "first", Min: 1, Max: 1}}}
+	if _, err := analysis.OptimizeRiskParity(returns, 0, out); !errors.Is(err, analysis.ErrInfeasibleConstraints) {
+		t.Errorf("got error %v for a sector forced to zero, want ErrInfeasibleConstraints", err)
+	}
+}
@@ -0,0 +1,271 @@
+package analysis
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+
+	"gonum.org/v1/gonum/stat"
+	"gonum.org/v1/gonum/stat/distuv"
+)
+
+// RiskConfig sets the conventions RiskReport measures with.
+type RiskConfig struct {
+	Frequency    Frequency // of the return series; zero means monthly
+	RiskFreeRate float64   // per period
+	Confidence   float64   // VaR and CVaR level; 0 uses DefaultCVaRConfidence
+	Months       []string  // optional label of each period, for the drawdown dates
+}
+
+// PortfolioRisk describes the history of a fixed-weight portfolio. Return,
+// volatility and the ratios are annualized; VaR and CVaR are one-period
+// losses, as positive fractions.
+type PortfolioRisk struct {
+	Frequency Frequency
+	Periods   int
+
+	AnnualReturn     float64 // mean return times periods per year
+	AnnualVolatility float64
+	CAGR             float64 // compound annual growth rate
+	Sharpe           float64
+	Sortino          float64 // excess return over downside deviation below the risk-free rate
+	Calmar           float64 // CAGR over the maximum drawdown
+
+	MaxDrawdown Drawdown
+
+	Confidence     float64
+	HistoricalVaR  float64
+	HistoricalCVaR float64
+	ParametricVaR  float64 // normal distribution with the sample mean and volatility
+	ParametricCVaR float64
+
+	Skew           float64
+	ExcessKurtosis float64
+
+	Contributions *RiskContributions `json:",omitempty"` // per period, from the sample covariance
+	Benchmark     *BenchmarkRisk     `json:",omitempty"`
+}
+
+// Drawdown is the largest fall from a peak in cumulative wealth. Peak, Trough
+// and Recovery are the months at whose close each happened; Recovery is empty
+// while the portfolio is still below its peak.
+type Drawdown struct {
+	Depth    float64 // positive fraction of the peak
+	Peak     string  `json:",omitempty"`
+	Trough   string  `json:",omitempty"`
+	Recovery string  `json:",omitempty"`
+}
+
+// BenchmarkRisk compares the portfolio with a benchmark over the same periods.
+type BenchmarkRisk struct {
+	Beta             float64
+	Alpha            float64 // annualized Jensen's alpha
+	TrackingError    float64 // annualized volatility of the active return
+	InformationRatio float64 // annualized active return over tracking error
+}
+
+// RiskReport measures the portfolio holding weights, rebalanced every period,
+// over returns. Every weighted ticker needs a series of the same length, and
+// so does benchmark when it is not nil.
+func RiskReport(weights map[string]float64, returns map[string][]float64, benchmark []float64, cfg RiskConfig) (*PortfolioRisk, error) {
+	series, err := weightedReturns(weights, returns)
+	if err != nil {
+		return nil, err
+	}
+	r, err := SeriesRisk(series, benchmark, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	held := make(map[string][]float64, len(weights))
+	for ticker := range weights {
+		held[ticker] = returns[ticker]
+	}
+	in, err := NewUniverseWith(held, Estimators{Frequency: r.Frequency})
+	if err != nil {
+		return nil, err
+	}
+	if r.Contributions, err = in.RiskContributions(weights); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// SeriesRisk measures a portfolio's return series directly, for portfolios
+// whose weights change over time such as a backtest's. It leaves
+// Contributions empty since there is no single set of weights to attribute to.
+func SeriesRisk(series, benchmark []float64, cfg RiskConfig) (*PortfolioRisk, error) {
+	t := len(series)
+	if t < 2 {
+		return nil, fmt.Errorf("%w: have %d, need 2", ErrTooFewObservations, t)
+	}
+	if cfg.Months != nil && len(cfg.Months) != t {
+		return nil, fmt.Errorf("%d month labels for %d returns", len(cfg.Months), t)
+	}
+	if benchmark != nil && len(benchmark) != t {
+		return nil, fmt.Errorf("benchmark has %d returns, the portfolio %d", len(benchmark), t)
+	}
+	confidence := cfg.Confidence
+	if confidence == 0 {
+		confidence = DefaultCVaRConfidence
+	}
+	if !(confidence > 0 && confidence < 1) {
+		return nil, fmt.Errorf("confidence must be in (0, 1), got %v", confidence)
+	}
+
+	freq := cfg.Frequency.orMonthly()
+	periods := freq.PeriodsPerYear()
+	rf := cfg.RiskFreeRate
+	mean, sd := stat.MeanStdDev(series, nil)
+
+	r := &PortfolioRisk{
+		Frequency:        freq,
+		Periods:          t,
+		AnnualReturn:     mean * periods,
+		AnnualVolatility: sd * math.Sqrt(periods),
+		Confidence:       confidence,
+		Skew:             stat.Skew(series, nil),
+		ExcessKurtosis:   stat.ExKurtosis(series, nil),
+	}
+	if sd > 0 {
+		r.Sharpe = (mean - rf) / sd * math.Sqrt(periods)
+	}
+
+	downside := 0.0
+	for _, x := range series {
+		if x < rf {
+			downside += (x - rf) * (x - rf)
+		}
+	}
+	if downside > 0 {
+		r.Sortino = (mean - rf) / math.Sqrt(downside/float64(t)) * math.Sqrt(periods)
+	}
+
+	growth := 1.0
+	for _, x := range series {
+		growth *= 1 + x
+	}
+	r.CAGR = math.Pow(math.Max(growth, 0), periods/float64(t)) - 1
+	r.MaxDrawdown = maxDrawdown(series, cfg.Months)
+	if r.MaxDrawdown.Depth > 0 {
+		r.Calmar = r.CAGR / r.MaxDrawdown.Depth
+	}
+
+	r.HistoricalVaR = historicalVaR(series, confidence)
+	r.HistoricalCVaR = HistoricalCVaR(series, confidence)
+	z := distuv.UnitNormal.Quantile(confidence)
+	r.ParametricVaR = z*sd - mean
+	r.ParametricCVaR = sd*distuv.UnitNormal.Prob(z)/(1-confidence) - mean
+
+	if benchmark != nil {
+		r.Benchmark = benchmarkRisk(series, benchmark, rf, periods)
+	}
+	return r, nil
+}
+
+// weightedReturns is the return of the weights in every period.
+func weightedReturns(weights map[string]float64, returns map[string][]float64) ([]float64, error) {
+	if len(weights) == 0 {
+		return nil, errors.New("no weights provided")
+	}
+	tickers := make([]string, 0, len(weights))
+	for t := range weights {
+		tickers = append(tickers, t)
+	}
+	sort.Strings(tickers)
+
+	var series []float64
+	for _, ticker := range tickers {
+		r, ok := returns[ticker]
+		if !ok {
+			return nil, fmt.Errorf("%w: no returns for %s", ErrNoCommonHistory, ticker)
+		}
+		if series == nil {
+			series = make([]float64, len(r))
+		}
+		if len(r) != len(series) {
+			return nil, fmt.Errorf("return series differ in length: %s has %d, %s has %d", tickers[0], len(series), ticker, len(r))
+		}
+		for i, x := range r {
+			series[i] += weights[ticker] * x
+		}
+	}
+	return series, nil
+}
+
+// maxDrawdown walks cumulative wealth, starting at 1 before the first period.
+func maxDrawdown(series []float64, months []string) Drawdown {
+	label := func(i int) string {
+		// i is the number of periods elapsed; 0 is the close before the first return
+		if months == nil {
+			return ""
+		}
+		if i == 0 {
+			m, err := previousMonth(months[0])
+			if err != nil {
+				return ""
+			}
+			return m
+		}
+		return months[i-1]
+	}
+
+	wealth, peak := 1.0, 1.0
+	peakAt, bestPeak, bestTrough := 0, 0, -1
+	depth := 0.0
+	for i, x := range series {
+		wealth *= 1 + x
+		if wealth > peak {
+			peak, peakAt = wealth, i+1
+			continue
+		}
+		if dd := 1 - wealth/peak; dd > depth {
+			depth, bestPeak, bestTrough = dd, peakAt, i+1
+		}
+	}
+	if bestTrough < 0 {
+		return Drawdown{}
+	}
+
+	dd := Drawdown{Depth: depth, Peak: label(bestPeak), Trough: label(bestTrough)}
+	wealth, peak = 1.0, 1.0
+	for i, x := range series {
+		wealth *= 1 + x
+		if i+1 == bestPeak {
+			peak = wealth
+		}
+		if i+1 > bestTrough && wealth >= peak {
+			dd.Recovery = label(i + 1)
+			break
+		}
+	}
+	return dd
+}
+
+// historicalVaR is the loss the worst 1-confidence share of periods exceed.
+func historicalVaR(series []float64, confidence float64) float64 {
+	losses := make([]float64, len(series))
+	for i, x := range series {
+		losses[i] = -x
+	}
+	sort.Sort(sort.Reverse(sort.Float64Slice(losses)))
+	// the epsilon keeps 10% of 10 periods from rounding down to 0
+	k := min(int((1-confidence)*float64(len(losses))+1e-9), len(losses)-1)
+	return losses[k]
+}
+
+func benchmarkRisk(series, benchmark []float64, rf, periods float64) *BenchmarkRisk {
+	active := make([]float64, len(series))
+	for i := range series {
+		active[i] = series[i] - benchmark[i]
+	}
+	b := &BenchmarkRisk{Beta: BetaCoefficients(map[string][]float64{"portfolio": series}, benchmark)["portfolio"]}
+	b.Alpha = ((stat.Mean(series, nil) - rf) - b.Beta*(stat.Mean(benchmark, nil)-rf)) * periods
+	activeMean, activeSD := stat.MeanStdDev(active, nil)
+	b.TrackingError = activeSD * math.Sqrt(periods)
+	if b.TrackingError > 0 {
+		b.InformationRatio = activeMean * periods / b.TrackingError
+	}
+	return b
+}
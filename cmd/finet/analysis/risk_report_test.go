@@ -0,0 +1,90 @@
+package analysis_test
+
+import (
+	"math"
+	"testing"
+
+	"github.com/AndrewBrickweg/Finet_v2/cmd/finet/analysis"
+	"gonum.org/v1/gonum/stat"
+)
+
+func TestRiskReport(t *testing.T) {
+	months := []string{"2024-01", "2024-02", "2024-03", "2024-04", "2024-05", "2024-06", "2024-07", "2024-08", "2024-09", "2024-10"}
+	returns := map[string][]float64{
+		"A": {0.04, -0.02, -0.08, 0.03, 0.05, 0.02, -0.01, 0.06, -0.03, 0.02},
+		"B": {0.00, 0.02, -0.04, 0.01, 0.03, 0.00, 0.01, 0.02, -0.01, 0.00},
+	}
+	weights := map[string]float64{"A": 0.5, "B": 0.5}
+	portfolio := make([]float64, len(months))
+	for i := range portfolio {
+		portfolio[i] = 0.5*returns["A"][i] + 0.5*returns["B"][i]
+	}
+	// a benchmark moving half as much as the portfolio, so beta is 2
+	benchmark := make([]float64, len(months))
+	for i, r := range portfolio {
+		benchmark[i] = r / 2
+	}
+	const rf = 0.001
+
+	r, err := analysis.RiskReport(weights, returns, benchmark, analysis.RiskConfig{RiskFreeRate: rf, Confidence: 0.9, Months: months})
+	if err != nil {
+		t.Fatalf("RiskReport: %v", err)
+	}
+	mean, sd := stat.MeanStdDev(portfolio, nil)
+	if math.Abs(r.AnnualReturn-12*mean) > 1e-15 || math.Abs(r.AnnualVolatility-math.Sqrt(12)*sd) > 1e-15 {
+		t.Errorf("annual return %v and volatility %v, want %v and %v", r.AnnualReturn, r.AnnualVolatility, 12*mean, math.Sqrt(12)*sd)
+	}
+
+	// wealth peaks at the close of January, bottoms in March, is back above it in June
+	dd := r.MaxDrawdown
+	if want := 1 - (1+portfolio[1])*(1+portfolio[2]); math.Abs(dd.Depth-want) > 1e-15 {
+		t.Errorf("drawdown %v, want %v", dd.Depth, want)
+	}
+	if dd.Peak != "2024-01" || dd.Trough != "2024-03" || dd.Recovery != "2024-06" {
+		t.Errorf("drawdown %s to %s recovered %s, want 2024-01 to 2024-03 recovered 2024-06", dd.Peak, dd.Trough, dd.Recovery)
+	}
+
+	// 10% of 10 months is the single worst one: only the 6% loss exceeds the
+	// 2% VaR, and it alone makes up the CVaR
+	if math.Abs(r.HistoricalVaR-0.02) > 1e-15 || math.Abs(r.HistoricalCVaR-0.06) > 1e-15 {
+		t.Errorf("historical VaR %v and CVaR %v, want 0.02 and 0.06", r.HistoricalVaR, r.HistoricalCVaR)
+	}
+	if r.ParametricCVaR <= r.ParametricVaR {
+		t.Errorf("parametric CVaR %v not beyond VaR %v", r.ParametricCVaR, r.ParametricVaR)
+	}
+
+	downside := 0.0
+	for _, x := range portfolio {
+		if x < rf {
+			downside += (x - rf) * (x - rf)
+		}
+	}
+	if want := (mean - rf) / math.Sqrt(downside/10) * math.Sqrt(12); math.Abs(r.Sortino-want) > 1e-12 {
+		t.Errorf("sortino %v, want %v", r.Sortino, want)
+	}
+	if want := r.CAGR / dd.Depth; r.Calmar != want {
+		t.Errorf("calmar %v, want %v", r.Calmar, want)
+	}
+	if got := r.Contributions.Component["A"] + r.Contributions.Component["B"]; math.Abs(got-sd) > 1e-15 {
+		t.Errorf("risk contributions sum to %v, want the monthly volatility %v", got, sd)
+	}
+
+	b := r.Benchmark
+	if b == nil {
+		t.Fatal("no benchmark comparison")
+	}
+	if math.Abs(b.Beta-2) > 1e-12 {
+		t.Errorf("beta %v, want 2", b.Beta)
+	}
+	// r = 2b exactly, so alpha is what the leverage does to the risk-free leg
+	if want := rf * 12; math.Abs(b.Alpha-want) > 1e-12 {
+		t.Errorf("alpha %v, want %v", b.Alpha, want)
+	}
+	if want := math.Sqrt(12) * sd / 2; math.Abs(b.TrackingError-want) > 1e-12 {
+		t.Errorf("tracking error %v, want %v", b.TrackingError, want)
+	}
+
+	if _, err := analysis.RiskReport(map[string]float64{"C": 1}, returns, nil, analysis.RiskConfig{}); err == nil {
+		t.Error("RiskReport accepted a ticker without returns")
+	}
+}
@@ -0,0 +1,144 @@
+package analysis
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"gonum.org/v1/gonum/mat"
+	"gonum.org/v1/gonum/stat"
+)
+
+// Factor-shock scenarios. Each holding's monthly returns are regressed on the
+// returns of the shocked factors together, and a hypothetical move in those
+// factors reaches the holding through its betas: Σₖ βₖ·shockₖ. The intercept
+// is left out since a shock is an instant move, not a month of drift.
+
+// ErrInvalidScenario is returned for shocks the factors cannot carry, such as
+// a factor without returns or two factors moving in lockstep.
+var ErrInvalidScenario = errors.New("invalid scenario")
+
+// FactorExposure is one holding's estimated response to the scenario.
+type FactorExposure struct {
+	Ticker   string
+	Weight   float64
+	Betas    map[string]float64 // by factor, from the joint regression
+	RSquared float64            // share of the holding's variance the factors explain
+	Impact   float64            // Σ β·shock, the holding's estimated return
+	PnL      float64            // Weight × Impact × the portfolio's value
+}
+
+// Scenario is the estimated effect of factor shocks on a portfolio.
+type Scenario struct {
+	Shocks  map[string]float64
+	Return  float64 // Σ Weight × Impact
+	PnL     float64 // Return × the portfolio's value
+	Periods int     // months each regression used
+
+	Exposures []FactorExposure // worst PnL first
+}
+
+// ScenarioResult is a scenario with the history its betas were fitted to.
+type ScenarioResult struct {
+	*Scenario
+	Months []string
+	Gaps   GapReport
+}
+
+// OrchestrateScenario aligns the monthly data of the weighted tickers, builds
+// every factor's returns over the same months and applies shocks, keyed by
+// factor name, to the portfolio holding weights and worth value.
+func OrchestrateScenario(monthly []*StockDataMonthly, weights map[string]float64, factors []*Benchmark, shocks map[string]float64, policy GapPolicy, value float64) (*ScenarioResult, error) {
+	if len(monthly) == 0 {
+		return nil, fmt.Errorf("no monthly data provided")
+	}
+	panel, err := AlignMonthlyReturns(monthly, policy)
+	if err != nil {
+		return nil, err
+	}
+	returns := make(map[string][]float64, len(factors))
+	for _, f := range factors {
+		if returns[f.Name], err = panel.BenchmarkReturns(f); err != nil {
+			return nil, fmt.Errorf("factor %s: %w", f.Name, err)
+		}
+	}
+	s, err := ShockScenario(weights, panel.Returns, returns, shocks, value)
+	if err != nil {
+		return nil, err
+	}
+	return &ScenarioResult{Scenario: s, Months: panel.Months, Gaps: panel.Gaps}, nil
+}
+
+// ShockScenario regresses every weighted ticker's returns on the factors
+// named in shocks and propagates the shocks through the betas. returns and
+// factors hold series of the same length.
+func ShockScenario(weights map[string]float64, returns, factors map[string][]float64, shocks map[string]float64, value float64) (*Scenario, error) {
+	if len(weights) == 0 {
+		return nil, errors.New("no weights provided")
+	}
+	if len(shocks) == 0 {
+		return nil, fmt.Errorf("%w: no shocks", ErrInvalidScenario)
+	}
+	names := sortedTickers(shocks)
+	var t int
+	for _, name := range names {
+		f, ok := factors[name]
+		if !ok {
+			return nil, fmt.Errorf("%w: no returns for factor %s", ErrInvalidScenario, name)
+		}
+		t = len(f)
+	}
+	// the intercept and one beta per factor, with a month to spare
+	if t < len(names)+2 {
+		return nil, fmt.Errorf("%w: have %d months for %d factors, need %d", ErrTooFewObservations, t, len(names), len(names)+2)
+	}
+
+	x := mat.NewDense(t, len(names)+1, nil)
+	for i := range t {
+		x.Set(i, 0, 1)
+		for k, name := range names {
+			if len(factors[name]) != t {
+				return nil, fmt.Errorf("factor %s has %d returns, factor %s %d", name, len(factors[name]), names[0], t)
+			}
+			x.Set(i, k+1, factors[name][i])
+		}
+	}
+	var qr mat.QR
+	qr.Factorize(x)
+	if cond := qr.Cond(); cond > 1e12 {
+		return nil, fmt.Errorf("%w: factors %v move too closely together to separate (condition number %.3g)", ErrInvalidScenario, names, cond)
+	}
+
+	s := &Scenario{Shocks: shocks, Periods: t}
+	for _, ticker := range sortedTickers(weights) {
+		r, ok := returns[ticker]
+		if !ok {
+			return nil, fmt.Errorf("%w: no returns for %s", ErrNoCommonHistory, ticker)
+		}
+		if len(r) != t {
+			return nil, fmt.Errorf("%s has %d returns, the factors %d", ticker, len(r), t)
+		}
+		var coef mat.Dense
+		if err := qr.SolveTo(&coef, false, mat.NewDense(t, 1, append([]float64(nil), r...))); err != nil {
+			return nil, fmt.Errorf("regressing %s: %w", ticker, err)
+		}
+
+		e := FactorExposure{Ticker: ticker, Weight: weights[ticker], Betas: make(map[string]float64, len(names))}
+		for k, name := range names {
+			beta := coef.At(k+1, 0)
+			e.Betas[name] = beta
+			e.Impact += beta * shocks[name]
+		}
+		var fitted mat.VecDense
+		fitted.MulVec(x, coef.ColView(0))
+		e.RSquared = stat.RSquaredFrom(fitted.RawVector().Data, r, nil)
+		e.PnL = e.Weight * e.Impact * value
+		s.Return += e.Weight * e.Impact
+		s.Exposures = append(s.Exposures, e)
+	}
+	s.PnL = s.Return * value
+	sort.SliceStable(s.Exposures, func(a, b int) bool {
+		return s.Exposures[a].Weight*s.Exposures[a].Impact < s.Exposures[b].Weight*s.Exposures[b].Impact
+	})
+	return s, nil
+}
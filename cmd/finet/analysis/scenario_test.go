@@ -0,0 +1,107 @@
+package analysis_test
+
+import (
+	"errors"
+	"math"
+	"testing"
+
+	"github.com/AndrewBrickweg/Finet_v2/cmd/finet/analysis"
+)
+
+func TestShockScenario(t *testing.T) {
+	const n = 36
+	market := make([]float64, n)
+	energy := make([]float64, n)
+	exact := make([]float64, n) // 1.2 market + 0.5 energy
+	noisy := make([]float64, n)
+	for i := range market {
+		market[i] = 0.01 + 0.04*math.Sin(float64(i))
+		energy[i] = 0.005 + 0.06*math.Cos(float64(3*i))
+		exact[i] = 0.001 + 1.2*market[i] + 0.5*energy[i]
+		noisy[i] = 0.8*market[i] - 0.3*energy[i] + 0.02*math.Sin(float64(7*i))
+	}
+	returns := map[string][]float64{"AAA": exact, "BBB": noisy}
+	factors := map[string][]float64{"market": market, "Energy": energy}
+	shocks := map[string]float64{"market": -0.2, "Energy": 0.1}
+	weights := map[string]float64{"AAA": 0.6, "BBB": 0.4}
+
+	s, err := analysis.ShockScenario(weights, returns, factors, shocks, 1e6)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Periods != n || len(s.Exposures) != 2 {
+		t.Fatalf("%d exposures over %d months", len(s.Exposures), s.Periods)
+	}
+	byTicker := map[string]analysis.FactorExposure{}
+	for _, e := range s.Exposures {
+		byTicker[e.Ticker] = e
+	}
+	a := byTicker["AAA"]
+	if math.Abs(a.Betas["market"]-1.2) > 1e-9 || math.Abs(a.Betas["Energy"]-0.5) > 1e-9 || math.Abs(a.RSquared-1) > 1e-9 {
+		t.Errorf("AAA betas %v with R² %v, want 1.2 and 0.5 fitting exactly", a.Betas, a.RSquared)
+	}
+	if math.Abs(a.Impact-(-0.19)) > 1e-9 || math.Abs(a.PnL-0.6*-0.19*1e6) > 1e-3 {
+		t.Errorf("AAA impact %v and P&L %v, want -0.19 and %v", a.Impact, a.PnL, 0.6*-0.19*1e6)
+	}
+	b := byTicker["BBB"]
+	if math.Abs(b.Betas["market"]-0.8) > 0.1 || math.Abs(b.Betas["Energy"]+0.3) > 0.1 || !(b.RSquared > 0.5 && b.RSquared < 1) {
+		t.Errorf("BBB betas %v with R² %v, want about 0.8 and -0.3", b.Betas, b.RSquared)
+	}
+	if want := 0.6*a.Impact + 0.4*b.Impact; math.Abs(s.Return-want) > 1e-12 || math.Abs(s.PnL-want*1e6) > 1e-6 {
+		t.Errorf("portfolio return %v and P&L %v, want %v", s.Return, s.PnL, want)
+	}
+	if s.Exposures[0].Ticker != "AAA" {
+		t.Errorf("worst exposure %s, want AAA", s.Exposures[0].Ticker)
+	}
+
+	// only the shocked factors enter the regression
+	marketOnly, err := analysis.ShockScenario(weights, returns, factors, map[string]float64{"market": -0.2}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := marketOnly.Exposures[0].Betas["Energy"]; ok {
+		t.Errorf("betas %v include an unshocked factor", marketOnly.Exposures[0].Betas)
+	}
+
+	t.Run("invalid", func(t *testing.T) {
+		doubled := make([]float64, n)
+		for i, m := range market {
+			doubled[i] = 2 * m
+		}
+		for name, tc := range map[string]struct {
+			factors map[string][]float64
+			shocks  map[string]float64
+			want    error
+		}{
+			"no shocks":      {factors, nil, analysis.ErrInvalidScenario},
+			"unknown factor": {factors, map[string]float64{"Utilities": 0.1}, analysis.ErrInvalidScenario},
+			"collinear":      {map[string][]float64{"market": market, "levered": doubled}, map[string]float64{"market": -0.2, "levered": 0.1}, analysis.ErrInvalidScenario},
+			"too few months": {map[string][]float64{"market": market[:2]}, map[string]float64{"market": -0.2}, analysis.ErrTooFewObservations},
+		} {
+			if _, err := analysis.ShockScenario(weights, returns, tc.factors, tc.shocks, 1); !errors.Is(err, tc.want) {
+				t.Errorf("%s: got error %v, want %v", name, err, tc.want)
+			}
+		}
+	})
+}
+
+func TestOrchestrateScenario(t *testing.T) {
+	data := backtestData(t)
+	panel, err := analysis.AlignMonthlyReturns(data, analysis.GapDrop)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a market index of both stocks; an equally weighted AAA and BBB moves
+	// one for one with it
+	market := &analysis.Benchmark{Name: "market", Constituents: data}
+	res, err := analysis.OrchestrateScenario(data, map[string]float64{"AAA": 0.5, "BBB": 0.5}, []*analysis.Benchmark{market}, map[string]float64{"market": -0.1}, analysis.GapDrop, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Months) != len(panel.Months) || res.Periods != len(panel.Months) {
+		t.Errorf("%d months and %d periods, want %d", len(res.Months), res.Periods, len(panel.Months))
+	}
+	if math.Abs(res.Return+0.1) > 1e-9 || math.Abs(res.PnL+10) > 1e-6 {
+		t.Errorf("return %v and P&L %v, want -0.1 and -10", res.Return, res.PnL)
+	}
+}
@@ -0,0 +1,154 @@
+package analysis
+
+import (
+	"errors"
+	"math"
+	"math/rand"
+	"sort"
+	"strings"
+
+	"gonum.org/v1/gonum/floats"
+)
+
+// Unclassified is the sector reported for tickers missing from the tickers table.
+const Unclassified = "Unclassified"
+
+// SectorBreakdown sums portfolio weights by sector.
+func SectorBreakdown(weights map[string]float64, sectors map[string]string) map[string]float64 {
+	breakdown := make(map[string]float64)
+	for t, w := range weights {
+		sector := sectors[t]
+		if sector == "" {
+			sector = Unclassified
+		}
+		breakdown[sector] += w
+	}
+	return breakdown
+}
+
+// BindingSectors lists the limited sectors whose combined weight sits at its
+// min or max: the limits that moved the optimizer off its unconstrained pick.
+func BindingSectors(weights map[string]float64, sectors map[string]string, limits []SectorLimit) []string {
+	var binding []string
+	for _, lim := range limits {
+		total := 0.0
+		for t, w := range weights {
+			if strings.EqualFold(sectors[t], lim.Sector) {
+				total += w
+			}
+		}
+		if total <= lim.Min+1e-6 || total >= lim.Max-1e-6 {
+			binding = append(binding, lim.Sector)
+		}
+	}
+	return binding
+}
+
+// sampleSectorWeights draws a random portfolio that satisfies the sector limits
+// by sampling sector totals first and then splitting each total across the
+// sector's tickers, so no draws are wasted on rejection. Weights follow the
+// order of tickers.
+func (c Constraints) sampleSectorWeights(tickers []string, randGen *rand.Rand, maxAttempts int) ([]float64, error) {
+	// sector names match case-insensitively, as in linearRows
+	limits := make(map[string]SectorLimit, len(c.SectorLimits))
+	for _, lim := range c.SectorLimits {
+		limits[strings.ToLower(lim.Sector)] = lim
+	}
+
+	members := make(map[string][]int)
+	for i, t := range tickers {
+		s := strings.ToLower(c.Sectors[t])
+		members[s] = append(members[s], i)
+	}
+	sectors := make([]string, 0, len(members))
+	for s := range members {
+		sectors = append(sectors, s)
+	}
+	sort.Strings(sectors)
+
+	lo := make([]float64, len(sectors))
+	hi := make([]float64, len(sectors))
+	for i, s := range sectors {
+		k := float64(len(members[s]))
+		lo[i], hi[i] = k*c.MinWeight, k*c.MaxWeight
+		if lim, ok := limits[s]; ok {
+			lo[i], hi[i] = math.Max(lo[i], lim.Min), math.Min(hi[i], lim.Max)
+		}
+	}
+
+	for attempt := 0; attempt < maxAttempts; attempt++ {
+		totals, ok := sampleBounded(lo, hi, 1, randGen)
+		if !ok {
+			return nil, ErrInfeasibleConstraints
+		}
+		weights := make([]float64, len(tickers))
+		valid := true
+		for i, s := range sectors {
+			k := len(members[s])
+			assetLo := make([]float64, k)
+			assetHi := make([]float64, k)
+			for j := range k {
+				assetLo[j], assetHi[j] = c.MinWeight, c.MaxWeight
+			}
+			split, ok := sampleBounded(assetLo, assetHi, totals[i], randGen)
+			if !ok {
+				valid = false
+				break
+			}
+			for j, idx := range members[s] {
+				weights[idx] = split[j]
+			}
+		}
+		if valid {
+			return weights, nil
+		}
+	}
+	return nil, errors.New("failed to generate sector-constrained weights after maxAttempts")
+}
+
+// sampleBounded draws x with lo[i] <= x[i] <= hi[i] and sum(x) = total. Like
+// generateWeightConstraints it starts at the lower bounds, splits the remainder
+// with exponential draws and hands any surplus above hi to the assets with room.
+func sampleBounded(lo, hi []float64, total float64, randGen *rand.Rand) ([]float64, bool) {
+	remaining := total - floats.Sum(lo)
+	if remaining < -1e-12 || floats.Sum(hi) < total-1e-12 {
+		return nil, false
+	}
+	x := append([]float64(nil), lo...)
+	if remaining <= 1e-12 {
+		return x, true
+	}
+
+	props := make([]float64, len(x))
+	for i := range props {
+		props[i] = randGen.ExpFloat64()
+	}
+	sumProps := floats.Sum(props)
+	for i := range x {
+		x[i] += remaining * props[i] / sumProps
+	}
+
+	for iter := 0; iter < 20; iter++ {
+		surplus := 0.0
+		for i := range x {
+			if x[i] > hi[i] {
+				surplus += x[i] - hi[i]
+				x[i] = hi[i]
+			}
+		}
+		if surplus <= 1e-12 {
+			break
+		}
+		room := 0.0
+		for i := range x {
+			room += hi[i] - x[i]
+		}
+		if room <= 1e-12 {
+			return nil, false
+		}
+		for i := range x {
+			x[i] += surplus * (hi[i] - x[i]) / room
+		}
+	}
+	return x, true
+}
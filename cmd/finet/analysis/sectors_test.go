@@ -0,0 +1,100 @@
+package analysis_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/AndrewBrickweg/Finet_v2/cmd/finet/analysis"
+)
+
+var mockSectors = map[string]string{
+	"IBM": "Information Technology", "AAPL": "Information Technology", "MSFT": "Information Technology",
+	"NVDA": "Information Technology", "INTC": "Information Technology",
+	"GOOG": "Communication Services", "NFLX": "Communication Services", "DIS": "Communication Services",
+	"AMZN": "Consumer Discretionary", "TSLA": "Consumer Discretionary", "BABA": "Consumer Discretionary",
+	"JPM": "Financials", "WMT": "Consumer Staples", "PFE": "Health Care",
+	// SPY is deliberately left unclassified
+}
+
+func TestSectorLimitsEveryMode(t *testing.T) {
+	returns := analysis.MonthlyStockReturns(analysis.ExtractMonthlyAdjClosePrices(MockStockData()))
+	limits := []analysis.SectorLimit{
+		{Sector: "Information Technology", Max: 0.30},
+		{Sector: "Financials", Min: 0.05, Max: 0.10},
+	}
+
+	modes := []analysis.OptimizerMode{
+		analysis.ModeMonteCarlo,
+		analysis.ModeMaxSharpe,
+		analysis.ModeMinVariance,
+		analysis.ModeTargetReturn,
+		analysis.ModeTargetRisk,
+		analysis.ModeRiskParity,
+		analysis.ModeHRP,
+	}
+	for _, mode := range modes {
+		cfg := analysis.OptimizerConfig{
+			Mode:          mode,
+			NumPortfolios: 2000,
+			Seed:          11,
+			MinWeight:     0.0,
+			MaxWeight:     0.20,
+			TargetReturn:  0.03,
+			TargetRisk:    0.01,
+			Sectors:       mockSectors,
+			SectorLimits:  limits,
+		}
+		_, best, err := analysis.Optimize(context.Background(), returns, cfg)
+		if err != nil {
+			t.Fatalf("%s: %v", mode, err)
+		}
+		checkWeights(t, best, cfg.MinWeight, cfg.MaxWeight)
+
+		breakdown := analysis.SectorBreakdown(best.Weights, mockSectors)
+		if it := breakdown["Information Technology"]; it > 0.30+1e-6 {
+			t.Errorf("%s: Information Technology weight %.4f above cap 0.30", mode, it)
+		}
+		if fin := breakdown["Financials"]; fin < 0.05-1e-6 || fin > 0.10+1e-6 {
+			t.Errorf("%s: Financials weight %.4f outside [0.05, 0.10]", mode, fin)
+		}
+		if _, ok := breakdown[analysis.Unclassified]; !ok {
+			t.Errorf("%s: breakdown missing %q bucket for SPY", mode, analysis.Unclassified)
+		}
+	}
+}
+
+func TestSectorLimitsInfeasible(t *testing.T) {
+	returns := analysis.MonthlyStockReturns(analysis.ExtractMonthlyAdjClosePrices(MockStockData()))
+	cfg := analysis.OptimizerConfig{
+		Mode:      analysis.ModeMaxSharpe,
+		MaxWeight: 0.20,
+		Sectors:   mockSectors,
+		// three 5% caps leave JPM, WMT, PFE and SPY at 20% each: at most 95% invested
+		SectorLimits: []analysis.SectorLimit{
+			{Sector: "Information Technology", Max: 0.05},
+			{Sector: "Communication Services", Max: 0.05},
+			{Sector: "Consumer Discretionary", Max: 0.05},
+		},
+	}
+	if _, _, err := analysis.Optimize(context.Background(), returns, cfg); !errors.Is(err, analysis.ErrInfeasibleConstraints) {
+		t.Fatalf("got %v, want ErrInfeasibleConstraints", err)
+	}
+}
+
+func TestSectorLimitsIgnoreCase(t *testing.T) {
+	returns := analysis.MonthlyStockReturns(analysis.ExtractMonthlyAdjClosePrices(MockStockData()))
+	cfg := analysis.OptimizerConfig{
+		Mode:         analysis.ModeMinVariance,
+		MaxWeight:    0.20,
+		Sectors:      mockSectors,
+		SectorLimits: []analysis.SectorLimit{{Sector: "information technology", Max: 0.05}},
+	}
+	_, best, err := analysis.Optimize(context.Background(), returns, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if it := analysis.SectorBreakdown(best.Weights, mockSectors)["Information Technology"]; it > 0.05+1e-6 {
+		t.Errorf("Information Technology weight %.4f above cap 0.05", it)
+	}
+}
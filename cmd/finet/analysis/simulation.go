@@ -0,0 +1,249 @@
+package analysis
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"strings"
+
+	"gonum.org/v1/gonum/mat"
+	"gonum.org/v1/gonum/stat"
+)
+
+// SimulationMethod selects how SimulateWealth draws future monthly returns.
+type SimulationMethod string
+
+const (
+	// SimulateNormal draws the holdings' returns from a multivariate normal
+	// with the sample mean and covariance. With the weights rebalanced every
+	// month the portfolio return of such a draw is itself normal, with mean
+	// wᵀμ and variance wᵀΣw, so that is what each month draws.
+	SimulateNormal SimulationMethod = "normal"
+	// SimulateBootstrap replays blocks of consecutive historical months, which
+	// keeps the fat tails, the correlations and some of the serial dependence
+	// the normal model leaves out.
+	SimulateBootstrap SimulationMethod = "bootstrap"
+)
+
+const (
+	DefaultSimulationPaths = 5000
+	DefaultBlockMonths     = 12
+)
+
+// WealthPercentiles are the percentiles SimulateWealth reports every month.
+var WealthPercentiles = []float64{0.05, 0.25, 0.5, 0.75, 0.95}
+
+// ParseSimulationMethod maps a request value onto a method. Empty selects
+// SimulateNormal.
+func ParseSimulationMethod(s string) (SimulationMethod, error) {
+	switch m := SimulationMethod(strings.ToLower(strings.TrimSpace(s))); m {
+	case "":
+		return SimulateNormal, nil
+	case SimulateNormal, SimulateBootstrap:
+		return m, nil
+	default:
+		return "", fmt.Errorf("unknown simulation method %q", s)
+	}
+}
+
+// SimulationConfig describes a wealth simulation. Amounts are in currency,
+// returns monthly.
+type SimulationConfig struct {
+	Method       SimulationMethod
+	Paths        int // 0 uses DefaultSimulationPaths
+	Months       int // horizon
+	BlockMonths  int // SimulateBootstrap only; 0 uses DefaultBlockMonths
+	Initial      float64
+	Contribution float64 // added at every month's close, after that month's return
+	Goal         float64 // optional wealth to reach by the horizon
+	Seed         int64   // identical seeds give identical paths, 0 picks one
+}
+
+// WealthBand is the spread of simulated wealth at one month's close.
+type WealthBand struct {
+	Month       int       // 1 is the close of the first simulated month
+	Contributed float64   // Initial plus the contributions so far
+	Percentiles []float64 // wealth at each of WealthPercentiles
+}
+
+// WealthSimulation is the distribution of wealth along the simulated paths.
+type WealthSimulation struct {
+	Method      SimulationMethod
+	Paths       int
+	Percentiles []float64 // the levels of every band's Percentiles
+	Bands       []WealthBand
+
+	MeanTerminal float64
+	// GoalProbability is the share of paths ending the horizon with at least
+	// the goal; zero without one.
+	GoalProbability float64
+
+	// MonthlyMean and MonthlyVolatility describe the returns the paths were
+	// drawn from: the normal model's, or the history's when bootstrapping.
+	MonthlyMean       float64
+	MonthlyVolatility float64
+	HistoryMonths     int
+}
+
+// SimulationResult is a wealth simulation with the history it was fitted to.
+type SimulationResult struct {
+	*WealthSimulation
+	Months []string
+	Gaps   GapReport
+}
+
+// OrchestrateSimulation aligns the monthly data of the weighted tickers and
+// simulates the wealth of the portfolio holding weights.
+func OrchestrateSimulation(ctx context.Context, monthly []*StockDataMonthly, weights map[string]float64, policy GapPolicy, cfg SimulationConfig) (*SimulationResult, error) {
+	if len(monthly) == 0 {
+		return nil, fmt.Errorf("no monthly data provided")
+	}
+	panel, err := AlignMonthlyReturns(monthly, policy)
+	if err != nil {
+		return nil, err
+	}
+	sim, err := SimulateWealth(ctx, weights, panel.Returns, cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &SimulationResult{WealthSimulation: sim, Months: panel.Months, Gaps: panel.Gaps}, nil
+}
+
+// SimulateWealth grows cfg.Initial along cfg.Paths random paths of the
+// portfolio holding weights, rebalanced monthly, adding the contribution at
+// every close. returns holds one aligned monthly series per weighted ticker.
+func SimulateWealth(ctx context.Context, weights map[string]float64, returns map[string][]float64, cfg SimulationConfig) (*WealthSimulation, error) {
+	if cfg.Months < 1 {
+		return nil, fmt.Errorf("simulation horizon must be at least 1 month, got %d", cfg.Months)
+	}
+	if cfg.Paths == 0 {
+		cfg.Paths = DefaultSimulationPaths
+	}
+	if cfg.Paths < 1 {
+		return nil, fmt.Errorf("simulation needs at least 1 path, got %d", cfg.Paths)
+	}
+	series, err := weightedReturns(weights, returns)
+	if err != nil {
+		return nil, err
+	}
+	if len(series) < 2 {
+		return nil, fmt.Errorf("%w: have %d, need 2", ErrTooFewObservations, len(series))
+	}
+	draw, mean, sd, err := cfg.sampler(weights, returns, series)
+	if err != nil {
+		return nil, err
+	}
+
+	sim := &WealthSimulation{
+		Method:            cfg.Method,
+		Paths:             cfg.Paths,
+		Percentiles:       WealthPercentiles,
+		MonthlyMean:       mean,
+		MonthlyVolatility: sd,
+		HistoryMonths:     len(series),
+	}
+	if sim.Method == "" {
+		sim.Method = SimulateNormal
+	}
+
+	// wealth[t][p] is path p at the close of month t+1
+	wealth := make([][]float64, cfg.Months)
+	for t := range wealth {
+		wealth[t] = make([]float64, cfg.Paths)
+	}
+	rng := newRand(cfg.Seed)
+	path := make([]float64, cfg.Months)
+	reached := 0
+	for p := range cfg.Paths {
+		if p%256 == 0 {
+			if err := ctx.Err(); err != nil {
+				return nil, fmt.Errorf("wealth simulation stopped: %w", err)
+			}
+		}
+		draw(rng, path)
+		w := cfg.Initial
+		for t, r := range path {
+			w = math.Max(w*(1+r)+cfg.Contribution, 0)
+			wealth[t][p] = w
+		}
+		sim.MeanTerminal += w / float64(cfg.Paths)
+		if w >= cfg.Goal {
+			reached++
+		}
+	}
+	if cfg.Goal > 0 {
+		sim.GoalProbability = float64(reached) / float64(cfg.Paths)
+	}
+
+	for t, column := range wealth {
+		sort.Float64s(column)
+		band := WealthBand{
+			Month:       t + 1,
+			Contributed: cfg.Initial + cfg.Contribution*float64(t+1),
+			Percentiles: make([]float64, len(WealthPercentiles)),
+		}
+		for k, q := range WealthPercentiles {
+			band.Percentiles[k] = stat.Quantile(q, stat.Empirical, column, nil)
+		}
+		sim.Bands = append(sim.Bands, band)
+	}
+	return sim, nil
+}
+
+// sampler returns a function filling a path with monthly portfolio returns,
+// and the mean and volatility of the returns it draws.
+func (cfg SimulationConfig) sampler(weights map[string]float64, returns map[string][]float64, series []float64) (func(*rand.Rand, []float64), float64, float64, error) {
+	switch cfg.Method {
+	case SimulateNormal, "":
+		held := make(map[string][]float64, len(weights))
+		for ticker := range weights {
+			held[ticker] = returns[ticker]
+		}
+		in := NewUniverse(held)
+		w := mat.NewVecDense(in.Len(), nil)
+		for i, t := range in.Tickers {
+			w.SetVec(i, weights[t])
+		}
+		point := in.evaluate(w, 0)
+		mean, sd := point.Return, point.Risk
+		return func(rng *rand.Rand, path []float64) {
+			for t := range path {
+				path[t] = mean + sd*rng.NormFloat64()
+			}
+		}, mean, sd, nil
+
+	case SimulateBootstrap:
+		block := cfg.BlockMonths
+		if block == 0 {
+			block = DefaultBlockMonths
+		}
+		if block < 1 {
+			return nil, 0, 0, fmt.Errorf("bootstrap blocks must be at least 1 month, got %d", block)
+		}
+		if block > len(series) {
+			return nil, 0, 0, fmt.Errorf("%w: bootstrap blocks of %d months need as much history, have %d", ErrTooFewObservations, block, len(series))
+		}
+		mean, sd := stat.MeanStdDev(series, nil)
+		return func(rng *rand.Rand, path []float64) {
+			bootstrapPath(rng, series, block, path)
+		}, mean, sd, nil
+
+	default:
+		return nil, 0, 0, fmt.Errorf("unknown simulation method %q", cfg.Method)
+	}
+}
+
+// bootstrapPath fills path with blocks of block consecutive months of
+// history, each starting at a random month and wrapping around its end, the
+// circular block bootstrap of Politis and Romano (1992).
+func bootstrapPath(rng *rand.Rand, history []float64, block int, path []float64) {
+	for t := 0; t < len(path); {
+		start := rng.Intn(len(history))
+		for k := 0; k < block && t < len(path); k++ {
+			path[t] = history[(start+k)%len(history)]
+			t++
+		}
+	}
+}
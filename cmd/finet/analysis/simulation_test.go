@@ -0,0 +1,123 @@
+package analysis_test
+
+import (
+	"context"
+	"math"
+	"testing"
+
+	"github.com/AndrewBrickweg/Finet_v2/cmd/finet/analysis"
+)
+
+func TestSimulateWealth(t *testing.T) {
+	data := backtestData(t)
+	panel, err := analysis.AlignMonthlyReturns(data, analysis.GapDrop)
+	if err != nil {
+		t.Fatal(err)
+	}
+	weights := map[string]float64{"AAA": 0.6, "BBB": 0.4}
+	ctx := context.Background()
+
+	t.Run("constant returns", func(t *testing.T) {
+		flat := map[string][]float64{"AAA": {0.01, 0.01, 0.01}, "BBB": {0.01, 0.01, 0.01}}
+		for _, method := range []analysis.SimulationMethod{analysis.SimulateNormal, analysis.SimulateBootstrap} {
+			sim, err := analysis.SimulateWealth(ctx, weights, flat, analysis.SimulationConfig{
+				Method: method, Paths: 50, Months: 24, BlockMonths: 2, Initial: 1000, Contribution: 100, Goal: 3500,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := 1000.0
+			for i, band := range sim.Bands {
+				want = want*1.01 + 100
+				if band.Month != i+1 || band.Contributed != 1000+100*float64(i+1) {
+					t.Fatalf("%s: band %d is month %d with %v contributed", method, i, band.Month, band.Contributed)
+				}
+				for _, w := range band.Percentiles {
+					if math.Abs(w-want) > 1e-9 {
+						t.Fatalf("%s: month %d wealth %v, want %v", method, band.Month, band.Percentiles, want)
+					}
+				}
+			}
+			// 1000·1.01²⁴ + 100·(1.01²⁴-1)/0.01 is about 3967
+			if sim.GoalProbability != 1 {
+				t.Errorf("%s: goal reached with probability %v, want 1", method, sim.GoalProbability)
+			}
+		}
+	})
+
+	t.Run("bootstrap of the whole history", func(t *testing.T) {
+		// a single block covering the history is a rotation of it, so every
+		// path compounds to the same wealth
+		series := make([]float64, len(panel.Months))
+		growth := 1.0
+		for i := range series {
+			series[i] = 0.6*panel.Returns["AAA"][i] + 0.4*panel.Returns["BBB"][i]
+			growth *= 1 + series[i]
+		}
+		sim, err := analysis.SimulateWealth(ctx, weights, panel.Returns, analysis.SimulationConfig{
+			Method: analysis.SimulateBootstrap, Paths: 100, Months: len(series), BlockMonths: len(series), Initial: 1,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		last := sim.Bands[len(sim.Bands)-1]
+		for _, w := range last.Percentiles {
+			if math.Abs(w-growth) > 1e-9 {
+				t.Fatalf("terminal wealth %v, want %v on every path", last.Percentiles, growth)
+			}
+		}
+		if sim.GoalProbability != 0 {
+			t.Errorf("goal probability %v without a goal", sim.GoalProbability)
+		}
+	})
+
+	t.Run("normal", func(t *testing.T) {
+		cfg := analysis.SimulationConfig{Paths: 4000, Months: 120, Initial: 1000, Goal: 6000, Seed: 7}
+		sim, err := analysis.SimulateWealth(ctx, weights, panel.Returns, cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		again, err := analysis.SimulateWealth(ctx, weights, panel.Returns, cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if sim.MeanTerminal != again.MeanTerminal || sim.GoalProbability != again.GoalProbability {
+			t.Errorf("seed %d gave %v and then %v", cfg.Seed, sim.MeanTerminal, again.MeanTerminal)
+		}
+		if sim.Method != analysis.SimulateNormal || len(sim.Bands) != 120 || sim.HistoryMonths != 36 {
+			t.Errorf("%s simulation with %d bands over %d months of history", sim.Method, len(sim.Bands), sim.HistoryMonths)
+		}
+		for _, band := range sim.Bands {
+			for k := 1; k < len(band.Percentiles); k++ {
+				if band.Percentiles[k] < band.Percentiles[k-1] {
+					t.Fatalf("month %d percentiles out of order: %v", band.Month, band.Percentiles)
+				}
+			}
+		}
+		// without contributions the expected terminal wealth is 1000(1+μ)ᵀ
+		want := 1000 * math.Pow(1+sim.MonthlyMean, 120)
+		if math.Abs(sim.MeanTerminal-want)/want > 0.05 {
+			t.Errorf("mean terminal wealth %v, want about %v", sim.MeanTerminal, want)
+		}
+		// the goal lies between the 5th and 25th percentiles of terminal wealth
+		terminal := sim.Bands[119].Percentiles
+		if !(terminal[0] < cfg.Goal && cfg.Goal < terminal[1]) {
+			t.Fatalf("goal %v outside the 5th to 25th percentile band %v", cfg.Goal, terminal[:2])
+		}
+		if sim.GoalProbability <= 0.75 || sim.GoalProbability >= 0.95 {
+			t.Errorf("goal probability %v, want between 0.75 and 0.95", sim.GoalProbability)
+		}
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		for name, cfg := range map[string]analysis.SimulationConfig{
+			"no horizon":     {Initial: 1},
+			"unknown method": {Method: "garch", Months: 12},
+			"block too long": {Method: analysis.SimulateBootstrap, Months: 12, BlockMonths: 37},
+		} {
+			if _, err := analysis.SimulateWealth(ctx, weights, panel.Returns, cfg); err == nil {
+				t.Errorf("%s: no error", name)
+			}
+		}
+	})
+}
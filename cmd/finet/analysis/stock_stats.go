@@ -25,7 +25,7 @@ func MonthlyStockReturns(adjClose map[string][]float64) map[string][]float64 {
     return returns
 }
 
-//Will use SPY as market benchmark
+//Market returns come from ReturnPanel.BenchmarkReturns, SPY unless the request picks another benchmark
 func BetaCoefficients(returns map[string][]float64, marketReturns []float64) map[string]float64 {
 	betas := make(map[string]float64)
 
@@ -49,7 +49,7 @@ func BetaCoefficients(returns map[string][]float64, marketReturns []float64) map
 }
 
 
-//Using arithmetic mean for simplicity, geometric mean can be implemented if needed
+//Arithmetic mean, the default estimator; see expected_returns.go for geometric, EWMA and CAPM
 func ExpectedReturn(returns map[string][]float64) map[string]float64 {
 	expected := make(map[string]float64)
 
@@ -0,0 +1,310 @@
+package analysis
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Historical stress tests. A portfolio is bought at the first close of a
+// window and held, without rebalancing, through it; the deepest fall inside
+// the window is then followed past its end until the portfolio is back at
+// its peak. Holdings without prices for the whole window are listed rather
+// than dropped, and a MissingPolicy says what happens to their weight.
+
+// ErrMissingHistory is returned under MissingReject when a holding has no
+// prices for part of a stress window.
+var ErrMissingHistory = errors.New("holding has no prices for the whole window")
+
+// maxStaleDays is how long before a window starts, or before it ends, a
+// holding's nearest close may be and still count as trading then.
+const maxStaleDays = 7
+
+// DailySeries holds a ticker's adjusted closes, dates "2006-01-02" ascending.
+type DailySeries struct {
+	Dates  []string
+	Closes []float64
+}
+
+// StressWindow is a stretch of history to replay, both dates inclusive.
+type StressWindow struct {
+	Name  string
+	Start string // "2006-01-02"
+	End   string
+}
+
+// StressWindows are the crises every stress test can name, each running from
+// the S&P 500's peak to its trough.
+var StressWindows = []StressWindow{
+	{Name: "black_monday_1987", Start: "1987-08-25", End: "1987-12-04"},
+	{Name: "dotcom_2000", Start: "2000-03-24", End: "2002-10-09"},
+	{Name: "financial_crisis_2008", Start: "2007-10-09", End: "2009-03-09"},
+	{Name: "covid_2020", Start: "2020-02-19", End: "2020-03-23"},
+}
+
+// StressWindowNamed looks up one of StressWindows.
+func StressWindowNamed(name string) (StressWindow, bool) {
+	for _, w := range StressWindows {
+		if w.Name == strings.ToLower(strings.TrimSpace(name)) {
+			return w, true
+		}
+	}
+	return StressWindow{}, false
+}
+
+// Validate checks the window's dates.
+func (w StressWindow) Validate() error {
+	start, err := time.Parse(time.DateOnly, w.Start)
+	if err != nil {
+		return fmt.Errorf("window %s: start must be a date like 2008-09-15, got %q", w.Name, w.Start)
+	}
+	end, err := time.Parse(time.DateOnly, w.End)
+	if err != nil {
+		return fmt.Errorf("window %s: end must be a date like 2008-09-15, got %q", w.Name, w.End)
+	}
+	if !end.After(start) {
+		return fmt.Errorf("window %s: start %s is not before end %s", w.Name, w.Start, w.End)
+	}
+	return nil
+}
+
+// MissingPolicy says what a stress test does with the weight of holdings
+// without prices for the whole window.
+type MissingPolicy string
+
+const (
+	MissingRenormalize MissingPolicy = "renormalize" // spread it over the other holdings in proportion
+	MissingCash        MissingPolicy = "cash"        // hold it as cash earning nothing
+	MissingReject      MissingPolicy = "reject"      // fail with ErrMissingHistory
+)
+
+// ParseMissingPolicy maps a request value onto a policy. Empty selects
+// MissingRenormalize.
+func ParseMissingPolicy(s string) (MissingPolicy, error) {
+	switch p := MissingPolicy(strings.ToLower(strings.TrimSpace(s))); p {
+	case "":
+		return MissingRenormalize, nil
+	case MissingRenormalize, MissingCash, MissingReject:
+		return p, nil
+	default:
+		return "", fmt.Errorf("unknown missing policy %q", s)
+	}
+}
+
+// MissingHolding is a holding left out of a stress window.
+type MissingHolding struct {
+	Ticker string
+	Weight float64
+	Reason string // e.g. "first close 2004-08-19"
+}
+
+// StressContribution is one holding's part in a stress window. The
+// contributions of all holdings add up to the portfolio's Return and to
+// minus its drawdown Depth.
+type StressContribution struct {
+	Ticker               string
+	Weight               float64 // as bought, after the missing policy
+	Return               float64 // the holding's own, over the window
+	Contribution         float64 // to the portfolio's return over the window
+	DrawdownContribution float64 // to its return from the peak to the trough
+}
+
+// StressResult is a portfolio's replay of one window.
+type StressResult struct {
+	Window StressWindow
+	Start  string // first close replayed
+	End    string // last close replayed
+	Days   int    // closes replayed; 0 when no holding traded through the window
+
+	Return   float64
+	Drawdown Drawdown // dates are days; Recovery may come after End
+	// RecoveryDays counts calendar days from the trough back to the peak's
+	// value; 0 while the portfolio has not recovered in the stored data.
+	RecoveryDays int `json:",omitempty"`
+
+	Contributions []StressContribution // worst drawdown contribution first
+	Missing       []MissingHolding     `json:",omitempty"`
+	Coverage      float64              // share of the weight that was replayed
+	Policy        MissingPolicy
+}
+
+// StressTest replays the portfolio holding weights over every window. daily
+// needs an entry, possibly empty, for every weighted ticker.
+func StressTest(weights map[string]float64, daily map[string]DailySeries, windows []StressWindow, policy MissingPolicy) ([]StressResult, error) {
+	if len(weights) == 0 {
+		return nil, errors.New("no weights provided")
+	}
+	if policy == "" {
+		policy = MissingRenormalize
+	}
+	results := make([]StressResult, 0, len(windows))
+	for _, w := range windows {
+		if err := w.Validate(); err != nil {
+			return nil, err
+		}
+		r, err := stressWindow(weights, daily, w, policy)
+		if err != nil {
+			return nil, fmt.Errorf("window %s: %w", w.Name, err)
+		}
+		results = append(results, *r)
+	}
+	return results, nil
+}
+
+func stressWindow(weights map[string]float64, daily map[string]DailySeries, w StressWindow, policy MissingPolicy) (*StressResult, error) {
+	res := &StressResult{Window: w, Policy: policy, Contributions: []StressContribution{}}
+
+	// a holding is replayed if it has a close within maxStaleDays before the
+	// window starts, not after, and one within maxStaleDays before it ends
+	startFrom := addDays(w.Start, -maxStaleDays)
+	endFrom := addDays(w.End, -maxStaleDays)
+	var held []string
+	for _, t := range sortedTickers(weights) {
+		s := daily[t]
+		// s's first close after the window starts
+		k := sort.Search(len(s.Dates), func(i int) bool { return s.Dates[i] > w.Start })
+		switch {
+		case len(s.Dates) == 0:
+			res.Missing = append(res.Missing, MissingHolding{Ticker: t, Weight: weights[t], Reason: "no stored prices"})
+		case k == 0:
+			res.Missing = append(res.Missing, MissingHolding{Ticker: t, Weight: weights[t], Reason: "first close " + s.Dates[0]})
+		case s.Dates[k-1] < startFrom:
+			res.Missing = append(res.Missing, MissingHolding{Ticker: t, Weight: weights[t], Reason: "last close " + s.Dates[k-1]})
+		case s.Dates[len(s.Dates)-1] < endFrom:
+			res.Missing = append(res.Missing, MissingHolding{Ticker: t, Weight: weights[t], Reason: "last close " + s.Dates[len(s.Dates)-1]})
+		default:
+			held = append(held, t)
+			res.Coverage += weights[t]
+		}
+	}
+	if len(res.Missing) > 0 && policy == MissingReject {
+		var names []string
+		for _, m := range res.Missing {
+			names = append(names, fmt.Sprintf("%s (%s)", m.Ticker, m.Reason))
+		}
+		return nil, fmt.Errorf("%w: %s", ErrMissingHistory, strings.Join(names, ", "))
+	}
+	if len(held) == 0 || res.Coverage == 0 {
+		return res, nil
+	}
+
+	// every trading day from the window's start to the end of the data
+	seen := make(map[string]bool)
+	var days []string
+	for _, t := range held {
+		for _, d := range daily[t].Dates {
+			if d >= w.Start && !seen[d] {
+				seen[d] = true
+				days = append(days, d)
+			}
+		}
+	}
+	sort.Strings(days)
+	last := sort.SearchStrings(days, w.End+"\xff") - 1
+	if last < 1 {
+		return res, nil
+	}
+
+	// value[i] is the portfolio on days[i] per unit bought at the start
+	cash := 0.0
+	if policy == MissingCash {
+		cash = 1 - res.Coverage
+	}
+	bought := make(map[string]float64, len(held))
+	prices := make(map[string][]float64, len(held))
+	for _, t := range held {
+		bought[t] = weights[t]
+		if policy == MissingRenormalize {
+			bought[t] /= res.Coverage
+		}
+		prices[t] = closesOn(daily[t], days)
+	}
+	value := make([]float64, len(days))
+	for i := range days {
+		value[i] = cash
+		for _, t := range held {
+			value[i] += bought[t] * prices[t][i] / prices[t][0]
+		}
+	}
+
+	res.Start, res.End, res.Days = days[0], days[last], last+1
+	res.Return = value[last] - 1
+
+	peak, trough := 0, 0
+	for i, top := 0, 0; i <= last; i++ {
+		if value[i] > value[top] {
+			top = i
+		}
+		if value[i]/value[top] < value[trough]/value[peak] {
+			peak, trough = top, i
+		}
+	}
+	if trough > peak {
+		res.Drawdown = Drawdown{Depth: 1 - value[trough]/value[peak], Peak: days[peak], Trough: days[trough]}
+		for i := trough + 1; i < len(days); i++ {
+			if value[i] >= value[peak] {
+				res.Drawdown.Recovery = days[i]
+				res.RecoveryDays = daysBetween(days[trough], days[i])
+				break
+			}
+		}
+	}
+
+	for _, t := range held {
+		p := prices[t]
+		c := StressContribution{
+			Ticker:       t,
+			Weight:       bought[t],
+			Return:       p[last]/p[0] - 1,
+			Contribution: bought[t] * (p[last] - p[0]) / p[0],
+		}
+		if trough > peak {
+			c.DrawdownContribution = bought[t] * (p[trough] - p[peak]) / p[0] / value[peak]
+		}
+		res.Contributions = append(res.Contributions, c)
+	}
+	sort.SliceStable(res.Contributions, func(a, b int) bool {
+		x, y := res.Contributions[a], res.Contributions[b]
+		if x.DrawdownContribution != y.DrawdownContribution {
+			return x.DrawdownContribution < y.DrawdownContribution
+		}
+		return x.Contribution < y.Contribution
+	})
+	return res, nil
+}
+
+// closesOn returns s's close on each of days, carrying the last close forward
+// over days it did not trade. s needs a close on or before days[0].
+func closesOn(s DailySeries, days []string) []float64 {
+	out := make([]float64, len(days))
+	k := sort.SearchStrings(s.Dates, days[0])
+	if k == len(s.Dates) || s.Dates[k] != days[0] {
+		k--
+	}
+	for i, d := range days {
+		for k+1 < len(s.Dates) && s.Dates[k+1] <= d {
+			k++
+		}
+		out[i] = s.Closes[k]
+	}
+	return out
+}
+
+func addDays(date string, n int) string {
+	t, err := time.Parse(time.DateOnly, date)
+	if err != nil {
+		return date
+	}
+	return t.AddDate(0, 0, n).Format(time.DateOnly)
+}
+
+func daysBetween(from, to string) int {
+	a, err1 := time.Parse(time.DateOnly, from)
+	b, err2 := time.Parse(time.DateOnly, to)
+	if err1 != nil || err2 != nil {
+		return 0
+	}
+	return int(b.Sub(a).Hours() / 24)
+}
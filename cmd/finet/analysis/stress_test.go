@@ -0,0 +1,147 @@
+package analysis_test
+
+import (
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/AndrewBrickweg/Finet_v2/cmd/finet/analysis"
+)
+
+// dailySeries builds a close for every calendar day from first to last.
+func dailySeries(first, last string, price func(date string) float64) analysis.DailySeries {
+	var s analysis.DailySeries
+	d, _ := time.Parse(time.DateOnly, first)
+	for ; d.Format(time.DateOnly) <= last; d = d.AddDate(0, 0, 1) {
+		s.Dates = append(s.Dates, d.Format(time.DateOnly))
+		s.Closes = append(s.Closes, price(d.Format(time.DateOnly)))
+	}
+	return s
+}
+
+func TestStressTest(t *testing.T) {
+	daily := map[string]analysis.DailySeries{
+		// falls 40% into the window, half recovers by its end and the rest in February
+		"AAA": dailySeries("2007-12-01", "2008-03-31", func(d string) float64 {
+			switch {
+			case d < "2008-01-12":
+				return 100
+			case d < "2008-01-15":
+				return 80
+			case d == "2008-01-15":
+				return 60
+			case d < "2008-02-01":
+				return 70
+			}
+			return 100
+		}),
+		"BBB": dailySeries("2007-12-01", "2008-03-31", func(d string) float64 {
+			if d == "2008-01-15" {
+				return 55
+			}
+			return 50
+		}),
+		"CCC": dailySeries("2008-03-01", "2008-03-31", func(string) float64 { return 10 }),
+	}
+	weights := map[string]float64{"AAA": 0.5, "BBB": 0.3, "CCC": 0.2}
+	window := analysis.StressWindow{Name: "test", Start: "2008-01-10", End: "2008-01-20"}
+
+	t.Run("renormalize", func(t *testing.T) {
+		results, err := analysis.StressTest(weights, daily, []analysis.StressWindow{window}, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		r := results[0]
+		if r.Start != "2008-01-10" || r.End != "2008-01-20" || r.Days != 11 || r.Policy != analysis.MissingRenormalize {
+			t.Errorf("replayed %s to %s, %d days under %s", r.Start, r.End, r.Days, r.Policy)
+		}
+		if len(r.Missing) != 1 || r.Missing[0].Ticker != "CCC" || r.Missing[0].Reason != "first close 2008-03-01" || math.Abs(r.Coverage-0.8) > 1e-12 {
+			t.Errorf("missing %+v with coverage %v, want CCC listed late and 0.8", r.Missing, r.Coverage)
+		}
+		// 0.625 of AAA and 0.375 of BBB
+		if want := 0.625*0.7 + 0.375 - 1; math.Abs(r.Return-want) > 1e-12 {
+			t.Errorf("return %v, want %v", r.Return, want)
+		}
+		dd := r.Drawdown
+		if want := 1 - (0.625*0.6 + 0.375*1.1); math.Abs(dd.Depth-want) > 1e-12 || dd.Peak != "2008-01-10" || dd.Trough != "2008-01-15" {
+			t.Errorf("drawdown %+v, want %v from 2008-01-10 to 2008-01-15", dd, want)
+		}
+		if dd.Recovery != "2008-02-01" || r.RecoveryDays != 17 {
+			t.Errorf("recovered %s after %d days, want 2008-02-01 after 17", dd.Recovery, r.RecoveryDays)
+		}
+
+		worst := r.Contributions[0]
+		if worst.Ticker != "AAA" || math.Abs(worst.DrawdownContribution+0.25) > 1e-12 || math.Abs(worst.Return+0.3) > 1e-12 {
+			t.Errorf("worst contributor %+v, want AAA taking 0.25 off", worst)
+		}
+		total, ddTotal := 0.0, 0.0
+		for _, c := range r.Contributions {
+			total += c.Contribution
+			ddTotal += c.DrawdownContribution
+		}
+		if math.Abs(total-r.Return) > 1e-12 || math.Abs(ddTotal+dd.Depth) > 1e-12 {
+			t.Errorf("contributions add up to %v and %v, want %v and %v", total, ddTotal, r.Return, -dd.Depth)
+		}
+	})
+
+	t.Run("cash", func(t *testing.T) {
+		results, err := analysis.StressTest(weights, daily, []analysis.StressWindow{window}, analysis.MissingCash)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := 1 - (0.2 + 0.5*0.6 + 0.3*1.1); math.Abs(results[0].Drawdown.Depth-want) > 1e-12 {
+			t.Errorf("depth %v with CCC's weight in cash, want %v", results[0].Drawdown.Depth, want)
+		}
+	})
+
+	t.Run("reject", func(t *testing.T) {
+		if _, err := analysis.StressTest(weights, daily, []analysis.StressWindow{window}, analysis.MissingReject); !errors.Is(err, analysis.ErrMissingHistory) {
+			t.Errorf("got error %v, want ErrMissingHistory", err)
+		}
+	})
+
+	t.Run("listed during the window", func(t *testing.T) {
+		late := map[string]analysis.DailySeries{
+			"AAA": daily["AAA"],
+			"DDD": dailySeries("2008-01-13", "2008-03-31", func(string) float64 { return 20 }),
+		}
+		results, err := analysis.StressTest(map[string]float64{"AAA": 0.5, "DDD": 0.5}, late, []analysis.StressWindow{window}, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		r := results[0]
+		if len(r.Missing) != 1 || r.Missing[0].Ticker != "DDD" || r.Missing[0].Reason != "first close 2008-01-13" || r.Coverage != 0.5 {
+			t.Errorf("missing %+v with coverage %v, want DDD listed three days in and 0.5", r.Missing, r.Coverage)
+		}
+		// AAA alone, not DDD held flat from the start
+		if want := 1 - 0.6; math.Abs(r.Drawdown.Depth-want) > 1e-12 {
+			t.Errorf("depth %v, want %v", r.Drawdown.Depth, want)
+		}
+	})
+
+	t.Run("nothing traded", func(t *testing.T) {
+		covid, ok := analysis.StressWindowNamed("COVID_2020")
+		if !ok {
+			t.Fatal("covid_2020 is not a named window")
+		}
+		results, err := analysis.StressTest(weights, daily, []analysis.StressWindow{covid}, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r := results[0]; r.Days != 0 || len(r.Missing) != 3 || r.Coverage != 0 {
+			t.Errorf("replayed %d days with %d missing, want none replayed and all three missing", r.Days, len(r.Missing))
+		}
+	})
+
+	t.Run("invalid window", func(t *testing.T) {
+		for _, w := range []analysis.StressWindow{
+			{Name: "backwards", Start: "2008-02-01", End: "2008-01-01"},
+			{Name: "month only", Start: "2008-01", End: "2008-02"},
+		} {
+			if _, err := analysis.StressTest(weights, daily, []analysis.StressWindow{w}, ""); err == nil {
+				t.Errorf("%s: no error", w.Name)
+			}
+		}
+	})
+}
@@ -0,0 +1,104 @@
+package analysis
+
+import (
+	"fmt"
+	"math"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// Universe fixes the asset order shared by every vector and matrix the
+// optimizers work with: element i of Mean, row and column i of Cov and
+// weight i of any portfolio all refer to Tickers[i].
+type Universe struct {
+	Tickers   []string
+	Mean      *mat.VecDense // expected return per period, arithmetic unless chosen otherwise
+	Cov       *mat.SymDense // covariance per period, sample unless chosen otherwise
+	Frequency Frequency     // spacing of the return series
+
+	index map[string]int
+}
+
+// NewUniverse orders the tickers alphabetically and computes their expected
+// returns and sample covariance.
+func NewUniverse(returns map[string][]float64) *Universe {
+	in, _ := NewUniverseWith(returns, Estimators{})
+	return in
+}
+
+// NewUniverseWith is NewUniverse with the estimators chosen by est.
+// The default arithmetic mean and sample covariance never fail.
+func NewUniverseWith(returns map[string][]float64, est Estimators) (*Universe, error) {
+	tickers := sortedTickers(returns)
+	expectedReturns, err := est.expected(returns)
+	if err != nil {
+		return nil, fmt.Errorf("%s expected returns: %w", est.Returns, err)
+	}
+
+	// gonum has no zero-length vectors, so an empty universe keeps the zero value
+	mean := &mat.VecDense{}
+	cov := &mat.SymDense{}
+	if len(tickers) > 0 {
+		mean = mat.NewVecDense(len(tickers), nil)
+		if cov, err = est.covariance(tickers, returns); err != nil {
+			return nil, fmt.Errorf("%s covariance: %w", est.Covariance, err)
+		}
+	}
+	index := make(map[string]int, len(tickers))
+	for i, t := range tickers {
+		mean.SetVec(i, expectedReturns[t])
+		index[t] = i
+	}
+
+	return &Universe{
+		Tickers:   tickers,
+		Mean:      mean,
+		Cov:       cov,
+		Frequency: est.Frequency.orMonthly(),
+		index:     index,
+	}, nil
+}
+
+// Len is the number of assets.
+func (in *Universe) Len() int {
+	return len(in.Tickers)
+}
+
+// Index returns the position of ticker in the universe.
+func (in *Universe) Index(ticker string) (int, bool) {
+	i, ok := in.index[ticker]
+	return i, ok
+}
+
+// WeightMap labels a weight vector with its tickers for the JSON output.
+func (in *Universe) WeightMap(w mat.Vector) map[string]float64 {
+	weights := make(map[string]float64, len(in.Tickers))
+	for i, t := range in.Tickers {
+		weights[t] = w.AtVec(i)
+	}
+	return weights
+}
+
+// evaluate returns the expected return, risk and Sharpe ratio of w.
+func (in *Universe) evaluate(w *mat.VecDense, riskFreeRate float64) RiskReturnPoint {
+	portReturn := mat.Dot(in.Mean, w)
+	portRisk := math.Sqrt(math.Max(mat.Inner(w, in.Cov, w), 0))
+
+	// Calculate Sharpe ratio
+	sharpe := 0.0
+	if portRisk != 0 {
+		sharpe = (portReturn - riskFreeRate) / portRisk
+	}
+	return RiskReturnPoint{Return: portReturn, Risk: portRisk, Sharpe: sharpe}
+}
+
+// portfolio evaluates w and packages it the same way for every optimizer.
+func (in *Universe) portfolio(w []float64, riskFreeRate float64) Portfolio {
+	wv := mat.NewVecDense(len(w), w)
+	return newPortfolio(in.WeightMap(wv), in.evaluate(wv, riskFreeRate), in.Frequency)
+}
+
+// mu exposes the expected returns as a slice for the LP and QP builders.
+func (in *Universe) mu() []float64 {
+	return in.Mean.RawVector().Data
+}
@@ -0,0 +1,95 @@
+package analysis_test
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/AndrewBrickweg/Finet_v2/cmd/finet/analysis"
+	"gonum.org/v1/gonum/mat"
+)
+
+func TestUniverseMatchesMaps(t *testing.T) {
+	returns := analysis.MonthlyStockReturns(analysis.ExtractMonthlyAdjClosePrices(MockStockData()))
+	in := analysis.NewUniverse(returns)
+	expected := analysis.ExpectedReturn(returns)
+	cov := analysis.CovarianceMatrixSample(returns)
+
+	if in.Len() != len(returns) {
+		t.Fatalf("universe has %d tickers, want %d", in.Len(), len(returns))
+	}
+	for i, a := range in.Tickers {
+		if j, ok := in.Index(a); !ok || j != i {
+			t.Fatalf("Index(%s) = %d, %v; want %d", a, j, ok, i)
+		}
+		if in.Mean.AtVec(i) != expected[a] {
+			t.Errorf("%s mean %v, want %v", a, in.Mean.AtVec(i), expected[a])
+		}
+		for j, b := range in.Tickers {
+			if in.Cov.At(i, j) != cov[a][b] {
+				t.Errorf("cov[%s][%s] = %v, want %v", a, b, in.Cov.At(i, j), cov[a][b])
+			}
+		}
+	}
+
+	// Every Monte Carlo portfolio reports the risk its weight map implies.
+	portfolios, _ := analysis.OptimizePortfolio(returns, 50, 0.0, 0.02, 0.20, 3)
+	for _, p := range portfolios {
+		if got := mapVariance(p.Weights, cov); math.Abs(math.Sqrt(got)-p.Risk) > 1e-12 {
+			t.Fatalf("risk %v, weight map gives %v", p.Risk, math.Sqrt(got))
+		}
+	}
+}
+
+func mapVariance(weights map[string]float64, cov map[string]map[string]float64) float64 {
+	var v float64
+	for a, wa := range weights {
+		for b, wb := range weights {
+			v += wa * wb * cov[a][b]
+		}
+	}
+	return v
+}
+
+// BenchmarkPortfolioVariance compares the double map lookup the optimizer
+// used to do per weight pair with the dense quadratic form.
+func BenchmarkPortfolioVariance(b *testing.B) {
+	for _, n := range []int{10, 100, 500} {
+		returns := syntheticReturns(n, 120)
+		in := analysis.NewUniverse(returns)
+		w := mat.NewVecDense(n, nil)
+		weights := make(map[string]float64, n)
+		for i, t := range in.Tickers {
+			w.SetVec(i, 1/float64(n))
+			weights[t] = 1 / float64(n)
+		}
+
+		b.Run(fmt.Sprintf("map/assets=%d", n), func(b *testing.B) {
+			cov := analysis.CovarianceMatrixSample(returns)
+			b.ResetTimer()
+			for range b.N {
+				mapVariance(weights, cov)
+			}
+		})
+		b.Run(fmt.Sprintf("dense/assets=%d", n), func(b *testing.B) {
+			for range b.N {
+				mat.Inner(w, in.Cov, w)
+			}
+		})
+	}
+}
+
+func BenchmarkMonteCarloAssets(b *testing.B) {
+	for _, n := range []int{10, 100, 500} {
+		returns := syntheticReturns(n, 120)
+		b.Run(fmt.Sprintf("assets=%d", n), func(b *testing.B) {
+			cfg := analysis.OptimizerConfig{NumPortfolios: 1000, MaxWeight: max(0.05, 2/float64(n)), Seed: 7}
+			for range b.N {
+				if _, _, err := analysis.Optimize(context.Background(), returns, cfg); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,267 @@
+package analysis
+
+import (
+	"context"
+	"fmt"
+	"math"
+
+	"gonum.org/v1/gonum/stat"
+)
+
+// Walk-forward evaluation. Each strategy is trained on a window of past
+// returns, held for the period that follows, then retrained with that period
+// added to the history. Stitching the held periods together gives returns no
+// weight was fitted to, to set against how well the same weights looked on
+// the months they were fitted to.
+
+// WindowScheme says which months each walk-forward fold trains on.
+type WindowScheme string
+
+const (
+	WindowRolling   WindowScheme = "rolling"   // the TrainMonths before the held period
+	WindowExpanding WindowScheme = "expanding" // every month before the held period
+)
+
+// WalkForwardStrategy is one optimizer to evaluate. A nil Config holds equal
+// weights, the baseline any optimizer should beat out of sample.
+type WalkForwardStrategy struct {
+	Name   string // defaults to the mode, or "equal_weight"
+	Config *OptimizerConfig
+}
+
+// WalkForwardConfig describes a walk-forward evaluation. Every strategy is
+// held over the same months, so their results compare directly.
+type WalkForwardConfig struct {
+	Strategies  []WalkForwardStrategy
+	Window      WindowScheme      // zero means WindowRolling
+	TrainMonths int               // the rolling window, or the first expanding one
+	Hold        RebalanceSchedule // monthly, quarterly or annual retraining; zero means monthly
+
+	Start string // first month held out of sample; empty starts after the first training window
+	End   string // last month held; empty runs to the end of the data
+
+	GapPolicy GapPolicy  // zero means GapForwardFill; see alignValuePath
+	Benchmark *Benchmark // optional; fills Estimators.Benchmark and is compared with out of sample
+	Risk      RiskConfig // risk-free rate and confidence; Frequency and Months are filled in
+}
+
+// Performance summarizes a return series, annualized like PortfolioRisk.
+type Performance struct {
+	AnnualReturn     float64
+	AnnualVolatility float64
+	Sharpe           float64
+}
+
+// WalkForwardFold is one training and the period its weights were held for.
+type WalkForwardFold struct {
+	TrainStart string
+	TrainEnd   string
+	HoldStart  string
+	HoldEnd    string
+
+	Weights    map[string]float64 // as trained; they drift while held
+	InSample   Performance        // the weights, rebalanced monthly, over their training months
+	HoldReturn float64            // compounded over the held months
+	Turnover   float64            // one-way, into Weights from the drifted holdings; 1 for the first fold
+}
+
+// StrategyEvaluation sets a strategy's out-of-sample record against its
+// in-sample one.
+type StrategyEvaluation struct {
+	Name string
+
+	// InSample averages the folds' in-sample performance: what the optimizer
+	// promised each time it was trained.
+	InSample Performance
+	// OutOfSample reports on the held returns, what it delivered.
+	OutOfSample *PortfolioRisk
+	Returns     []float64 // out of sample, one per month of the result's Months
+
+	Folds          []WalkForwardFold
+	Turnover       float64 // summed over the folds after the first
+	AnnualTurnover float64
+}
+
+// WalkForwardResult holds every strategy's evaluation over the same months.
+type WalkForwardResult struct {
+	Months     []string // held out of sample
+	Strategies []StrategyEvaluation
+	Gaps       GapReport
+
+	BenchmarkName    string    `json:",omitempty"`
+	BenchmarkReturns []float64 `json:",omitempty"`
+}
+
+// OrchestrateWalkForward aligns the monthly data and evaluates every strategy
+// of cfg over it.
+func OrchestrateWalkForward(ctx context.Context, monthly []*StockDataMonthly, cfg WalkForwardConfig) (*WalkForwardResult, error) {
+	if len(monthly) == 0 {
+		return nil, fmt.Errorf("no monthly data provided")
+	}
+	if len(cfg.Strategies) == 0 {
+		return nil, fmt.Errorf("no strategies to evaluate")
+	}
+	switch cfg.Window {
+	case "", WindowRolling, WindowExpanding:
+	default:
+		return nil, fmt.Errorf("unknown window scheme %q", cfg.Window)
+	}
+	switch cfg.Hold {
+	case "", RebalanceMonthly, RebalanceQuarterly, RebalanceAnnual:
+	default:
+		return nil, fmt.Errorf("walk-forward folds are held monthly, quarterly or annually, not %q", cfg.Hold)
+	}
+	if cfg.TrainMonths < 2 {
+		return nil, fmt.Errorf("walk-forward needs at least 2 training months, got %d", cfg.TrainMonths)
+	}
+
+	panel, err := alignValuePath(monthly, cfg.GapPolicy)
+	if err != nil {
+		return nil, err
+	}
+	first, last, err := backtestWindow(panel.Months, cfg.Start, cfg.End, cfg.TrainMonths)
+	if err != nil {
+		return nil, err
+	}
+	result := &WalkForwardResult{Months: panel.Months[first : last+1], Gaps: panel.Gaps}
+
+	var benchmark, bench []float64
+	if cfg.Benchmark, benchmark, err = panel.alignBenchmark(cfg.Benchmark); err != nil {
+		return nil, err
+	}
+	if cfg.Benchmark != nil {
+		bench = benchmark[first : last+1]
+		result.BenchmarkName, result.BenchmarkReturns = cfg.Benchmark.Name, bench
+	}
+
+	riskCfg := cfg.Risk
+	riskCfg.Frequency = Monthly
+	riskCfg.Months = result.Months
+	seen := make(map[string]bool, len(cfg.Strategies))
+	for _, s := range cfg.Strategies {
+		if s.Name == "" {
+			s.Name = "equal_weight"
+			if s.Config != nil {
+				s.Name = string(s.Config.Mode)
+			}
+		}
+		if seen[s.Name] {
+			return nil, fmt.Errorf("strategy %s is listed twice", s.Name)
+		}
+		seen[s.Name] = true
+
+		eval, err := walkForward(ctx, panel, benchmark, s, cfg, first, last)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", s.Name, err)
+		}
+		if eval.OutOfSample, err = SeriesRisk(eval.Returns, bench, riskCfg); err != nil {
+			return nil, fmt.Errorf("%s: %w", s.Name, err)
+		}
+		result.Strategies = append(result.Strategies, *eval)
+	}
+	return result, nil
+}
+
+// walkForward trains s before every fold from panel month first to last and
+// holds the weights, drifting with the returns, until the next one.
+func walkForward(ctx context.Context, panel *ReturnPanel, benchmark []float64, s WalkForwardStrategy, cfg WalkForwardConfig, first, last int) (*StrategyEvaluation, error) {
+	tickers := sortedTickers(panel.Returns)
+	eval := &StrategyEvaluation{Name: s.Name}
+	periods := Monthly.PeriodsPerYear()
+	rf := cfg.Risk.RiskFreeRate
+
+	held := make([]float64, len(tickers))
+	for i := first; i <= last; {
+		from := i - cfg.TrainMonths
+		if cfg.Window == WindowExpanding {
+			from = 0
+		}
+		want := make([]float64, len(tickers))
+		if s.Config == nil {
+			for k := range want {
+				want[k] = 1 / float64(len(tickers))
+			}
+		} else {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+			p, err := trainStrategy(ctx, panel, benchmark, *s.Config, from, i)
+			if err != nil {
+				return nil, fmt.Errorf("training before %s: %w", panel.Months[i], err)
+			}
+			for k, t := range tickers {
+				want[k] = p.Weights[t]
+			}
+		}
+
+		fold := WalkForwardFold{
+			TrainStart: panel.Months[from],
+			TrainEnd:   panel.Months[i-1],
+			HoldStart:  panel.Months[i],
+			Weights:    weightMap(tickers, want),
+			Turnover:   1,
+		}
+		if i > first {
+			fold.Turnover = 0
+			for k := range held {
+				fold.Turnover += math.Abs(want[k]-held[k]) / 2
+			}
+			eval.Turnover += fold.Turnover
+		}
+
+		fitted := make([]float64, i-from)
+		for k, t := range tickers {
+			for j, r := range panel.Returns[t][from:i] {
+				fitted[j] += want[k] * r
+			}
+		}
+		fold.InSample = performance(fitted, rf, periods)
+
+		copy(held, want)
+		growth := 1.0
+		for ; i <= last; i++ {
+			// a fold that lost everything holds nothing until the next
+			ret := 0.0
+			if growth > 0 {
+				for k, t := range tickers {
+					ret += held[k] * panel.Returns[t][i]
+				}
+				if 1+ret <= 0 {
+					ret, growth = -1, 0
+					clear(held)
+				} else {
+					for k, t := range tickers {
+						held[k] *= (1 + panel.Returns[t][i]) / (1 + ret)
+					}
+					growth *= 1 + ret
+				}
+			}
+			eval.Returns = append(eval.Returns, ret)
+			if rebalanceDue(cfg.Hold, panel.Months[i], nil, nil, 0) {
+				i++
+				break
+			}
+		}
+		fold.HoldEnd = panel.Months[i-1]
+		fold.HoldReturn = growth - 1
+		eval.Folds = append(eval.Folds, fold)
+	}
+
+	for _, f := range eval.Folds {
+		eval.InSample.AnnualReturn += f.InSample.AnnualReturn / float64(len(eval.Folds))
+		eval.InSample.AnnualVolatility += f.InSample.AnnualVolatility / float64(len(eval.Folds))
+		eval.InSample.Sharpe += f.InSample.Sharpe / float64(len(eval.Folds))
+	}
+	eval.AnnualTurnover = eval.Turnover * periods / float64(len(eval.Returns))
+	return eval, nil
+}
+
+// performance annualizes series the way SeriesRisk does. rf is per period.
+func performance(series []float64, rf, periods float64) Performance {
+	mean, sd := stat.MeanStdDev(series, nil)
+	p := Performance{AnnualReturn: mean * periods, AnnualVolatility: sd * math.Sqrt(periods)}
+	if sd > 0 {
+		p.Sharpe = (mean - rf) / sd * math.Sqrt(periods)
+	}
+	return p
+}
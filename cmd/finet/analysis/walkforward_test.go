@@ -0,0 +1,150 @@
+package analysis_test
+
+import (
+	"context"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/AndrewBrickweg/Finet_v2/cmd/finet/analysis"
+)
+
+func TestWalkForward(t *testing.T) {
+	data := backtestData(t)
+	panel, err := analysis.AlignMonthlyReturns(data, analysis.GapDrop)
+	if err != nil {
+		t.Fatal(err)
+	}
+	minVariance := &analysis.OptimizerConfig{Mode: analysis.ModeMinVariance, MaxWeight: 1}
+	strategies := []analysis.WalkForwardStrategy{{Config: minVariance}, {}}
+
+	t.Run("rolling monthly", func(t *testing.T) {
+		res, err := analysis.OrchestrateWalkForward(context.Background(), data, analysis.WalkForwardConfig{Strategies: strategies, TrainMonths: 24})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.Months[0] != "2022-01" || len(res.Months) != 12 {
+			t.Fatalf("months %v, want the 12 after two years of training", res.Months)
+		}
+		if len(res.Strategies) != 2 || res.Strategies[0].Name != "min_variance" || res.Strategies[1].Name != "equal_weight" {
+			t.Fatalf("unexpected strategies %+v", res.Strategies)
+		}
+
+		mv := res.Strategies[0]
+		if len(mv.Folds) != 12 || len(mv.Returns) != 12 || mv.OutOfSample.Periods != 12 {
+			t.Fatalf("%d folds and %d returns, want one of each per month", len(mv.Folds), len(mv.Returns))
+		}
+		// the last fold trains on the 24 months before December 2022 only
+		fold := mv.Folds[11]
+		if fold.TrainStart != "2020-12" || fold.TrainEnd != "2022-11" || fold.HoldStart != "2022-12" || fold.HoldEnd != "2022-12" {
+			t.Errorf("last fold trained %s to %s and held %s to %s", fold.TrainStart, fold.TrainEnd, fold.HoldStart, fold.HoldEnd)
+		}
+		train := map[string][]float64{"AAA": panel.Returns["AAA"][11:35], "BBB": panel.Returns["BBB"][11:35]}
+		p, err := analysis.OptimizeMinVariance(train, 0, analysis.Constraints{MaxWeight: 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		fitted := make([]float64, 24)
+		for ticker, w := range p.Weights {
+			if math.Abs(fold.Weights[ticker]-w) > 1e-9 {
+				t.Errorf("last fold %s weight %v, want %v", ticker, fold.Weights[ticker], w)
+			}
+			for j, r := range train[ticker] {
+				fitted[j] += w * r
+			}
+		}
+		want := 0.0
+		for ticker, w := range p.Weights {
+			want += w * panel.Returns[ticker][35]
+		}
+		if math.Abs(fold.HoldReturn-want) > 1e-9 || math.Abs(mv.Returns[11]-want) > 1e-9 {
+			t.Errorf("last fold returned %v, want %v", fold.HoldReturn, want)
+		}
+		risk, err := analysis.SeriesRisk(fitted, nil, analysis.RiskConfig{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if math.Abs(fold.InSample.AnnualVolatility-risk.AnnualVolatility) > 1e-9 || math.Abs(fold.InSample.Sharpe-risk.Sharpe) > 1e-9 {
+			t.Errorf("in-sample %+v, want volatility %v and Sharpe %v", fold.InSample, risk.AnnualVolatility, risk.Sharpe)
+		}
+
+		// minimum variance is fitted to the training months, so its in-sample
+		// volatility is the lowest any weights could have had there
+		ew := res.Strategies[1]
+		if !(mv.InSample.AnnualVolatility <= ew.InSample.AnnualVolatility) {
+			t.Errorf("min_variance in-sample volatility %v above equal weight's %v", mv.InSample.AnnualVolatility, ew.InSample.AnnualVolatility)
+		}
+		for i, r := range ew.Returns {
+			if want := (panel.Returns["AAA"][24+i] + panel.Returns["BBB"][24+i]) / 2; math.Abs(r-want) > 1e-12 {
+				t.Fatalf("equal weight month %d returned %v, want %v", i, r, want)
+			}
+		}
+		if ew.Folds[0].Turnover != 1 || ew.Turnover <= 0 {
+			t.Errorf("equal weight turnover %v after a first fold of %v", ew.Turnover, ew.Folds[0].Turnover)
+		}
+	})
+
+	t.Run("expanding quarterly", func(t *testing.T) {
+		res, err := analysis.OrchestrateWalkForward(context.Background(), data, analysis.WalkForwardConfig{
+			Strategies:  strategies[:1],
+			Window:      analysis.WindowExpanding,
+			TrainMonths: 12,
+			Hold:        analysis.RebalanceQuarterly,
+			Start:       "2021-02",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var held []string
+		for _, f := range res.Strategies[0].Folds {
+			if f.TrainStart != "2020-01" {
+				t.Errorf("fold held from %s trained from %s, want every fold to start at 2020-01", f.HoldStart, f.TrainStart)
+			}
+			held = append(held, f.HoldStart+".."+f.HoldEnd)
+		}
+		if want := "2021-02..2021-03 2021-04..2021-06 2021-07..2021-09 2021-10..2021-12 2022-01..2022-03 2022-04..2022-06 2022-07..2022-09 2022-10..2022-12"; strings.Join(held, " ") != want {
+			t.Errorf("held %v, want %s", held, want)
+		}
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		for name, cfg := range map[string]analysis.WalkForwardConfig{
+			"no strategies":      {TrainMonths: 24},
+			"threshold hold":     {Strategies: strategies, TrainMonths: 24, Hold: analysis.RebalanceThreshold},
+			"duplicate strategy": {Strategies: []analysis.WalkForwardStrategy{{}, {}}, TrainMonths: 24},
+			"short training":     {Strategies: strategies, TrainMonths: 1},
+			"unknown window":     {Strategies: strategies, TrainMonths: 24, Window: "sliding"},
+		} {
+			if _, err := analysis.OrchestrateWalkForward(context.Background(), data, cfg); err == nil {
+				t.Errorf("%s: no error", name)
+			}
+		}
+	})
+}
+
+func TestWalkForwardWipedOut(t *testing.T) {
+	res, err := analysis.OrchestrateWalkForward(context.Background(), []*analysis.StockDataMonthly{wipedOut(t)}, analysis.WalkForwardConfig{
+		Strategies:  []analysis.WalkForwardStrategy{{}},
+		TrainMonths: 2,
+		Hold:        analysis.RebalanceQuarterly,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	eval := res.Strategies[0]
+	// the fold from July to September loses everything in August
+	fold := eval.Folds[2]
+	if fold.HoldStart != "2020-07" || fold.HoldReturn != -1 || eval.Returns[5] != -1 || eval.Returns[6] != 0 {
+		t.Errorf("fold %s to %s returned %v, months %v, want -1 with nothing held in September", fold.HoldStart, fold.HoldEnd, fold.HoldReturn, eval.Returns[4:7])
+	}
+	for _, f := range eval.Folds {
+		if math.IsNaN(f.Turnover) || math.IsNaN(f.HoldReturn) {
+			t.Fatalf("fold from %s has turnover %v and return %v", f.HoldStart, f.Turnover, f.HoldReturn)
+		}
+	}
+	for i, r := range eval.Returns {
+		if math.IsNaN(r) {
+			t.Fatalf("%s return is NaN", res.Months[i])
+		}
+	}
+}
@@ -0,0 +1,214 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/AndrewBrickweg/Finet_v2/cmd/finet/analysis"
+)
+
+const (
+	defaultTrainMonths = 60   // months of history each strategy rebalance optimizes on
+	maxBacktestMonths  = 1200 // history loaded for a backtest; more than the database holds
+)
+
+// BacktestRequest backtests either fixed weights or an optimizer strategy:
+// tickers and mode, with the same optional fields as /portfolio, re-optimized
+// at every rebalance. For a strategy lookback_months is the training window.
+type BacktestRequest struct {
+	Weights    map[string]float64 `json:"weights"`    // fixed target weights summing to 1, instead of tickers
+	Start      string             `json:"start"`      // first month held, e.g. "2010-01"
+	End        string             `json:"end"`        // last month held
+	Rebalance  string             `json:"rebalance"`  // monthly (default), quarterly, annual, threshold or none
+	Threshold  *float64           `json:"threshold"`  // rebalance threshold only; absolute weight drift, default 0.05
+	Confidence *float64           `json:"confidence"` // VaR and CVaR level, default 0.95
+
+	PortfolioRequest
+}
+
+// BacktestParameters echoes the settings a backtest ran with.
+type BacktestParameters struct {
+	Weights      map[string]float64   `json:"weights,omitempty"`
+	Strategy     *EffectiveParameters `json:"strategy,omitempty"`
+	Start        string               `json:"start"`
+	End          string               `json:"end"`
+	Rebalance    string               `json:"rebalance"`
+	Threshold    float64              `json:"threshold,omitempty"`
+	Confidence   float64              `json:"confidence"`
+	RiskFreeRate float64              `json:"risk_free_rate"`
+	Benchmark    string               `json:"benchmark,omitempty"`
+	Constituents map[string]float64   `json:"benchmark_constituents,omitempty"`
+	GapPolicy    string               `json:"gap_policy"`
+
+	benchmarkRequired bool // named by the client or needed by capm, so it may not be left out
+}
+
+type BacktestResponse struct {
+	*analysis.BacktestResult
+	Parameters BacktestParameters
+}
+
+// resolve validates req and builds the backtest configuration, leaving the
+// data, sectors and benchmark for the handler to load. The returned error
+// message is meant for the client.
+func (req BacktestRequest) resolve() (BacktestParameters, analysis.BacktestConfig, error) {
+	var params BacktestParameters
+	var cfg analysis.BacktestConfig
+
+	schedule, err := analysis.ParseRebalanceSchedule(req.Rebalance)
+	if err != nil {
+		return params, cfg, err
+	}
+	params.Rebalance, cfg.Rebalance = string(schedule), schedule
+	if schedule == analysis.RebalanceThreshold {
+		params.Threshold = analysis.DefaultDriftThreshold
+		if req.Threshold != nil {
+			if *req.Threshold <= 0 || *req.Threshold >= 1 {
+				return params, cfg, fmt.Errorf("threshold must be in (0, 1), got %g", *req.Threshold)
+			}
+			params.Threshold = *req.Threshold
+		}
+		cfg.Threshold = params.Threshold
+	} else if req.Threshold != nil {
+		return params, cfg, errors.New("threshold only applies to rebalance threshold")
+	}
+
+	params.Confidence = analysis.DefaultCVaRConfidence
+	if req.Confidence != nil {
+		if *req.Confidence < 0.5 || *req.Confidence >= 1 {
+			return params, cfg, fmt.Errorf("confidence must be in [0.5, 1), got %g", *req.Confidence)
+		}
+		params.Confidence = *req.Confidence
+	}
+
+	for _, m := range []struct{ name, value string }{{"start", req.Start}, {"end", req.End}} {
+		if m.value == "" {
+			continue
+		}
+		if _, err := time.Parse("2006-01", m.value); err != nil {
+			return params, cfg, fmt.Errorf("%s must be a month like 2010-01, got %q", m.name, m.value)
+		}
+	}
+	if req.Start != "" && req.End != "" && req.Start > req.End {
+		return params, cfg, fmt.Errorf("start %s is after end %s", req.Start, req.End)
+	}
+	params.Start, params.End = req.Start, req.End
+	cfg.Start, cfg.End = req.Start, req.End
+
+	var eff EffectiveParameters
+	switch {
+	case req.Weights != nil && (len(req.Tickers) > 0 || req.Mode != ""):
+		return params, cfg, errors.New("give either weights or tickers and a mode, not both")
+	case req.Weights != nil:
+		if params.Weights, err = resolveWeights(req.Weights); err != nil {
+			return params, cfg, err
+		}
+		if eff, err = req.OptimizerParams.resolve(weightTickers(params.Weights), defaultTrainMonths); err != nil {
+			return params, cfg, err
+		}
+		cfg.Weights = params.Weights
+	case len(req.Tickers) > 0:
+		strategy := analysis.OptimizerConfig{}
+		if eff, strategy, err = req.PortfolioRequest.resolve(defaultTrainMonths); err != nil {
+			return params, cfg, err
+		}
+		params.Strategy = &eff
+		cfg.Strategy, cfg.TrainMonths = &strategy, eff.LookbackMonths
+	default:
+		return params, cfg, errors.New("no weights or tickers provided")
+	}
+
+	params.RiskFreeRate = eff.RiskFreeRate
+	params.Benchmark, params.Constituents, params.benchmarkRequired = eff.Benchmark, eff.Constituents, eff.benchmarkRequired
+	// a dropped month would vanish from the equity curve, so fill by default
+	switch {
+	case req.GapPolicy == "":
+		params.GapPolicy = string(analysis.GapForwardFill)
+	case eff.GapPolicy == string(analysis.GapDrop):
+		return params, cfg, errors.New("gap_policy drop would leave months out of the equity curve; use ffill or reject")
+	default:
+		params.GapPolicy = eff.GapPolicy
+	}
+	cfg.GapPolicy = analysis.GapPolicy(params.GapPolicy)
+	if cfg.Strategy != nil {
+		params.Strategy.GapPolicy, cfg.Strategy.GapPolicy = params.GapPolicy, cfg.GapPolicy
+	}
+	cfg.Risk = analysis.RiskConfig{
+		RiskFreeRate: dataFrequency.PeriodicRate(eff.RiskFreeRate),
+		Confidence:   params.Confidence,
+	}
+	return params, cfg, nil
+}
+
+// BacktestHandler simulates fixed weights or an optimizer strategy over the
+// stored price history.
+func (h *Handler) BacktestHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req BacktestRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+	params, cfg, err := req.resolve()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// re-optimizing at every rebalance takes longer than one optimization
+	ctx, cancel := context.WithTimeout(r.Context(), 2*time.Minute)
+	defer cancel()
+
+	var tickers []string
+	if cfg.Strategy == nil {
+		tickers = weightTickers(params.Weights)
+	} else {
+		tickers = params.Strategy.Tickers
+	}
+	if cfg.Strategy != nil && len(cfg.Strategy.SectorLimits) > 0 {
+		cfg.Strategy.Sectors, err = h.tickerSectors(ctx, tickers, req.SectorLevel)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error retrieving sectors: %v", err), http.StatusInternalServerError)
+			return
+		}
+		if cfg.Strategy.SectorLimits, err = matchSectorLimits(cfg.Strategy.SectorLimits, cfg.Strategy.Sectors, tickers, req.SectorLevel); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	monthlyData, err := analysis.MakeMonthlyHistory(ctx, tickers, h.StockDB, maxBacktestMonths)
+	if err != nil {
+		writeStockDataError(w, err)
+		return
+	}
+	if len(monthlyData) == 0 {
+		http.Error(w, "Error retrieving stock data: none of the tickers has stored prices", http.StatusUnprocessableEntity)
+		return
+	}
+	cfg.Benchmark, err = h.benchmark(ctx, params.Benchmark, params.Constituents, maxBacktestMonths, params.benchmarkRequired)
+	if err != nil {
+		writeStockDataError(w, err)
+		return
+	}
+
+	result, err := analysis.OrchestrateBacktest(ctx, monthlyData, cfg)
+	if err != nil {
+		writeAnalysisError(w, "running backtest", err)
+		return
+	}
+	params.Start, params.End = result.Months[0], result.Months[len(result.Months)-1]
+	if result.BenchmarkName == "" {
+		params.Benchmark, params.Constituents = "", nil // the default had nothing to compare with
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(BacktestResponse{BacktestResult: result, Parameters: params})
+}
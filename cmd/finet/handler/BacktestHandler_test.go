@@ -0,0 +1,53 @@
+package handler
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/AndrewBrickweg/Finet_v2/cmd/finet/analysis"
+)
+
+func TestBacktestRequestResolve(t *testing.T) {
+	fp := func(v float64) *float64 { return &v }
+	weights := map[string]float64{"AAPL": 0.5, "MSFT": 0.5}
+
+	tests := []struct {
+		name    string
+		req     BacktestRequest
+		wantErr string
+	}{
+		{name: "nothing to backtest", wantErr: "no weights or tickers"},
+		{name: "weights and a strategy", req: BacktestRequest{Weights: weights, PortfolioRequest: PortfolioRequest{Tickers: []string{"AAPL"}}}, wantErr: "either weights or tickers"},
+		{name: "unknown schedule", req: BacktestRequest{Weights: weights, Rebalance: "weekly"}, wantErr: "rebalance schedule"},
+		{name: "threshold without threshold schedule", req: BacktestRequest{Weights: weights, Threshold: fp(0.1)}, wantErr: "threshold"},
+		{name: "threshold out of range", req: BacktestRequest{Weights: weights, Rebalance: "threshold", Threshold: fp(1.5)}, wantErr: "threshold"},
+		{name: "malformed start", req: BacktestRequest{Weights: weights, Start: "2010-13"}, wantErr: "start"},
+		{name: "start after end", req: BacktestRequest{Weights: weights, Start: "2015-01", End: "2010-01"}, wantErr: "after end"},
+		{name: "gap policy drop", req: BacktestRequest{Weights: weights, PortfolioRequest: PortfolioRequest{OptimizerParams: OptimizerParams{GapPolicy: "drop"}}}, wantErr: "ffill"},
+		{name: "strategy needs its mode's inputs", req: BacktestRequest{PortfolioRequest: PortfolioRequest{Tickers: []string{"AAPL", "MSFT"}, Mode: "target_return"}}, wantErr: "target_return"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := tt.req.resolve()
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("got error %v, want one mentioning %q", err, tt.wantErr)
+			}
+		})
+	}
+
+	params, cfg, err := BacktestRequest{Weights: weights, Rebalance: "Threshold"}.resolve()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if params.Threshold != 0.05 || cfg.Threshold != 0.05 || cfg.Strategy != nil || params.Benchmark != defaultBenchmark || cfg.GapPolicy != analysis.GapForwardFill {
+		t.Errorf("unexpected fixed-weight backtest: %+v", params)
+	}
+
+	params, cfg, err = BacktestRequest{PortfolioRequest: PortfolioRequest{Tickers: []string{"AAPL", "MSFT"}, Mode: "min_variance"}}.resolve()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Strategy == nil || cfg.TrainMonths != defaultTrainMonths || params.Strategy.LookbackMonths != defaultTrainMonths {
+		t.Errorf("strategy backtest trains on %d months, want %d", cfg.TrainMonths, defaultTrainMonths)
+	}
+}
@@ -0,0 +1,120 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/AndrewBrickweg/Finet_v2/cmd/finet/analysis"
+)
+
+const (
+	defaultFrontierPoints = 50
+	maxFrontierPoints     = 200
+	maxCloudSize          = 2000
+)
+
+type FrontierRequest struct {
+	Tickers   []string `json:"tickers"`
+	Points    int      `json:"points"`     // frontier points, default 50
+	CloudSize int      `json:"cloud_size"` // Monte Carlo portfolios to return, 0 for none
+
+	SectorLevel  string               `json:"sector_level"`
+	SectorLimits []SectorLimitRequest `json:"sector_limits"`
+
+	OptimizerParams
+}
+
+type FrontierResponse struct {
+	*analysis.FrontierResult
+	Parameters EffectiveParameters
+}
+
+func (h *Handler) FrontierHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req FrontierRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+
+	if len(req.Tickers) == 0 {
+		http.Error(w, "No tickers provided", http.StatusBadRequest)
+		return
+	}
+	if req.Points == 0 {
+		req.Points = defaultFrontierPoints
+	}
+	if req.Points < 2 || req.Points > maxFrontierPoints {
+		http.Error(w, fmt.Sprintf("points must be between 2 and %d", maxFrontierPoints), http.StatusBadRequest)
+		return
+	}
+	if req.CloudSize < 0 || req.CloudSize > maxCloudSize {
+		http.Error(w, fmt.Sprintf("cloud_size must be between 0 and %d", maxCloudSize), http.StatusBadRequest)
+		return
+	}
+
+	params, err := req.OptimizerParams.resolve(req.Tickers, h.RequiredMonths)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	cfg := params.config(analysis.ModeMonteCarlo)
+	cfg.SectorLimits, err = parseSectorLimits(req.SectorLimits, req.SectorLevel)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	params.SectorLevel, params.SectorLimits = req.SectorLevel, req.SectorLimits
+
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+	defer cancel()
+
+	if len(cfg.SectorLimits) > 0 {
+		cfg.Sectors, err = h.tickerSectors(ctx, params.Tickers, req.SectorLevel)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error retrieving sectors: %v", err), http.StatusInternalServerError)
+			return
+		}
+		if cfg.SectorLimits, err = matchSectorLimits(cfg.SectorLimits, cfg.Sectors, params.Tickers, req.SectorLevel); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	monthlyData, err := analysis.MakeMonthlyDataSlice(ctx, params.Tickers, h.StockDB, params.LookbackMonths)
+	if err != nil {
+		writeStockDataError(w, err)
+		return
+	}
+	params.MinWeight, params.MaxWeight = analysis.EffectiveWeightBounds(len(monthlyData), params.MinWeight, params.MaxWeight)
+	if params.ExpectedReturns == string(analysis.ReturnCAPM) {
+		cfg.Benchmark, err = h.benchmark(ctx, params.Benchmark, params.Constituents, params.LookbackMonths, params.benchmarkRequired)
+		if err != nil {
+			writeStockDataError(w, err)
+			return
+		}
+	} else {
+		params.Benchmark, params.Constituents = "", nil // the frontier only uses it for capm
+	}
+
+	frontier, err := analysis.OrchestrateFrontier(
+		ctx,
+		monthlyData,
+		req.Points,
+		req.CloudSize,
+		cfg,
+	)
+	if err != nil {
+		writeAnalysisError(w, "building efficient frontier", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(FrontierResponse{FrontierResult: frontier, Parameters: params})
+}
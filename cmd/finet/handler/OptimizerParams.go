@@ -0,0 +1,468 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/AndrewBrickweg/Finet_v2/cmd/finet/analysis"
+)
+
+// optimizer settings used when a request leaves them out
+const (
+	defaultNumPortfolios = 10000  // number of portfolios to simulate
+	defaultRiskFreeRate  = 0.0396 // annual risk-free rate, 0.33% a month
+	defaultMinWeight     = 0.00   // min weight
+	defaultMaxWeight     = 0.15   // max weight
+	defaultBenchmark     = "SPY"  // market series for capm expected returns and the comparison
+)
+
+// benchmark choices besides a stored ticker
+const (
+	benchmarkEqualWeight = "equal_weight" // every ticker in the tickers table, equally weighted
+	benchmarkCustom      = "custom"       // the tickers and weights in benchmark_constituents
+)
+
+// dataFrequency is the spacing of the series MakeMonthlyDataSlice builds.
+// Requests use annual units and are converted with it.
+const dataFrequency = analysis.Monthly
+
+// bounds accepted from requests
+const (
+	minNumPortfolios  = 100
+	maxNumPortfolios  = 100000
+	minRiskFreeRate   = -0.05 // annual
+	maxRiskFreeRate   = 0.20  // annual
+	minLookbackMonths = 24
+	maxLookbackMonths = 600
+	maxSeed           = 1<<53 - 1 // largest integer a JSON number holds exactly in the browser
+	maxConstituents   = 1000
+)
+
+// OptimizerParams are the optional tuning fields shared by the optimizer
+// endpoints. Omitted fields fall back to the server defaults.
+type OptimizerParams struct {
+	NumPortfolios   *int     `json:"num_portfolios"`
+	RiskFreeRate    *float64 `json:"risk_free_rate"` // annual, e.g. 0.04
+	MinWeight       *float64 `json:"min_weight"`
+	MaxWeight       *float64 `json:"max_weight"`
+	LookbackMonths  *int     `json:"lookback_months"`
+	Seed            *int64   `json:"seed"`       // resend a response's seed to reproduce its Monte Carlo run
+	Covariance      string   `json:"covariance"` // sample (default), ledoit_wolf, ewma or semicovariance
+	EWMALambda      *float64 `json:"ewma_lambda"`
+	ExpectedReturns string   `json:"expected_returns"` // arithmetic (default), geometric, ewma or capm
+	Benchmark       string   `json:"benchmark"`        // a ticker (default SPY), equal_weight or custom
+	GapPolicy       string   `json:"gap_policy"`       // drop (default), ffill or reject
+
+	Constituents   map[string]float64     `json:"benchmark_constituents"` // benchmark custom only; ticker -> weight
+	BlackLitterman *BlackLittermanRequest `json:"black_litterman"`        // blends views into market-implied returns
+}
+
+// BlackLittermanRequest replaces the expected returns with the equilibrium
+// implied by market_weights, tilted by the views.
+type BlackLittermanRequest struct {
+	Views         []ViewRequest      `json:"views"`
+	MarketWeights map[string]float64 `json:"market_weights,omitempty"` // defaults to the benchmark's weights in the basket
+	RiskAversion  *float64           `json:"risk_aversion"`            // defaults to 2.5
+	Tau           *float64           `json:"tau"`                      // defaults to 0.05
+
+	prior string // where MarketWeights came from, reported with the views
+}
+
+// ViewRequest is {"asset": "AAPL", "versus": "MSFT", "return": 0.02, "confidence": 0.6}
+// for "AAPL outperforms MSFT by 2% a year", or without versus for an absolute view.
+type ViewRequest struct {
+	Asset      string  `json:"asset"`
+	Versus     string  `json:"versus,omitempty"`
+	Return     float64 `json:"return"` // annual
+	Confidence float64 `json:"confidence"`
+}
+
+// EffectiveParameters echoes the settings a request actually ran with, using
+// the same field names and units as the request so it can be resent as is.
+type EffectiveParameters struct {
+	Tickers         []string               `json:"tickers,omitempty"` // upper-cased, in request order
+	Mode            analysis.OptimizerMode `json:"mode,omitempty"`
+	Frequency       analysis.Frequency     `json:"frequency"` // of the returns behind every periodic figure
+	NumPortfolios   int                    `json:"num_portfolios"`
+	RiskFreeRate    float64                `json:"risk_free_rate"`
+	MinWeight       float64                `json:"min_weight"`
+	MaxWeight       float64                `json:"max_weight"`
+	LookbackMonths  int                    `json:"lookback_months"`
+	Seed            int64                  `json:"seed"`
+	Covariance      string                 `json:"covariance"`
+	EWMALambda      float64                `json:"ewma_lambda,omitempty"`
+	ExpectedReturns string                 `json:"expected_returns"`
+	Benchmark       string                 `json:"benchmark,omitempty"`
+	Constituents    map[string]float64     `json:"benchmark_constituents,omitempty"`
+	GapPolicy       string                 `json:"gap_policy"`
+	BlackLitterman  *BlackLittermanRequest `json:"black_litterman,omitempty"`
+	TargetReturn    *float64               `json:"target_return,omitempty"`
+	TargetRisk      *float64               `json:"target_risk,omitempty"`
+	RiskBudgets     map[string]float64     `json:"risk_budgets,omitempty"`
+	CVaRConfidence  *float64               `json:"cvar_confidence,omitempty"`
+	SectorLevel     string                 `json:"sector_level,omitempty"`
+	SectorLimits    []SectorLimitRequest   `json:"sector_limits,omitempty"`
+
+	benchmarkRequired bool // named by the client or needed by capm, so it may not be left out
+}
+
+// resolve validates p for a basket of tickers and fills in defaults. The
+// normalized tickers are returned in Tickers for the caller to load. The
+// returned error message is meant for the client.
+func (p OptimizerParams) resolve(tickers []string, defaultLookback int) (EffectiveParameters, error) {
+	eff := EffectiveParameters{
+		NumPortfolios:  defaultNumPortfolios,
+		Frequency:      dataFrequency,
+		RiskFreeRate:   defaultRiskFreeRate,
+		MinWeight:      defaultMinWeight,
+		MaxWeight:      defaultMaxWeight,
+		LookbackMonths: defaultLookback,
+	}
+
+	var err error
+	if eff.Tickers, err = resolveTickers(tickers); err != nil {
+		return eff, err
+	}
+	numTickers := len(eff.Tickers)
+
+	if p.NumPortfolios != nil {
+		if *p.NumPortfolios < minNumPortfolios || *p.NumPortfolios > maxNumPortfolios {
+			return eff, fmt.Errorf("num_portfolios must be between %d and %d, got %d", minNumPortfolios, maxNumPortfolios, *p.NumPortfolios)
+		}
+		eff.NumPortfolios = *p.NumPortfolios
+	}
+
+	if p.RiskFreeRate != nil {
+		if *p.RiskFreeRate < minRiskFreeRate || *p.RiskFreeRate > maxRiskFreeRate {
+			return eff, fmt.Errorf("risk_free_rate is annual and must be between %.2f and %.2f, got %g", minRiskFreeRate, maxRiskFreeRate, *p.RiskFreeRate)
+		}
+		eff.RiskFreeRate = *p.RiskFreeRate
+	}
+
+	if p.MinWeight != nil {
+		if *p.MinWeight < 0 || *p.MinWeight >= 1 {
+			return eff, fmt.Errorf("min_weight must be in [0, 1), got %g", *p.MinWeight)
+		}
+		eff.MinWeight = *p.MinWeight
+	}
+	if p.MaxWeight != nil {
+		if *p.MaxWeight <= 0 || *p.MaxWeight > 1 {
+			return eff, fmt.Errorf("max_weight must be in (0, 1], got %g", *p.MaxWeight)
+		}
+		eff.MaxWeight = *p.MaxWeight
+	} else if float64(numTickers)*eff.MaxWeight < 1 {
+		// the default cap cannot fully invest a small basket
+		eff.MaxWeight = 1 / float64(numTickers)
+	}
+	if eff.MinWeight > eff.MaxWeight {
+		return eff, fmt.Errorf("min_weight %g is above max_weight %g", eff.MinWeight, eff.MaxWeight)
+	}
+	if float64(numTickers)*eff.MinWeight > 1 {
+		return eff, fmt.Errorf("min_weight %g times %d tickers exceeds 100%%; lower min_weight to at most %.4f", eff.MinWeight, numTickers, 1/float64(numTickers))
+	}
+	if float64(numTickers)*eff.MaxWeight < 1 {
+		return eff, fmt.Errorf("max_weight %g times %d tickers is below 100%%; raise max_weight to at least %.4f or add tickers", eff.MaxWeight, numTickers, 1/float64(numTickers))
+	}
+
+	if eff.LookbackMonths, err = resolveLookback(p.LookbackMonths, defaultLookback); err != nil {
+		return eff, err
+	}
+
+	covEst, err := analysis.ParseCovarianceEstimator(p.Covariance)
+	if err != nil {
+		return eff, err
+	}
+	eff.Covariance = string(covEst)
+	retEst, err := analysis.ParseReturnEstimator(p.ExpectedReturns)
+	if err != nil {
+		return eff, err
+	}
+	eff.ExpectedReturns = string(retEst)
+
+	usesEWMA := covEst == analysis.CovarianceEWMA || retEst == analysis.ReturnEWMA
+	if p.EWMALambda != nil {
+		if !usesEWMA {
+			return eff, fmt.Errorf("ewma_lambda only applies to the ewma covariance or expected returns")
+		}
+		if *p.EWMALambda <= 0 || *p.EWMALambda >= 1 {
+			return eff, fmt.Errorf("ewma_lambda must be in (0, 1), got %g", *p.EWMALambda)
+		}
+		eff.EWMALambda = *p.EWMALambda
+	} else if usesEWMA {
+		eff.EWMALambda = dataFrequency.DefaultEWMALambda()
+	}
+
+	eff.Benchmark, eff.Constituents, err = resolveBenchmark(p.Benchmark, p.Constituents)
+	if err != nil {
+		return eff, err
+	}
+	eff.benchmarkRequired = strings.TrimSpace(p.Benchmark) != "" || retEst == analysis.ReturnCAPM
+
+	if eff.GapPolicy, err = resolveGapPolicy(p.GapPolicy); err != nil {
+		return eff, err
+	}
+
+	if p.BlackLitterman != nil {
+		if retEst != analysis.ReturnArithmetic {
+			return eff, fmt.Errorf("expected_returns %s does not apply with black_litterman, which sets the expected returns", retEst)
+		}
+		bl, err := p.BlackLitterman.resolve(eff.Tickers, eff.Benchmark, eff.Constituents)
+		if err != nil {
+			return eff, err
+		}
+		eff.BlackLitterman = bl
+	}
+
+	if eff.Seed, err = resolveSeed(p.Seed); err != nil {
+		return eff, err
+	}
+
+	return eff, nil
+}
+
+// resolveLookback validates a requested lookback_months, or returns
+// defaultLookback when there is none. Every endpoint shares its bounds.
+func resolveLookback(requested *int, defaultLookback int) (int, error) {
+	if requested == nil {
+		return defaultLookback, nil
+	}
+	if *requested < minLookbackMonths || *requested > maxLookbackMonths {
+		return 0, fmt.Errorf("lookback_months must be between %d and %d, got %d", minLookbackMonths, maxLookbackMonths, *requested)
+	}
+	return *requested, nil
+}
+
+// resolveSeed validates a requested seed, or draws a new one when there is
+// none; the response echoes it so the run can be reproduced.
+func resolveSeed(requested *int64) (int64, error) {
+	if requested == nil {
+		return analysis.NewSeed(), nil
+	}
+	if *requested <= 0 || *requested > maxSeed {
+		return 0, fmt.Errorf("seed must be between 1 and %d, got %d", int64(maxSeed), *requested)
+	}
+	return *requested, nil
+}
+
+// resolveGapPolicy validates a requested gap_policy, drop when empty.
+func resolveGapPolicy(requested string) (string, error) {
+	gaps, err := analysis.ParseGapPolicy(requested)
+	if err != nil {
+		return "", err
+	}
+	return string(gaps), nil
+}
+
+// normalizeTicker is the one spelling of a ticker the database and the
+// analysis package see: trimmed and upper-cased.
+func normalizeTicker(ticker string) string {
+	return strings.ToUpper(strings.TrimSpace(ticker))
+}
+
+// resolveTickers normalizes a basket, rejecting empty and repeated tickers.
+func resolveTickers(tickers []string) ([]string, error) {
+	out := make([]string, 0, len(tickers))
+	seen := make(map[string]bool, len(tickers))
+	for _, t := range tickers {
+		t = normalizeTicker(t)
+		if t == "" {
+			return nil, errors.New("tickers has an empty ticker")
+		}
+		if seen[t] {
+			return nil, fmt.Errorf("tickers lists %s twice", t)
+		}
+		seen[t] = true
+		out = append(out, t)
+	}
+	return out, nil
+}
+
+// resolveTickerMap normalizes the ticker keys of the request field named
+// field, rejecting empty keys and keys that differ only in case.
+func resolveTickerMap(field string, m map[string]float64) (map[string]float64, error) {
+	if m == nil {
+		return nil, nil
+	}
+	out := make(map[string]float64, len(m))
+	for t, v := range m {
+		t = normalizeTicker(t)
+		if t == "" {
+			return nil, fmt.Errorf("%s has an empty ticker", field)
+		}
+		if _, dup := out[t]; dup {
+			return nil, fmt.Errorf("%s lists %s twice", field, t)
+		}
+		out[t] = v
+	}
+	return out, nil
+}
+
+// resolveBenchmark validates a benchmark choice: a stored ticker, SPY when
+// empty, equal_weight, or custom with its constituents. Constituent weights
+// are scaled to sum to 1.
+func resolveBenchmark(name string, constituents map[string]float64) (string, map[string]float64, error) {
+	name = strings.TrimSpace(name)
+	switch strings.ToLower(name) {
+	case benchmarkCustom:
+		name = benchmarkCustom
+	case benchmarkEqualWeight:
+		name = benchmarkEqualWeight
+	case "":
+		name = defaultBenchmark
+	default:
+		name = strings.ToUpper(name)
+	}
+	if name != benchmarkCustom {
+		if len(constituents) > 0 {
+			return "", nil, fmt.Errorf("benchmark_constituents needs benchmark custom, got %s", name)
+		}
+		return name, nil, nil
+	}
+
+	if len(constituents) == 0 {
+		return "", nil, fmt.Errorf("benchmark custom needs benchmark_constituents")
+	}
+	if len(constituents) > maxConstituents {
+		return "", nil, fmt.Errorf("benchmark_constituents has %d tickers, at most %d allowed", len(constituents), maxConstituents)
+	}
+	weights := make(map[string]float64, len(constituents))
+	total := 0.0
+	for t, w := range constituents {
+		t = normalizeTicker(t)
+		if t == "" {
+			return "", nil, fmt.Errorf("benchmark_constituents has an empty ticker")
+		}
+		if !(w >= 0) || math.IsInf(w, 1) {
+			return "", nil, fmt.Errorf("benchmark_constituents weight for %s must be non-negative, got %g", t, w)
+		}
+		weights[t] += w
+		total += w
+	}
+	if total <= 0 {
+		return "", nil, fmt.Errorf("benchmark_constituents weights sum to zero")
+	}
+	for t := range weights {
+		weights[t] /= total
+	}
+	return name, weights, nil
+}
+
+// resolve validates the views and fills in the model defaults. Without
+// market_weights the equilibrium is taken from the resolved benchmark's
+// weights over tickers; a single-ticker benchmark has none to give.
+func (r BlackLittermanRequest) resolve(tickers []string, benchmark string, constituents map[string]float64) (*BlackLittermanRequest, error) {
+	marketWeights, err := resolveTickerMap("black_litterman market_weights", r.MarketWeights)
+	if err != nil {
+		return nil, err
+	}
+	out := BlackLittermanRequest{
+		MarketWeights: marketWeights,
+		RiskAversion:  r.RiskAversion,
+		Tau:           r.Tau,
+	}
+	if out.RiskAversion == nil {
+		d := analysis.DefaultRiskAversion
+		out.RiskAversion = &d
+	} else if *out.RiskAversion <= 0 || *out.RiskAversion > 20 {
+		return nil, fmt.Errorf("black_litterman risk_aversion must be in (0, 20], got %g", *out.RiskAversion)
+	}
+	if out.Tau == nil {
+		tau := analysis.DefaultTau
+		out.Tau = &tau
+	} else if *out.Tau <= 0 || *out.Tau > 1 {
+		return nil, fmt.Errorf("black_litterman tau must be in (0, 1], got %g", *out.Tau)
+	}
+	for t, w := range out.MarketWeights {
+		if w < 0 {
+			return nil, fmt.Errorf("black_litterman market weight for %s is negative", t)
+		}
+	}
+	for _, v := range r.Views {
+		v.Asset = normalizeTicker(v.Asset)
+		v.Versus = normalizeTicker(v.Versus)
+		switch {
+		case v.Asset == "":
+			return nil, fmt.Errorf("black_litterman views need an asset")
+		case v.Asset == v.Versus:
+			return nil, fmt.Errorf("black_litterman view compares %s with itself", v.Asset)
+		case v.Confidence <= 0 || v.Confidence > 1:
+			return nil, fmt.Errorf("black_litterman view on %s needs a confidence in (0, 1], got %g", v.Asset, v.Confidence)
+		case math.Abs(v.Return) > 1:
+			return nil, fmt.Errorf("black_litterman view returns are annual, e.g. 0.02 for 2%%; got %g for %s", v.Return, v.Asset)
+		}
+		out.Views = append(out.Views, v)
+	}
+
+	switch {
+	case out.MarketWeights != nil:
+		out.prior = "market_weights"
+	case benchmark == benchmarkCustom:
+		out.MarketWeights = make(map[string]float64, len(tickers))
+		total := 0.0
+		for _, t := range tickers {
+			out.MarketWeights[t] = constituents[t]
+			total += constituents[t]
+		}
+		if total <= 0 {
+			return nil, errors.New("black_litterman needs market_weights: benchmark_constituents hold none of the tickers")
+		}
+		out.prior = "benchmark custom"
+	case benchmark == benchmarkEqualWeight:
+		out.MarketWeights = make(map[string]float64, len(tickers))
+		for _, t := range tickers {
+			out.MarketWeights[t] = 1 / float64(len(tickers))
+		}
+		out.prior = "benchmark equal_weight"
+	default:
+		return nil, fmt.Errorf("black_litterman needs market_weights for its equilibrium, or benchmark custom or equal_weight to take them from; %s alone has no weights", benchmark)
+	}
+	return &out, nil
+}
+
+// config converts the effective parameters into the optimizer's monthly units.
+// The benchmark series is fetched separately; see Handler.benchmark.
+func (e EffectiveParameters) config(mode analysis.OptimizerMode) analysis.OptimizerConfig {
+	return analysis.OptimizerConfig{
+		Mode:          mode,
+		NumPortfolios: e.NumPortfolios,
+		RiskFreeRate:  e.Frequency.PeriodicRate(e.RiskFreeRate),
+		MinWeight:     e.MinWeight,
+		MaxWeight:     e.MaxWeight,
+		Seed:          e.Seed,
+		GapPolicy:     analysis.GapPolicy(e.GapPolicy),
+		Estimators: analysis.Estimators{
+			Frequency:  e.Frequency,
+			Covariance: analysis.CovarianceEstimator(e.Covariance),
+			Returns:    analysis.ReturnEstimator(e.ExpectedReturns),
+			EWMALambda: e.EWMALambda,
+			// downside is measured against the risk-free rate
+			SemiThreshold: e.Frequency.PeriodicRate(e.RiskFreeRate),
+			RiskFreeRate:  e.Frequency.PeriodicRate(e.RiskFreeRate),
+		},
+		Views: e.views(),
+	}
+}
+
+// views converts the black_litterman request into the model's periodic units.
+func (e EffectiveParameters) views() *analysis.BlackLitterman {
+	if e.BlackLitterman == nil {
+		return nil
+	}
+	bl := &analysis.BlackLitterman{
+		MarketWeights: e.BlackLitterman.MarketWeights,
+		Prior:         e.BlackLitterman.prior,
+		RiskAversion:  *e.BlackLitterman.RiskAversion,
+		Tau:           *e.BlackLitterman.Tau,
+	}
+	for _, v := range e.BlackLitterman.Views {
+		bl.Views = append(bl.Views, analysis.View{
+			Asset:      v.Asset,
+			Versus:     v.Versus,
+			Return:     e.Frequency.PeriodicRate(v.Return),
+			Confidence: v.Confidence,
+		})
+	}
+	return bl
+}
@@ -0,0 +1,257 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/AndrewBrickweg/Finet_v2/cmd/finet/analysis"
+)
+
+// basket names n tickers.
+func basket(n int) []string {
+	tickers := make([]string, n)
+	for i := range tickers {
+		tickers[i] = fmt.Sprintf("T%02d", i)
+	}
+	return tickers
+}
+
+func TestOptimizerParamsResolve(t *testing.T) {
+	intp := func(v int) *int { return &v }
+	fp := func(v float64) *float64 { return &v }
+	i64p := func(v int64) *int64 { return &v }
+
+	tests := []struct {
+		name       string
+		params     OptimizerParams
+		numTickers int
+		wantErr    string
+		wantMax    float64
+	}{
+		{name: "defaults", numTickers: 10, wantMax: defaultMaxWeight},
+		{name: "default cap widened for small basket", numTickers: 5, wantMax: 0.2},
+		{name: "min weight too large", params: OptimizerParams{MinWeight: fp(0.3)}, numTickers: 4, wantErr: "min_weight"},
+		{name: "max weight too small", params: OptimizerParams{MaxWeight: fp(0.05)}, numTickers: 10, wantErr: "max_weight"},
+		{name: "min above max", params: OptimizerParams{MinWeight: fp(0.2), MaxWeight: fp(0.1)}, numTickers: 10, wantErr: "above max_weight"},
+		{name: "too few simulations", params: OptimizerParams{NumPortfolios: intp(10)}, numTickers: 10, wantErr: "num_portfolios"},
+		{name: "monthly risk-free rate typo", params: OptimizerParams{RiskFreeRate: fp(4)}, numTickers: 10, wantErr: "risk_free_rate"},
+		{name: "lookback too long", params: OptimizerParams{LookbackMonths: intp(1200)}, numTickers: 10, wantErr: "lookback_months"},
+		{name: "negative seed", params: OptimizerParams{Seed: i64p(-1)}, numTickers: 10, wantErr: "seed"},
+		{name: "unknown covariance", params: OptimizerParams{Covariance: "shrunk"}, numTickers: 10, wantErr: "covariance"},
+		{name: "lambda without ewma", params: OptimizerParams{EWMALambda: fp(0.9)}, numTickers: 10, wantErr: "ewma_lambda"},
+		{name: "ewma lambda out of range", params: OptimizerParams{Covariance: "ewma", EWMALambda: fp(1)}, numTickers: 10, wantErr: "ewma_lambda"},
+		{name: "unknown expected returns", params: OptimizerParams{ExpectedReturns: "median"}, numTickers: 10, wantErr: "expected return"},
+		{name: "unknown gap policy", params: OptimizerParams{GapPolicy: "interpolate"}, numTickers: 10, wantErr: "gap policy"},
+		{name: "constituents without custom benchmark", params: OptimizerParams{Benchmark: "QQQ", Constituents: map[string]float64{"AAPL": 1}}, numTickers: 10, wantErr: "benchmark_constituents"},
+		{name: "custom benchmark without constituents", params: OptimizerParams{Benchmark: "custom"}, numTickers: 10, wantErr: "benchmark_constituents"},
+		{name: "custom benchmark with negative weight", params: OptimizerParams{Benchmark: "custom", Constituents: map[string]float64{"AAPL": 1, "MSFT": -1}}, numTickers: 10, wantErr: "non-negative"},
+		{name: "benchmark without capm", params: OptimizerParams{Benchmark: "QQQ"}, numTickers: 10, wantMax: defaultMaxWeight},
+		{name: "equal-weight benchmark", params: OptimizerParams{Benchmark: "Equal_Weight"}, numTickers: 10, wantMax: defaultMaxWeight},
+		{name: "view without confidence", params: OptimizerParams{BlackLitterman: &BlackLittermanRequest{Views: []ViewRequest{{Asset: "AAPL", Return: 0.02}}}}, numTickers: 10, wantErr: "confidence"},
+		{name: "monthly view typo", params: OptimizerParams{BlackLitterman: &BlackLittermanRequest{Views: []ViewRequest{{Asset: "AAPL", Return: 2, Confidence: 0.5}}}}, numTickers: 10, wantErr: "annual"},
+		{name: "views with capm", params: OptimizerParams{ExpectedReturns: "capm", BlackLitterman: &BlackLittermanRequest{}}, numTickers: 10, wantErr: "black_litterman"},
+		{name: "relative view", params: OptimizerParams{Benchmark: "equal_weight", BlackLitterman: &BlackLittermanRequest{Views: []ViewRequest{{Asset: "aapl", Versus: "MSFT", Return: 0.02, Confidence: 0.6}}}}, numTickers: 10, wantMax: defaultMaxWeight},
+		{name: "views without market weights", params: OptimizerParams{BlackLitterman: &BlackLittermanRequest{}}, numTickers: 10, wantErr: "market_weights"},
+		{name: "custom benchmark outside the basket", params: OptimizerParams{Benchmark: "custom", Constituents: map[string]float64{"SPY": 1}, BlackLitterman: &BlackLittermanRequest{}}, numTickers: 10, wantErr: "market_weights"},
+		{name: "ewma lambda for expected returns", params: OptimizerParams{ExpectedReturns: "ewma", EWMALambda: fp(0.9)}, numTickers: 10, wantMax: defaultMaxWeight},
+		{name: "all supplied", params: OptimizerParams{NumPortfolios: intp(500), RiskFreeRate: fp(0.04), MinWeight: fp(0.01), MaxWeight: fp(0.5), LookbackMonths: intp(60), Seed: i64p(42), Covariance: "ledoit_wolf", ExpectedReturns: "capm", Benchmark: "qqq", GapPolicy: "reject"}, numTickers: 10, wantMax: 0.5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			eff, err := tt.params.resolve(basket(tt.numTickers), 180)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("got error %v, want one mentioning %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if eff.MaxWeight != tt.wantMax {
+				t.Errorf("max_weight %g, want %g", eff.MaxWeight, tt.wantMax)
+			}
+			if eff.Seed <= 0 || (tt.params.Seed != nil && eff.Seed != *tt.params.Seed) {
+				t.Errorf("seed %d, want a positive seed matching the request", eff.Seed)
+			}
+			// only the default SPY may be left out, and not when capm needs it
+			if want := tt.params.Benchmark != "" || tt.params.ExpectedReturns == "capm"; eff.benchmarkRequired != want {
+				t.Errorf("benchmark %s required %v, want %v", eff.Benchmark, eff.benchmarkRequired, want)
+			}
+		})
+	}
+}
+
+func TestOptimizerParamsNormalizeTickers(t *testing.T) {
+	req := PortfolioRequest{
+		Tickers:     []string{"aapl", " Msft", "XOM"},
+		Mode:        "risk_budget",
+		RiskBudgets: map[string]float64{"Aapl": 0.5, "msft ": 0.3, "xom": 0.2},
+		OptimizerParams: OptimizerParams{BlackLitterman: &BlackLittermanRequest{
+			Views:         []ViewRequest{{Asset: "aapl", Versus: "msft", Return: 0.02, Confidence: 0.6}},
+			MarketWeights: map[string]float64{"aapl": 0.5, "MSFT": 0.3, "Xom": 0.2},
+		}},
+	}
+	params, cfg, err := req.resolve(180)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []string{"AAPL", "MSFT", "XOM"}
+	if !slices.Equal(params.Tickers, want) {
+		t.Errorf("tickers %v, want %v", params.Tickers, want)
+	}
+	for _, ticker := range want {
+		if _, ok := cfg.RiskBudgets[ticker]; !ok {
+			t.Errorf("risk budgets %v lack %s", cfg.RiskBudgets, ticker)
+		}
+		if _, ok := cfg.Views.MarketWeights[ticker]; !ok {
+			t.Errorf("market weights %v lack %s", cfg.Views.MarketWeights, ticker)
+		}
+	}
+	if v := cfg.Views.Views[0]; v.Asset != "AAPL" || v.Versus != "MSFT" {
+		t.Errorf("view on %s versus %s, want AAPL versus MSFT", v.Asset, v.Versus)
+	}
+
+	for name, tickers := range map[string][]string{
+		"repeated in another case": {"aapl", "AAPL"},
+		"blank":                    {"AAPL", " "},
+	} {
+		if _, err := (OptimizerParams{}).resolve(tickers, 180); err == nil || !strings.Contains(err.Error(), "tickers") {
+			t.Errorf("%s: got error %v, want one about tickers", name, err)
+		}
+	}
+	bl := &BlackLittermanRequest{MarketWeights: map[string]float64{"aapl": 0.5, "AAPL": 0.5}}
+	if _, err := (OptimizerParams{BlackLitterman: bl}).resolve([]string{"AAPL"}, 180); err == nil || !strings.Contains(err.Error(), "twice") {
+		t.Errorf("got error %v, want market_weights listing AAPL twice", err)
+	}
+}
+
+func TestResolveBenchmark(t *testing.T) {
+	tests := []struct {
+		name         string
+		benchmark    string
+		constituents map[string]float64
+		wantName     string
+		wantWeights  map[string]float64
+	}{
+		{name: "default", wantName: defaultBenchmark},
+		{name: "ticker", benchmark: " qqq ", wantName: "QQQ"},
+		{name: "equal weight", benchmark: "EQUAL_WEIGHT", wantName: benchmarkEqualWeight},
+		{name: "custom weights scaled", benchmark: "custom", constituents: map[string]float64{"aapl": 3, "MSFT": 1}, wantName: benchmarkCustom, wantWeights: map[string]float64{"AAPL": 0.75, "MSFT": 0.25}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			name, weights, err := resolveBenchmark(tt.benchmark, tt.constituents)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if name != tt.wantName {
+				t.Errorf("benchmark %q, want %q", name, tt.wantName)
+			}
+			if len(weights) != len(tt.wantWeights) {
+				t.Fatalf("weights %v, want %v", weights, tt.wantWeights)
+			}
+			for ticker, w := range tt.wantWeights {
+				if weights[ticker] != w {
+					t.Errorf("weight for %s %g, want %g", ticker, weights[ticker], w)
+				}
+			}
+		})
+	}
+}
+
+func TestBlackLittermanPrior(t *testing.T) {
+	tickers := []string{"AAPL", "MSFT", "XOM"}
+	tests := []struct {
+		name         string
+		req          BlackLittermanRequest
+		benchmark    string
+		constituents map[string]float64
+		wantPrior    string
+		want         map[string]float64
+	}{
+		{name: "given", req: BlackLittermanRequest{MarketWeights: map[string]float64{"AAPL": 3, "MSFT": 2, "XOM": 1}}, benchmark: defaultBenchmark, wantPrior: "market_weights", want: map[string]float64{"AAPL": 3, "MSFT": 2, "XOM": 1}},
+		{name: "custom benchmark restricted to the basket", benchmark: benchmarkCustom, constituents: map[string]float64{"AAPL": 0.4, "MSFT": 0.2, "GOOG": 0.4}, wantPrior: "benchmark custom", want: map[string]float64{"AAPL": 0.4, "MSFT": 0.2, "XOM": 0}},
+		{name: "equal-weight benchmark", benchmark: benchmarkEqualWeight, wantPrior: "benchmark equal_weight", want: map[string]float64{"AAPL": 1.0 / 3, "MSFT": 1.0 / 3, "XOM": 1.0 / 3}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bl, err := tt.req.resolve(tickers, tt.benchmark, tt.constituents)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if bl.prior != tt.wantPrior || len(bl.MarketWeights) != len(tt.want) {
+				t.Fatalf("prior %q with weights %v, want %q with %v", bl.prior, bl.MarketWeights, tt.wantPrior, tt.want)
+			}
+			for ticker, w := range tt.want {
+				if bl.MarketWeights[ticker] != w {
+					t.Errorf("market weight for %s %g, want %g", ticker, bl.MarketWeights[ticker], w)
+				}
+			}
+		})
+	}
+}
+
+func TestSharedResolvers(t *testing.T) {
+	intp := func(v int) *int { return &v }
+	i64p := func(v int64) *int64 { return &v }
+
+	if got, err := resolveLookback(nil, 180); err != nil || got != 180 {
+		t.Errorf("default lookback %d, %v; want 180", got, err)
+	}
+	for _, months := range []int{minLookbackMonths - 1, maxLookbackMonths + 1} {
+		if _, err := resolveLookback(intp(months), 180); err == nil || !strings.Contains(err.Error(), "lookback_months") {
+			t.Errorf("lookback %d: got error %v", months, err)
+		}
+	}
+	if got, err := resolveSeed(nil); err != nil || got <= 0 {
+		t.Errorf("drawn seed %d, %v; want a positive one", got, err)
+	}
+	if _, err := resolveSeed(i64p(maxSeed + 1)); err == nil || !strings.Contains(err.Error(), "seed") {
+		t.Errorf("seed beyond maxSeed: got error %v", err)
+	}
+	if got, err := resolveGapPolicy(" FFill "); err != nil || got != "ffill" {
+		t.Errorf("gap policy %q, %v; want ffill", got, err)
+	}
+}
+
+func TestWriteAnalysisError(t *testing.T) {
+	for _, tt := range []struct {
+		err  error
+		want int
+	}{
+		{fmt.Errorf("fold: %w", analysis.ErrTooFewObservations), http.StatusUnprocessableEntity},
+		{fmt.Errorf("training: %w", context.DeadlineExceeded), http.StatusGatewayTimeout},
+		{errors.New("connection reset"), http.StatusInternalServerError},
+	} {
+		rec := httptest.NewRecorder()
+		writeAnalysisError(rec, "running backtest", tt.err)
+		if rec.Code != tt.want || !strings.HasPrefix(rec.Body.String(), "Error running backtest: ") {
+			t.Errorf("%v: status %d with %q, want %d", tt.err, rec.Code, rec.Body.String(), tt.want)
+		}
+	}
+}
+
+func TestWriteStockDataError(t *testing.T) {
+	for _, tt := range []struct {
+		err  error
+		want int
+	}{
+		{fmt.Errorf("AAPL: %w", analysis.ErrInsufficientHistory), http.StatusBadRequest},
+		{fmt.Errorf("%w: no stored prices for benchmark QQQ", analysis.ErrNoBenchmark), http.StatusUnprocessableEntity},
+		{errors.New("connection reset"), http.StatusInternalServerError},
+	} {
+		rec := httptest.NewRecorder()
+		writeStockDataError(rec, tt.err)
+		if rec.Code != tt.want {
+			t.Errorf("%v: status %d, want %d", tt.err, rec.Code, tt.want)
+		}
+	}
+}
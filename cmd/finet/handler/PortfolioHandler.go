@@ -3,9 +3,13 @@ package handler
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"math"
 	"net/http"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/AndrewBrickweg/Finet_v2/cmd/finet/analysis"
@@ -14,7 +18,35 @@ import (
 //1. receive POST request with tickers
 type PortfolioRequest struct {
 	Tickers []string `json:"tickers"`
+	Mode    string   `json:"mode"` // monte_carlo (default), max_sharpe, min_variance, target_return, target_risk, risk_parity, risk_budget, hrp or min_cvar
 
+	// Annualized targets, e.g. 0.08 for "8% a year" or 0.12 for "at most 12% volatility".
+	TargetReturn *float64 `json:"target_return"`
+	TargetRisk   *float64 `json:"target_risk"`
+
+	// Share of total risk per ticker for mode risk_budget, scaled to sum to 1.
+	RiskBudgets map[string]float64 `json:"risk_budgets"`
+
+	// Confidence level for mode min_cvar, e.g. 0.95 for the worst 5% of months.
+	CVaRConfidence *float64 `json:"cvar_confidence"`
+
+	SectorLevel  string               `json:"sector_level"` // sector (default) or sub_industry
+	SectorLimits []SectorLimitRequest `json:"sector_limits"`
+
+	OptimizerParams
+}
+
+// PortfolioResponse is the optimizer result plus the parameters it ran with.
+type PortfolioResponse struct {
+	*analysis.Portfolios
+	Parameters EffectiveParameters
+}
+
+// SectorLimitRequest caps one sector, e.g. {"sector": "Information Technology", "max": 0.30}.
+type SectorLimitRequest struct {
+	Sector string   `json:"sector"`
+	Min    float64  `json:"min"`
+	Max    *float64 `json:"max"`
 }
 
 func (h *Handler) PortfolioHandler(w http.ResponseWriter, r *http.Request) {
@@ -38,34 +70,316 @@ func (h *Handler) PortfolioHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	params, cfg, err := req.resolve(h.RequiredMonths)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
 	defer cancel()
 
-	monthlyData, err := analysis.MakeMonthlyDataSlice(ctx, req.Tickers, h.StockDB, h.RequiredMonths,)
+	cfg.Sectors, err = h.tickerSectors(ctx, params.Tickers, req.SectorLevel)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Error retrieving stock data: %v", err), http.StatusInternalServerError)
+		http.Error(w, fmt.Sprintf("Error retrieving sectors: %v", err), http.StatusInternalServerError)
+		return
+	}
+	if cfg.SectorLimits, err = matchSectorLimits(cfg.SectorLimits, cfg.Sectors, params.Tickers, req.SectorLevel); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	monthlyData, err := analysis.MakeMonthlyDataSlice(ctx, params.Tickers, h.StockDB, params.LookbackMonths,)
+	if err != nil {
+		writeStockDataError(w, err)
 		return
 	}
 	fmt.Println("DEBUG: monthlyData received:", len(monthlyData))
-	fmt.Println("Successfully retrieved monthly data for tickers:", req.Tickers)
+	// tickers without data are skipped, so report the bounds the optimizer really used
+	params.MinWeight, params.MaxWeight = analysis.EffectiveWeightBounds(len(monthlyData), params.MinWeight, params.MaxWeight)
+	fmt.Println("Successfully retrieved monthly data for tickers:", params.Tickers)
+
+	cfg.Benchmark, err = h.benchmark(ctx, params.Benchmark, params.Constituents, params.LookbackMonths, params.benchmarkRequired)
+	if err != nil {
+		writeStockDataError(w, err)
+		return
+	}
 
 	//2. process tickers and run optimization
 	fmt.Println("DEBUG: About to run orchestrator...")
-	optimizedPortfolio, err := analysis.OrchestratePortfolio(
-		monthlyData,
-		10000,    // number of portfolios to simulate
-		0.0033,     // risk-free rate
-		0.00,      // min weight
-		0.15,      // max weight
-	)
+	optimizedPortfolio, err := analysis.OrchestratePortfolio(ctx, monthlyData, cfg)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Error optimizing portfolio: %v", err), http.StatusInternalServerError)
+		writeAnalysisError(w, "optimizing portfolio", err)
 		return
 	}
+	if optimizedPortfolio.Benchmark == nil {
+		params.Benchmark, params.Constituents = "", nil // the default had nothing to compare with
+	}
 
 	//3. return optimized portfolio as JSON response
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(optimizedPortfolio)
+	json.NewEncoder(w).Encode(PortfolioResponse{Portfolios: optimizedPortfolio, Parameters: params})
+}
+
+// resolve validates the optimizer settings of req and builds the configuration
+// for them, in the optimizer's periodic units. Sectors are left for the caller
+// to look up. The returned error message is meant for the client.
+func (req PortfolioRequest) resolve(defaultLookback int) (EffectiveParameters, analysis.OptimizerConfig, error) {
+	var params EffectiveParameters
+	var cfg analysis.OptimizerConfig
+	mode, err := analysis.ParseOptimizerMode(req.Mode)
+	if err != nil {
+		return params, cfg, err
+	}
+	params, err = req.OptimizerParams.resolve(req.Tickers, defaultLookback)
+	if err != nil {
+		return params, cfg, err
+	}
+	params.Mode = mode
+	cfg = params.config(mode)
+
+	// targets arrive annualized; the optimizer works in the data's periods
+	switch mode {
+	case analysis.ModeTargetReturn:
+		if req.TargetReturn == nil {
+			return params, cfg, errors.New("target_return is required for mode target_return")
+		}
+		cfg.TargetReturn = dataFrequency.PeriodicRate(*req.TargetReturn)
+		params.TargetReturn = req.TargetReturn
+	case analysis.ModeTargetRisk:
+		if req.TargetRisk == nil || *req.TargetRisk <= 0 {
+			return params, cfg, errors.New("a positive target_risk is required for mode target_risk")
+		}
+		cfg.TargetRisk = *req.TargetRisk / math.Sqrt(dataFrequency.PeriodsPerYear())
+		params.TargetRisk = req.TargetRisk
+	case analysis.ModeRiskBudget:
+		budgets, err := resolveTickerMap("risk_budgets", req.RiskBudgets)
+		if err != nil {
+			return params, cfg, err
+		}
+		if err := validateRiskBudgets(budgets, params.Tickers); err != nil {
+			return params, cfg, err
+		}
+		cfg.RiskBudgets = budgets
+		params.RiskBudgets = budgets
+	}
+	if mode == analysis.ModeMinCVaR {
+		level := analysis.DefaultCVaRConfidence
+		if req.CVaRConfidence != nil {
+			level = *req.CVaRConfidence
+		}
+		if level < 0.5 || level >= 1 {
+			return params, cfg, fmt.Errorf("cvar_confidence must be in [0.5, 1), got %g", level)
+		}
+		cfg.CVaRLevel = level
+		params.CVaRConfidence = &level
+	} else if req.CVaRConfidence != nil {
+		return params, cfg, errors.New("cvar_confidence only applies to mode min_cvar")
+	}
+	if req.RiskBudgets != nil && mode != analysis.ModeRiskBudget {
+		return params, cfg, errors.New("risk_budgets only applies to mode risk_budget")
+	}
+	cfg.SectorLimits, err = parseSectorLimits(req.SectorLimits, req.SectorLevel)
+	if err != nil {
+		return params, cfg, err
+	}
+	params.SectorLevel, params.SectorLimits = req.SectorLevel, req.SectorLimits
+	return params, cfg, nil
+}
+
+// benchmark loads the monthly prices behind a resolved benchmark choice over
+// the same lookback as the basket; the orchestrator lines its returns up with
+// the basket's months. A required benchmark, one the client named or capm
+// needs, fails with ErrNoBenchmark when none of its tickers has stored prices.
+// Otherwise it is the default, returned as nil in that case and marked
+// Optional so the orchestrators leave the comparison out on a gap.
+func (h *Handler) benchmark(ctx context.Context, name string, constituents map[string]float64, lookbackMonths int, required bool) (*analysis.Benchmark, error) {
+	var symbols []string
+	switch name {
+	case benchmarkEqualWeight:
+		tickers, err := h.StockDB.GetAllTickers(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("benchmark %s: %w", name, err)
+		}
+		for _, t := range tickers {
+			symbols = append(symbols, t.Ticker)
+		}
+	case benchmarkCustom:
+		for t := range constituents {
+			symbols = append(symbols, t)
+		}
+		sort.Strings(symbols)
+	default:
+		symbols = []string{name}
+	}
+
+	monthly, err := analysis.MakeMonthlyHistory(ctx, symbols, h.StockDB, lookbackMonths)
+	if err != nil {
+		return nil, fmt.Errorf("benchmark %s: %w", name, err)
+	}
+	if len(monthly) == 0 {
+		if required {
+			return nil, fmt.Errorf("%w: no stored prices for benchmark %s", analysis.ErrNoBenchmark, name)
+		}
+		return nil, nil
+	}
+	return &analysis.Benchmark{Name: name, Constituents: monthly, Weights: constituents, Optional: !required}, nil
+}
+
+// writeStockDataError reports a MakeMonthlyDataSlice failure, treating a
+// lookback longer than the stored history as the client's mistake and a
+// requested benchmark with nothing stored as unprocessable.
+func writeStockDataError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, analysis.ErrInsufficientHistory):
+		http.Error(w, fmt.Sprintf("Error retrieving stock data: %v; try a shorter lookback_months", err), http.StatusBadRequest)
+	case unprocessable(err):
+		http.Error(w, fmt.Sprintf("Error retrieving stock data: %v", err), http.StatusUnprocessableEntity)
+	default:
+		http.Error(w, fmt.Sprintf("Error retrieving stock data: %v", err), http.StatusInternalServerError)
+	}
+}
+
+// writeAnalysisError reports an orchestrator failure as "Error <action>: err":
+// 422 when the request's data or constraints admit no answer, 504 when it ran
+// out of time and 500 otherwise.
+func writeAnalysisError(w http.ResponseWriter, action string, err error) {
+	status := http.StatusInternalServerError
+	if unprocessable(err) {
+		status = http.StatusUnprocessableEntity
+	} else if errors.Is(err, context.DeadlineExceeded) {
+		status = http.StatusGatewayTimeout
+	}
+	http.Error(w, fmt.Sprintf("Error %s: %v", action, err), status)
+}
+
+// unprocessable reports whether err means the request is well formed but its
+// data or constraints admit no answer, rather than a server fault.
+func unprocessable(err error) bool {
+	for _, target := range []error{
+		analysis.ErrNoExcessReturn,
+		analysis.ErrInfeasibleTarget,
+		analysis.ErrInfeasibleConstraints,
+		analysis.ErrTooFewObservations,
+		analysis.ErrNoBenchmark,
+		analysis.ErrNoCommonHistory,
+		analysis.ErrInvalidView,
+		analysis.ErrInvalidRiskBudget,
+		analysis.ErrInvalidBenchmark,
+		analysis.ErrMissingHistory,
+		analysis.ErrInvalidScenario,
+	} {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// validateRiskBudgets checks every ticker has a positive budget and no budget
+// names a ticker outside the basket.
+func validateRiskBudgets(budgets map[string]float64, tickers []string) error {
+	if len(budgets) == 0 {
+		return errors.New("risk_budgets is required for mode risk_budget")
+	}
+	inBasket := make(map[string]bool, len(tickers))
+	for _, t := range tickers {
+		inBasket[t] = true
+		if b, ok := budgets[t]; !ok || !(b > 0) {
+			return fmt.Errorf("risk_budgets needs a positive share for %s", t)
+		}
+	}
+	for t := range budgets {
+		if !inBasket[t] {
+			return fmt.Errorf("risk_budgets names %s, which is not in tickers", t)
+		}
+	}
+	return nil
+}
+
+func parseSectorLimits(reqs []SectorLimitRequest, level string) ([]analysis.SectorLimit, error) {
+	if level != "" && level != "sector" && level != "sub_industry" {
+		return nil, fmt.Errorf("unknown sector_level %q", level)
+	}
+	limits := make([]analysis.SectorLimit, 0, len(reqs))
+	seen := make(map[string]bool, len(reqs))
+	for _, l := range reqs {
+		sector := strings.TrimSpace(l.Sector)
+		if sector == "" {
+			return nil, errors.New("sector_limits entries need a sector name")
+		}
+		if seen[strings.ToLower(sector)] {
+			return nil, fmt.Errorf("sector %q is limited more than once", sector)
+		}
+		seen[strings.ToLower(sector)] = true
+		if l.Max == nil {
+			return nil, fmt.Errorf("sector %q needs a max weight", sector)
+		}
+		if l.Min < 0 || *l.Max <= 0 || *l.Max > 1 || l.Min > *l.Max {
+			return nil, fmt.Errorf("sector %q limits must satisfy 0 <= min <= max <= 1", sector)
+		}
+		limits = append(limits, analysis.SectorLimit{Sector: sector, Min: l.Min, Max: *l.Max})
+	}
+	return limits, nil
+}
+
+// tickerSectors looks up each ticker's sector, or sub-industry when level is
+// "sub_industry". Tickers missing from the tickers table are left out.
+func (h *Handler) tickerSectors(ctx context.Context, tickers []string, level string) (map[string]string, error) {
+	classes, err := h.StockDB.GetTickerClassifications(ctx, tickers)
+	if err != nil {
+		return nil, err
+	}
+	sectors := make(map[string]string, len(classes))
+	for t, c := range classes {
+		if level == "sub_industry" {
+			sectors[t] = c.SubIndustry
+		} else {
+			sectors[t] = c.Industry
+		}
+	}
+	return sectors, nil
+}
+
+// matchSectorLimits checks every limit against the sectors the tickers are
+// stored with and returns the limits under their stored spelling. A limit no
+// ticker falls in, or a ticker with no sector on record, would leave a cap
+// that constrains nothing, so both are the client's error.
+func matchSectorLimits(limits []analysis.SectorLimit, sectors map[string]string, tickers []string, level string) ([]analysis.SectorLimit, error) {
+	if len(limits) == 0 {
+		return limits, nil
+	}
+	if level == "" {
+		level = "sector"
+	}
+	var unclassified []string
+	names := make(map[string]bool)
+	for _, t := range tickers {
+		if sectors[t] == "" {
+			unclassified = append(unclassified, t)
+			continue
+		}
+		names[sectors[t]] = true
+	}
+	if len(unclassified) > 0 {
+		return nil, fmt.Errorf("no %s on record for %s, so sector_limits cannot cap them", level, strings.Join(unclassified, ", "))
+	}
+
+	matched := make([]analysis.SectorLimit, len(limits))
+	for i, lim := range limits {
+		matched[i] = lim
+		found := false
+		for name := range names {
+			if strings.EqualFold(name, lim.Sector) {
+				matched[i].Sector, found = name, true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("sector_limits names %q, which none of the tickers is in; their %s names are %s", lim.Sector, level, strings.Join(sortedKeys(names), ", "))
+		}
+	}
+	return matched, nil
 }
 
 func (h * Handler) GetTickersHandler (w http.ResponseWriter, r *http.Request) {
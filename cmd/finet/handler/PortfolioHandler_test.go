@@ -0,0 +1,45 @@
+package handler
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/AndrewBrickweg/Finet_v2/cmd/finet/analysis"
+)
+
+func TestMatchSectorLimits(t *testing.T) {
+	tickers := []string{"AAPL", "MSFT", "XOM"}
+	sectors := map[string]string{"AAPL": "Information Technology", "MSFT": "Information Technology", "XOM": "Energy"}
+
+	limits, err := matchSectorLimits([]analysis.SectorLimit{{Sector: "information technology", Max: 0.3}}, sectors, tickers, "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if limits[0].Sector != "Information Technology" || limits[0].Max != 0.3 {
+		t.Errorf("got %+v, want the cap under the stored name", limits[0])
+	}
+
+	tests := []struct {
+		name    string
+		limits  []analysis.SectorLimit
+		sectors map[string]string
+		level   string
+		wantErr string
+	}{
+		{name: "typo", limits: []analysis.SectorLimit{{Sector: "Informaton Technology", Max: 0.3}}, sectors: sectors, wantErr: "Energy, Information Technology"},
+		{name: "sub-industry name at sector level", limits: []analysis.SectorLimit{{Sector: "Semiconductors", Max: 0.3}}, sectors: sectors, wantErr: "sector names"},
+		{name: "unclassified ticker", limits: []analysis.SectorLimit{{Sector: "Energy", Max: 0.3}}, sectors: map[string]string{"AAPL": "Information Technology", "XOM": "Energy"}, level: "sub_industry", wantErr: "no sub_industry on record for MSFT"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := matchSectorLimits(tt.limits, tt.sectors, tickers, tt.level)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("got error %v, want one mentioning %q", err, tt.wantErr)
+			}
+		})
+	}
+
+	if _, err := parseSectorLimits([]SectorLimitRequest{{Sector: "Energy", Max: &limits[0].Max}, {Sector: "energy", Max: &limits[0].Max}}, ""); err == nil {
+		t.Error("got no error for a sector limited twice in different case")
+	}
+}
@@ -0,0 +1,222 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/AndrewBrickweg/Finet_v2/cmd/finet/analysis"
+)
+
+// retirement settings used when a request leaves them out
+const (
+	defaultWithdrawalRate  = 0.04  // annual, the "4% rule"
+	defaultInflation       = 0.025 // annual
+	defaultRetirementYears = 30
+	minInflation           = -0.05 // annual
+	maxInflation           = 0.20  // annual
+)
+
+// RetirementRequest describes withdrawals from a portfolio the client holds.
+type RetirementRequest struct {
+	Weights          map[string]float64 `json:"weights"` // ticker -> weight, summing to 1
+	Initial          float64            `json:"initial"` // wealth at retirement
+	Rule             string             `json:"rule"`    // fixed (default), percent or guardrails
+	WithdrawalRate   *float64           `json:"withdrawal_rate"`
+	AnnualWithdrawal *float64           `json:"annual_withdrawal"` // fixed and guardrails; instead of withdrawal_rate
+	Inflation        *float64           `json:"inflation"`         // annual, default 0.025
+	HorizonMonths    *int               `json:"horizon_months"`    // default 360
+	Guardrail        *float64           `json:"guardrail"`         // guardrails only, default 0.2
+	Adjustment       *float64           `json:"adjustment"`        // guardrails only, default 0.1
+	Paths            *int               `json:"paths"`             // default 5000
+	BlockMonths      *int               `json:"block_months"`      // default 12
+	Seed             *int64             `json:"seed"`              // resend a response's seed to reproduce its paths
+	LookbackMonths   *int               `json:"lookback_months"`   // defaults to every stored month
+	GapPolicy        string             `json:"gap_policy"`        // drop (default), ffill or reject
+}
+
+// RetirementParameters echoes the settings a decumulation ran with.
+type RetirementParameters struct {
+	Weights        map[string]float64 `json:"weights"` // rescaled to sum to 1
+	Initial        float64            `json:"initial"`
+	Rule           string             `json:"rule"`
+	WithdrawalRate float64            `json:"withdrawal_rate"`
+	Inflation      float64            `json:"inflation"`
+	HorizonMonths  int                `json:"horizon_months"`
+	Guardrail      float64            `json:"guardrail,omitempty"`
+	Adjustment     float64            `json:"adjustment,omitempty"`
+	Paths          int                `json:"paths"`
+	BlockMonths    int                `json:"block_months"`
+	Seed           int64              `json:"seed"`
+	LookbackMonths int                `json:"lookback_months,omitempty"`
+	GapPolicy      string             `json:"gap_policy"`
+}
+
+type RetirementResponse struct {
+	*analysis.DecumulationResult
+	Parameters RetirementParameters
+}
+
+// resolve validates r and fills in defaults. The returned error message is
+// meant for the client.
+func (r RetirementRequest) resolve() (RetirementParameters, error) {
+	params := RetirementParameters{
+		WithdrawalRate: defaultWithdrawalRate,
+		Inflation:      defaultInflation,
+		HorizonMonths:  defaultRetirementYears * 12,
+		Paths:          analysis.DefaultSimulationPaths,
+		BlockMonths:    analysis.DefaultBlockMonths,
+	}
+
+	var err error
+	if params.Weights, err = resolveWeights(r.Weights); err != nil {
+		return params, err
+	}
+	if !(r.Initial > 0) || math.IsInf(r.Initial, 1) {
+		return params, fmt.Errorf("initial must be positive, got %g", r.Initial)
+	}
+	params.Initial = r.Initial
+
+	rule, err := analysis.ParseWithdrawalRule(r.Rule)
+	if err != nil {
+		return params, err
+	}
+	params.Rule = string(rule)
+
+	switch {
+	case r.WithdrawalRate != nil && r.AnnualWithdrawal != nil:
+		return params, errors.New("give either withdrawal_rate or annual_withdrawal, not both")
+	case r.AnnualWithdrawal != nil:
+		if rule == analysis.WithdrawPercent {
+			return params, errors.New("rule percent takes a withdrawal_rate, not an annual_withdrawal")
+		}
+		params.WithdrawalRate = *r.AnnualWithdrawal / r.Initial
+	case r.WithdrawalRate != nil:
+		params.WithdrawalRate = *r.WithdrawalRate
+	}
+	if !(params.WithdrawalRate > 0 && params.WithdrawalRate < 1) {
+		return params, fmt.Errorf("withdrawals must be between 0 and 100%% of initial a year, got %g", params.WithdrawalRate)
+	}
+
+	if r.Inflation != nil {
+		if *r.Inflation < minInflation || *r.Inflation > maxInflation {
+			return params, fmt.Errorf("inflation is annual and must be between %.2f and %.2f, got %g", minInflation, maxInflation, *r.Inflation)
+		}
+		params.Inflation = *r.Inflation
+	}
+
+	if r.HorizonMonths != nil {
+		if *r.HorizonMonths < 1 || *r.HorizonMonths > maxHorizonMonths {
+			return params, fmt.Errorf("horizon_months must be between 1 and %d, got %d", maxHorizonMonths, *r.HorizonMonths)
+		}
+		params.HorizonMonths = *r.HorizonMonths
+	}
+
+	if rule == analysis.WithdrawGuardrails {
+		params.Guardrail, params.Adjustment = analysis.DefaultGuardrail, analysis.DefaultAdjustment
+		for _, f := range []struct {
+			name  string
+			value *float64
+			dst   *float64
+		}{{"guardrail", r.Guardrail, &params.Guardrail}, {"adjustment", r.Adjustment, &params.Adjustment}} {
+			if f.value == nil {
+				continue
+			}
+			if !(*f.value > 0 && *f.value < 1) {
+				return params, fmt.Errorf("%s must be in (0, 1), got %g", f.name, *f.value)
+			}
+			*f.dst = *f.value
+		}
+	} else if r.Guardrail != nil || r.Adjustment != nil {
+		return params, errors.New("guardrail and adjustment only apply to rule guardrails")
+	}
+
+	if r.Paths != nil {
+		if *r.Paths < minSimulationPaths || *r.Paths > maxSimulationPaths {
+			return params, fmt.Errorf("paths must be between %d and %d, got %d", minSimulationPaths, maxSimulationPaths, *r.Paths)
+		}
+		params.Paths = *r.Paths
+	}
+	if r.BlockMonths != nil {
+		// a block cannot be longer than the history, at least minLookbackMonths
+		if *r.BlockMonths < 1 || *r.BlockMonths > minLookbackMonths {
+			return params, fmt.Errorf("block_months must be between 1 and %d, got %d", minLookbackMonths, *r.BlockMonths)
+		}
+		params.BlockMonths = *r.BlockMonths
+	}
+
+	if params.Seed, err = resolveSeed(r.Seed); err != nil {
+		return params, err
+	}
+
+	if params.LookbackMonths, err = resolveLookback(r.LookbackMonths, params.LookbackMonths); err != nil {
+		return params, err
+	}
+
+	if params.GapPolicy, err = resolveGapPolicy(r.GapPolicy); err != nil {
+		return params, err
+	}
+	return params, nil
+}
+
+// RetirementHandler simulates withdrawals from a fixed-weight portfolio over
+// its stored history.
+func (h *Handler) RetirementHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req RetirementRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+
+	params, err := req.resolve()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+	defer cancel()
+
+	// the longer the history, the more retirements it holds to replay
+	lookback := params.LookbackMonths
+	if lookback == 0 {
+		lookback = maxBacktestMonths
+	}
+	monthlyData, err := analysis.MakeMonthlyHistory(ctx, weightTickers(params.Weights), h.StockDB, lookback)
+	if err != nil {
+		writeStockDataError(w, err)
+		return
+	}
+	if len(monthlyData) == 0 {
+		http.Error(w, "Error retrieving stock data: none of the tickers has stored prices", http.StatusUnprocessableEntity)
+		return
+	}
+
+	result, err := analysis.OrchestrateDecumulation(ctx, monthlyData, params.Weights, analysis.GapPolicy(params.GapPolicy), analysis.DecumulationConfig{
+		Rule:        analysis.WithdrawalRule(params.Rule),
+		Initial:     params.Initial,
+		Rate:        params.WithdrawalRate,
+		Inflation:   params.Inflation,
+		Months:      params.HorizonMonths,
+		Guardrail:   params.Guardrail,
+		Adjustment:  params.Adjustment,
+		Paths:       params.Paths,
+		BlockMonths: params.BlockMonths,
+		Seed:        params.Seed,
+	})
+	if err != nil {
+		writeAnalysisError(w, "simulating withdrawals", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(RetirementResponse{DecumulationResult: result, Parameters: params})
+}
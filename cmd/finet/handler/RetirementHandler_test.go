@@ -0,0 +1,47 @@
+package handler
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestRetirementRequestResolve(t *testing.T) {
+	fp := func(v float64) *float64 { return &v }
+	intp := func(v int) *int { return &v }
+	weights := map[string]float64{"AAPL": 0.5, "MSFT": 0.5}
+
+	tests := []struct {
+		name    string
+		req     RetirementRequest
+		wantErr string
+	}{
+		{name: "no weights", req: RetirementRequest{Initial: 1e6}, wantErr: "no weights"},
+		{name: "no wealth", req: RetirementRequest{Weights: weights}, wantErr: "initial"},
+		{name: "unknown rule", req: RetirementRequest{Weights: weights, Initial: 1e6, Rule: "variable"}, wantErr: "withdrawal rule"},
+		{name: "rate and amount", req: RetirementRequest{Weights: weights, Initial: 1e6, WithdrawalRate: fp(0.04), AnnualWithdrawal: fp(40000)}, wantErr: "not both"},
+		{name: "amount for percent", req: RetirementRequest{Weights: weights, Initial: 1e6, Rule: "percent", AnnualWithdrawal: fp(40000)}, wantErr: "withdrawal_rate"},
+		{name: "withdrawing more than everything", req: RetirementRequest{Weights: weights, Initial: 1e6, AnnualWithdrawal: fp(2e6)}, wantErr: "withdrawals"},
+		{name: "inflation in percent", req: RetirementRequest{Weights: weights, Initial: 1e6, Inflation: fp(3)}, wantErr: "inflation"},
+		{name: "horizon too long", req: RetirementRequest{Weights: weights, Initial: 1e6, HorizonMonths: intp(1200)}, wantErr: "horizon_months"},
+		{name: "guardrail without guardrails", req: RetirementRequest{Weights: weights, Initial: 1e6, Guardrail: fp(0.2)}, wantErr: "guardrails"},
+		{name: "guardrail out of range", req: RetirementRequest{Weights: weights, Initial: 1e6, Rule: "guardrails", Adjustment: fp(1)}, wantErr: "adjustment"},
+		{name: "blocks longer than the history", req: RetirementRequest{Weights: weights, Initial: 1e6, BlockMonths: intp(36)}, wantErr: "block_months"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tt.req.resolve()
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("got error %v, want one mentioning %q", err, tt.wantErr)
+			}
+		})
+	}
+
+	params, err := RetirementRequest{Weights: weights, Initial: 1e6, Rule: "Guardrails", AnnualWithdrawal: fp(50000)}.resolve()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if math.Abs(params.WithdrawalRate-0.05) > 1e-12 || params.Guardrail != 0.2 || params.Adjustment != 0.1 || params.HorizonMonths != 360 || params.Inflation != 0.025 || params.LookbackMonths != 0 {
+		t.Errorf("unexpected defaults %+v", params)
+	}
+}
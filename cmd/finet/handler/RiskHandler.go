@@ -0,0 +1,184 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/AndrewBrickweg/Finet_v2/cmd/finet/analysis"
+)
+
+// weightSumTolerance is how far from 1 the weights of a risk request may sum
+// before they are rejected rather than rescaled.
+const weightSumTolerance = 0.01
+
+// RiskRequest describes a portfolio the client already holds.
+type RiskRequest struct {
+	Weights        map[string]float64 `json:"weights"`                // ticker -> weight, summing to 1
+	Benchmark      string             `json:"benchmark"`              // a ticker (default SPY), equal_weight or custom
+	Constituents   map[string]float64 `json:"benchmark_constituents"` // benchmark custom only; ticker -> weight
+	Confidence     *float64           `json:"confidence"`             // VaR and CVaR level, default 0.95
+	RiskFreeRate   *float64           `json:"risk_free_rate"`         // annual, e.g. 0.04
+	LookbackMonths *int               `json:"lookback_months"`        // defaults to the server's history length
+	GapPolicy      string             `json:"gap_policy"`             // drop (default), ffill or reject
+}
+
+// RiskParameters echoes the settings a risk report was computed with.
+type RiskParameters struct {
+	Frequency      analysis.Frequency `json:"frequency"`
+	Weights        map[string]float64 `json:"weights"` // rescaled to sum to 1
+	Benchmark      string             `json:"benchmark,omitempty"`
+	Constituents   map[string]float64 `json:"benchmark_constituents,omitempty"`
+	Confidence     float64            `json:"confidence"`
+	RiskFreeRate   float64            `json:"risk_free_rate"`
+	LookbackMonths int                `json:"lookback_months"`
+	GapPolicy      string             `json:"gap_policy"`
+
+	benchmarkRequired bool // named by the client, so it may not be left out
+}
+
+type RiskResponse struct {
+	*analysis.RiskResult
+	Parameters RiskParameters
+}
+
+// resolve validates r and fills in defaults. The returned error message is
+// meant for the client.
+func (r RiskRequest) resolve(defaultLookback int) (RiskParameters, error) {
+	params := RiskParameters{
+		Frequency:      dataFrequency,
+		Confidence:     analysis.DefaultCVaRConfidence,
+		RiskFreeRate:   defaultRiskFreeRate,
+		LookbackMonths: defaultLookback,
+	}
+
+	var err error
+	if params.Weights, err = resolveWeights(r.Weights); err != nil {
+		return params, err
+	}
+
+	params.Benchmark, params.Constituents, err = resolveBenchmark(r.Benchmark, r.Constituents)
+	if err != nil {
+		return params, err
+	}
+	params.benchmarkRequired = strings.TrimSpace(r.Benchmark) != ""
+
+	if r.Confidence != nil {
+		if *r.Confidence < 0.5 || *r.Confidence >= 1 {
+			return params, fmt.Errorf("confidence must be in [0.5, 1), got %g", *r.Confidence)
+		}
+		params.Confidence = *r.Confidence
+	}
+
+	if r.RiskFreeRate != nil {
+		if *r.RiskFreeRate < minRiskFreeRate || *r.RiskFreeRate > maxRiskFreeRate {
+			return params, fmt.Errorf("risk_free_rate is annual and must be between %.2f and %.2f, got %g", minRiskFreeRate, maxRiskFreeRate, *r.RiskFreeRate)
+		}
+		params.RiskFreeRate = *r.RiskFreeRate
+	}
+
+	if params.LookbackMonths, err = resolveLookback(r.LookbackMonths, params.LookbackMonths); err != nil {
+		return params, err
+	}
+
+	if params.GapPolicy, err = resolveGapPolicy(r.GapPolicy); err != nil {
+		return params, err
+	}
+	return params, nil
+}
+
+// resolveWeights upper-cases the tickers of requested weights and rescales them
+// to sum to exactly 1. The returned error message is meant for the client.
+func resolveWeights(requested map[string]float64) (map[string]float64, error) {
+	if len(requested) == 0 {
+		return nil, errors.New("no weights provided")
+	}
+	weights := make(map[string]float64, len(requested))
+	total := 0.0
+	for ticker, w := range requested {
+		ticker = normalizeTicker(ticker)
+		if ticker == "" {
+			return nil, errors.New("weights has an empty ticker")
+		}
+		if _, dup := weights[ticker]; dup {
+			return nil, fmt.Errorf("weights lists %s twice", ticker)
+		}
+		if !(w >= 0) || math.IsInf(w, 1) {
+			return nil, fmt.Errorf("weight for %s must be non-negative, got %g", ticker, w)
+		}
+		weights[ticker] = w
+		total += w
+	}
+	if math.Abs(total-1) > weightSumTolerance {
+		return nil, fmt.Errorf("weights must sum to 1, got %g", total)
+	}
+	for ticker := range weights {
+		weights[ticker] /= total
+	}
+	return weights, nil
+}
+
+// weightTickers lists the tickers of weights in a stable order.
+func weightTickers(weights map[string]float64) []string {
+	tickers := make([]string, 0, len(weights))
+	for t := range weights {
+		tickers = append(tickers, t)
+	}
+	sort.Strings(tickers)
+	return tickers
+}
+
+// RiskHandler reports on a fixed-weight portfolio over its stored history.
+func (h *Handler) RiskHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req RiskRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+
+	params, err := req.resolve(h.RequiredMonths)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+	defer cancel()
+
+	monthlyData, err := analysis.MakeMonthlyDataSlice(ctx, weightTickers(params.Weights), h.StockDB, params.LookbackMonths)
+	if err != nil {
+		writeStockDataError(w, err)
+		return
+	}
+	benchmark, err := h.benchmark(ctx, params.Benchmark, params.Constituents, params.LookbackMonths, params.benchmarkRequired)
+	if err != nil {
+		writeStockDataError(w, err)
+		return
+	}
+
+	result, err := analysis.OrchestrateRisk(monthlyData, params.Weights, benchmark, analysis.GapPolicy(params.GapPolicy), analysis.RiskConfig{
+		Frequency:    dataFrequency,
+		RiskFreeRate: dataFrequency.PeriodicRate(params.RiskFreeRate),
+		Confidence:   params.Confidence,
+	})
+	if err != nil {
+		writeAnalysisError(w, "measuring portfolio risk", err)
+		return
+	}
+	if result.BenchmarkName == "" {
+		params.Benchmark, params.Constituents = "", nil // the default had nothing to compare with; the report leaves it out
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(RiskResponse{RiskResult: result, Parameters: params})
+}
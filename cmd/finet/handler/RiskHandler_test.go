@@ -0,0 +1,67 @@
+package handler
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestRiskRequestResolve(t *testing.T) {
+	fp := func(v float64) *float64 { return &v }
+	intp := func(v int) *int { return &v }
+
+	tests := []struct {
+		name    string
+		req     RiskRequest
+		wantErr string
+	}{
+		{name: "no weights", wantErr: "no weights"},
+		{name: "negative weight", req: RiskRequest{Weights: map[string]float64{"AAPL": 1.2, "MSFT": -0.2}}, wantErr: "non-negative"},
+		{name: "weights off by more than a percent", req: RiskRequest{Weights: map[string]float64{"AAPL": 0.5, "MSFT": 0.4}}, wantErr: "sum to 1"},
+		{name: "duplicate after upper-casing", req: RiskRequest{Weights: map[string]float64{"aapl": 0.5, "AAPL": 0.5}}, wantErr: "twice"},
+		{name: "confidence too low", req: RiskRequest{Weights: map[string]float64{"AAPL": 1}, Confidence: fp(0.3)}, wantErr: "confidence"},
+		{name: "monthly risk-free rate typo", req: RiskRequest{Weights: map[string]float64{"AAPL": 1}, RiskFreeRate: fp(4)}, wantErr: "risk_free_rate"},
+		{name: "lookback too short", req: RiskRequest{Weights: map[string]float64{"AAPL": 1}, LookbackMonths: intp(6)}, wantErr: "lookback_months"},
+		{name: "unknown gap policy", req: RiskRequest{Weights: map[string]float64{"AAPL": 1}, GapPolicy: "interpolate"}, wantErr: "gap policy"},
+		{name: "rescaled within tolerance", req: RiskRequest{Weights: map[string]float64{"aapl": 0.6, "MSFT": 0.395}, Benchmark: "qqq"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			params, err := tt.req.resolve(180)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("got error %v, want one mentioning %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			total := 0.0
+			for _, w := range params.Weights {
+				total += w
+			}
+			if math.Abs(total-1) > 1e-12 {
+				t.Errorf("weights sum to %g, want 1", total)
+			}
+			if _, ok := params.Weights["AAPL"]; !ok {
+				t.Errorf("weights %v, want upper-cased tickers", params.Weights)
+			}
+			if params.Benchmark != "QQQ" || params.Confidence != 0.95 || params.LookbackMonths != 180 || params.GapPolicy != "drop" {
+				t.Errorf("unexpected defaults: %+v", params)
+			}
+			if !params.benchmarkRequired {
+				t.Error("benchmark qqq named by the client is not required")
+			}
+		})
+	}
+
+	params, err := RiskRequest{Weights: map[string]float64{"AAPL": 1}}.resolve(180)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if params.Benchmark != defaultBenchmark || params.benchmarkRequired {
+		t.Errorf("benchmark %s required %v, want the optional default %s", params.Benchmark, params.benchmarkRequired, defaultBenchmark)
+	}
+}
@@ -0,0 +1,230 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/AndrewBrickweg/Finet_v2/cmd/finet/analysis"
+)
+
+// factorMarket names the benchmark among a scenario's shocks; any other
+// factor is a sector from the tickers table's industry column.
+const factorMarket = "market"
+
+const maxShocks = 10
+
+// ScenarioRequest applies hypothetical factor moves to a portfolio the client
+// holds.
+type ScenarioRequest struct {
+	Weights        map[string]float64 `json:"weights"`                // ticker -> weight, summing to 1
+	Shocks         map[string]float64 `json:"shocks"`                 // factor -> return, e.g. {"market": -0.2, "Energy": 0.1}
+	Value          *float64           `json:"value"`                  // portfolio value for the P&L, default 1
+	Benchmark      string             `json:"benchmark"`              // the market factor: a ticker (default SPY), equal_weight or custom
+	Constituents   map[string]float64 `json:"benchmark_constituents"` // benchmark custom only; ticker -> weight
+	LookbackMonths *int               `json:"lookback_months"`        // defaults to the server's history length
+	GapPolicy      string             `json:"gap_policy"`             // drop (default), ffill or reject
+}
+
+// ScenarioParameters echoes the settings a scenario was estimated with.
+type ScenarioParameters struct {
+	Weights        map[string]float64 `json:"weights"` // rescaled to sum to 1
+	Shocks         map[string]float64 `json:"shocks"`
+	Value          float64            `json:"value"`
+	Benchmark      string             `json:"benchmark,omitempty"`
+	Constituents   map[string]float64 `json:"benchmark_constituents,omitempty"`
+	LookbackMonths int                `json:"lookback_months"`
+	GapPolicy      string             `json:"gap_policy"`
+}
+
+type ScenarioResponse struct {
+	*analysis.ScenarioResult
+	Parameters ScenarioParameters
+}
+
+// resolve validates r and fills in defaults. The returned error message is
+// meant for the client.
+func (r ScenarioRequest) resolve(defaultLookback int) (ScenarioParameters, error) {
+	params := ScenarioParameters{Value: 1, LookbackMonths: defaultLookback}
+
+	var err error
+	if params.Weights, err = resolveWeights(r.Weights); err != nil {
+		return params, err
+	}
+
+	if len(r.Shocks) == 0 {
+		return params, errors.New("no shocks provided")
+	}
+	if len(r.Shocks) > maxShocks {
+		return params, fmt.Errorf("at most %d shocks, got %d", maxShocks, len(r.Shocks))
+	}
+	params.Shocks = make(map[string]float64, len(r.Shocks))
+	market := false
+	for factor, shock := range r.Shocks {
+		factor = strings.TrimSpace(factor)
+		if factor == "" {
+			return params, errors.New("shocks has an empty factor")
+		}
+		if strings.EqualFold(factor, factorMarket) {
+			factor, market = factorMarket, true
+		}
+		for seen := range params.Shocks {
+			if strings.EqualFold(seen, factor) {
+				return params, fmt.Errorf("shocks lists %s twice", factor)
+			}
+		}
+		// shocks are returns; 20 for 20% is far more likely than a 2000% move
+		if !(shock > -1 && shock <= 1) {
+			return params, fmt.Errorf("shock to %s must be a return above -1 and at most 1, got %g", factor, shock)
+		}
+		params.Shocks[factor] = shock
+	}
+
+	if market {
+		params.Benchmark, params.Constituents, err = resolveBenchmark(r.Benchmark, r.Constituents)
+		if err != nil {
+			return params, err
+		}
+	} else if r.Benchmark != "" || len(r.Constituents) > 0 {
+		return params, fmt.Errorf("benchmark only applies to a %s shock", factorMarket)
+	}
+
+	if r.Value != nil {
+		if !(*r.Value > 0) || math.IsInf(*r.Value, 1) {
+			return params, fmt.Errorf("value must be positive, got %g", *r.Value)
+		}
+		params.Value = *r.Value
+	}
+
+	if params.LookbackMonths, err = resolveLookback(r.LookbackMonths, params.LookbackMonths); err != nil {
+		return params, err
+	}
+
+	if params.GapPolicy, err = resolveGapPolicy(r.GapPolicy); err != nil {
+		return params, err
+	}
+	return params, nil
+}
+
+// errUnknownFactor is returned by factors for a shock that is neither the
+// market nor a stored industry.
+var errUnknownFactor = errors.New("unknown factor")
+
+// factors loads the return history of every shocked factor: the benchmark for
+// the market and an equally weighted index of every stored ticker in the
+// industry for a sector.
+func (h *Handler) factors(ctx context.Context, params ScenarioParameters) ([]*analysis.Benchmark, error) {
+	var factors []*analysis.Benchmark
+	var sectors []string
+	for _, factor := range sortedKeys(params.Shocks) {
+		if factor != factorMarket {
+			sectors = append(sectors, factor)
+			continue
+		}
+		// the market shock is measured against it, so it is always required
+		b, err := h.benchmark(ctx, params.Benchmark, params.Constituents, params.LookbackMonths, true)
+		if err != nil {
+			return nil, err
+		}
+		b.Name = factorMarket
+		factors = append(factors, b)
+	}
+	if len(sectors) == 0 {
+		return factors, nil
+	}
+
+	tickers, err := h.StockDB.GetAllTickers(ctx)
+	if err != nil {
+		return nil, err
+	}
+	members := make(map[string][]string)
+	for _, t := range tickers {
+		for _, sector := range sectors {
+			if strings.EqualFold(t.Industry, sector) {
+				members[sector] = append(members[sector], t.Ticker)
+			}
+		}
+	}
+	for _, sector := range sectors {
+		if len(members[sector]) == 0 {
+			industries := make(map[string]bool)
+			for _, t := range tickers {
+				if t.Industry != "" {
+					industries[t.Industry] = true
+				}
+			}
+			return nil, fmt.Errorf("%w %q: not %s or a stored industry (%s)", errUnknownFactor, sector, factorMarket, strings.Join(sortedKeys(industries), ", "))
+		}
+		monthly, err := analysis.MakeMonthlyHistory(ctx, members[sector], h.StockDB, params.LookbackMonths)
+		if err != nil {
+			return nil, err
+		}
+		factors = append(factors, &analysis.Benchmark{Name: sector, Constituents: monthly})
+	}
+	return factors, nil
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// ScenarioHandler estimates how factor shocks would move a fixed-weight
+// portfolio, through betas fitted to its stored history.
+func (h *Handler) ScenarioHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req ScenarioRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+
+	params, err := req.resolve(h.RequiredMonths)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+	defer cancel()
+
+	monthlyData, err := analysis.MakeMonthlyDataSlice(ctx, weightTickers(params.Weights), h.StockDB, params.LookbackMonths)
+	if err != nil {
+		writeStockDataError(w, err)
+		return
+	}
+	factors, err := h.factors(ctx, params)
+	if err != nil {
+		switch {
+		case errors.Is(err, errUnknownFactor):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		case errors.Is(err, analysis.ErrNoBenchmark):
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		default:
+			writeStockDataError(w, err)
+		}
+		return
+	}
+
+	result, err := analysis.OrchestrateScenario(monthlyData, params.Weights, factors, params.Shocks, analysis.GapPolicy(params.GapPolicy), params.Value)
+	if err != nil {
+		writeAnalysisError(w, "estimating scenario", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ScenarioResponse{ScenarioResult: result, Parameters: params})
+}
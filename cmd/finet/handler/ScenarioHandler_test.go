@@ -0,0 +1,54 @@
+package handler
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestScenarioRequestResolve(t *testing.T) {
+	weights := map[string]float64{"AAPL": 0.5, "XOM": 0.5}
+	ptr := func(v float64) *float64 { return &v }
+
+	tests := []struct {
+		name    string
+		req     ScenarioRequest
+		wantErr string
+	}{
+		{name: "no weights", wantErr: "no weights"},
+		{name: "no shocks", req: ScenarioRequest{Weights: weights}, wantErr: "no shocks"},
+		{name: "percent not fraction", req: ScenarioRequest{Weights: weights, Shocks: map[string]float64{"market": -20}}, wantErr: "market"},
+		{name: "wiped out", req: ScenarioRequest{Weights: weights, Shocks: map[string]float64{"Energy": -1}}, wantErr: "Energy"},
+		{name: "sector twice", req: ScenarioRequest{Weights: weights, Shocks: map[string]float64{"Energy": 0.1, "energy": 0.2}}, wantErr: "twice"},
+		{name: "market twice", req: ScenarioRequest{Weights: weights, Shocks: map[string]float64{"market": -0.1, "Market": -0.2}}, wantErr: "twice"},
+		{name: "benchmark without market", req: ScenarioRequest{Weights: weights, Shocks: map[string]float64{"Energy": 0.1}, Benchmark: "QQQ"}, wantErr: "market"},
+		{name: "non-positive value", req: ScenarioRequest{Weights: weights, Shocks: map[string]float64{"market": -0.2}, Value: ptr(0)}, wantErr: "value"},
+		{name: "unknown gap policy", req: ScenarioRequest{Weights: weights, Shocks: map[string]float64{"market": -0.2}, GapPolicy: "interpolate"}, wantErr: "gap policy"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tt.req.resolve(60)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("got error %v, want one mentioning %q", err, tt.wantErr)
+			}
+		})
+	}
+
+	params, err := ScenarioRequest{Weights: weights, Shocks: map[string]float64{"MARKET": -0.2, " Energy ": 0.1}}.resolve(60)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if params.Shocks["market"] != -0.2 || params.Shocks["Energy"] != 0.1 || params.Benchmark != defaultBenchmark {
+		t.Errorf("shocks %v against %s, want market and Energy against %s", params.Shocks, params.Benchmark, defaultBenchmark)
+	}
+	if params.Value != 1 || params.LookbackMonths != 60 || params.GapPolicy != "drop" {
+		t.Errorf("unexpected defaults %+v", params)
+	}
+
+	params, err = ScenarioRequest{Weights: weights, Shocks: map[string]float64{"Energy": 0.1}, Value: ptr(250000)}.resolve(60)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if params.Benchmark != "" || params.Value != 250000 {
+		t.Errorf("benchmark %q and value %v, want none and 250000", params.Benchmark, params.Value)
+	}
+}
@@ -0,0 +1,174 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/AndrewBrickweg/Finet_v2/cmd/finet/analysis"
+)
+
+// bounds accepted from simulation requests
+const (
+	minSimulationPaths = 100
+	maxSimulationPaths = 20000
+	maxHorizonMonths   = 600
+)
+
+// SimulateRequest projects the wealth of a portfolio the client holds.
+type SimulateRequest struct {
+	Weights        map[string]float64 `json:"weights"`              // ticker -> weight, summing to 1
+	Initial        float64            `json:"initial"`              // amount invested now
+	Contribution   float64            `json:"monthly_contribution"` // added at every month's close
+	HorizonMonths  int                `json:"horizon_months"`
+	Goal           *float64           `json:"goal"`         // wealth to reach by the horizon
+	Method         string             `json:"method"`       // normal (default) or bootstrap
+	Paths          *int               `json:"paths"`        // default 5000
+	BlockMonths    *int               `json:"block_months"` // bootstrap only, default 12
+	Seed           *int64             `json:"seed"`         // resend a response's seed to reproduce its paths
+	LookbackMonths *int               `json:"lookback_months"`
+	GapPolicy      string             `json:"gap_policy"` // drop (default), ffill or reject
+}
+
+// SimulateParameters echoes the settings a simulation ran with.
+type SimulateParameters struct {
+	Weights        map[string]float64 `json:"weights"` // rescaled to sum to 1
+	Initial        float64            `json:"initial"`
+	Contribution   float64            `json:"monthly_contribution"`
+	HorizonMonths  int                `json:"horizon_months"`
+	Goal           float64            `json:"goal,omitempty"`
+	Method         string             `json:"method"`
+	Paths          int                `json:"paths"`
+	BlockMonths    int                `json:"block_months,omitempty"`
+	Seed           int64              `json:"seed"`
+	LookbackMonths int                `json:"lookback_months"`
+	GapPolicy      string             `json:"gap_policy"`
+}
+
+type SimulateResponse struct {
+	*analysis.SimulationResult
+	Parameters SimulateParameters
+}
+
+// resolve validates r and fills in defaults. The returned error message is
+// meant for the client.
+func (r SimulateRequest) resolve(defaultLookback int) (SimulateParameters, error) {
+	params := SimulateParameters{
+		Paths:          analysis.DefaultSimulationPaths,
+		LookbackMonths: defaultLookback,
+	}
+
+	var err error
+	if params.Weights, err = resolveWeights(r.Weights); err != nil {
+		return params, err
+	}
+
+	if !(r.Initial >= 0) || math.IsInf(r.Initial, 1) || !(r.Contribution >= 0) || math.IsInf(r.Contribution, 1) {
+		return params, errors.New("initial and monthly_contribution must be non-negative")
+	}
+	if r.Initial == 0 && r.Contribution == 0 {
+		return params, errors.New("nothing to invest: give an initial amount or a monthly_contribution")
+	}
+	params.Initial, params.Contribution = r.Initial, r.Contribution
+
+	if r.HorizonMonths < 1 || r.HorizonMonths > maxHorizonMonths {
+		return params, fmt.Errorf("horizon_months must be between 1 and %d, got %d", maxHorizonMonths, r.HorizonMonths)
+	}
+	params.HorizonMonths = r.HorizonMonths
+
+	if r.Goal != nil {
+		if !(*r.Goal > 0) || math.IsInf(*r.Goal, 1) {
+			return params, fmt.Errorf("goal must be positive, got %g", *r.Goal)
+		}
+		params.Goal = *r.Goal
+	}
+
+	method, err := analysis.ParseSimulationMethod(r.Method)
+	if err != nil {
+		return params, err
+	}
+	params.Method = string(method)
+	if method == analysis.SimulateBootstrap {
+		params.BlockMonths = analysis.DefaultBlockMonths
+		if r.BlockMonths != nil {
+			// a block cannot be longer than the history, at least minLookbackMonths
+			if *r.BlockMonths < 1 || *r.BlockMonths > minLookbackMonths {
+				return params, fmt.Errorf("block_months must be between 1 and %d, got %d", minLookbackMonths, *r.BlockMonths)
+			}
+			params.BlockMonths = *r.BlockMonths
+		}
+	} else if r.BlockMonths != nil {
+		return params, errors.New("block_months only applies to method bootstrap")
+	}
+
+	if r.Paths != nil {
+		if *r.Paths < minSimulationPaths || *r.Paths > maxSimulationPaths {
+			return params, fmt.Errorf("paths must be between %d and %d, got %d", minSimulationPaths, maxSimulationPaths, *r.Paths)
+		}
+		params.Paths = *r.Paths
+	}
+
+	if params.Seed, err = resolveSeed(r.Seed); err != nil {
+		return params, err
+	}
+
+	if params.LookbackMonths, err = resolveLookback(r.LookbackMonths, params.LookbackMonths); err != nil {
+		return params, err
+	}
+
+	if params.GapPolicy, err = resolveGapPolicy(r.GapPolicy); err != nil {
+		return params, err
+	}
+	return params, nil
+}
+
+// SimulateHandler projects a fixed-weight portfolio's wealth from its stored
+// history.
+func (h *Handler) SimulateHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req SimulateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+
+	params, err := req.resolve(h.RequiredMonths)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+	defer cancel()
+
+	monthlyData, err := analysis.MakeMonthlyDataSlice(ctx, weightTickers(params.Weights), h.StockDB, params.LookbackMonths)
+	if err != nil {
+		writeStockDataError(w, err)
+		return
+	}
+
+	result, err := analysis.OrchestrateSimulation(ctx, monthlyData, params.Weights, analysis.GapPolicy(params.GapPolicy), analysis.SimulationConfig{
+		Method:       analysis.SimulationMethod(params.Method),
+		Paths:        params.Paths,
+		Months:       params.HorizonMonths,
+		BlockMonths:  params.BlockMonths,
+		Initial:      params.Initial,
+		Contribution: params.Contribution,
+		Goal:         params.Goal,
+		Seed:         params.Seed,
+	})
+	if err != nil {
+		writeAnalysisError(w, "simulating wealth", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(SimulateResponse{SimulationResult: result, Parameters: params})
+}
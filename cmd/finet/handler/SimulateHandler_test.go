@@ -0,0 +1,47 @@
+package handler
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSimulateRequestResolve(t *testing.T) {
+	fp := func(v float64) *float64 { return &v }
+	intp := func(v int) *int { return &v }
+	i64p := func(v int64) *int64 { return &v }
+	weights := map[string]float64{"AAPL": 0.5, "MSFT": 0.5}
+
+	tests := []struct {
+		name    string
+		req     SimulateRequest
+		wantErr string
+	}{
+		{name: "no weights", req: SimulateRequest{Initial: 1000, HorizonMonths: 120}, wantErr: "no weights"},
+		{name: "nothing invested", req: SimulateRequest{Weights: weights, HorizonMonths: 120}, wantErr: "nothing to invest"},
+		{name: "withdrawals", req: SimulateRequest{Weights: weights, Initial: 1000, Contribution: -10, HorizonMonths: 120}, wantErr: "non-negative"},
+		{name: "no horizon", req: SimulateRequest{Weights: weights, Initial: 1000}, wantErr: "horizon_months"},
+		{name: "horizon too long", req: SimulateRequest{Weights: weights, Initial: 1000, HorizonMonths: 1200}, wantErr: "horizon_months"},
+		{name: "zero goal", req: SimulateRequest{Weights: weights, Initial: 1000, HorizonMonths: 120, Goal: fp(0)}, wantErr: "goal"},
+		{name: "unknown method", req: SimulateRequest{Weights: weights, Initial: 1000, HorizonMonths: 120, Method: "garch"}, wantErr: "simulation method"},
+		{name: "blocks without bootstrap", req: SimulateRequest{Weights: weights, Initial: 1000, HorizonMonths: 120, BlockMonths: intp(6)}, wantErr: "block_months"},
+		{name: "blocks longer than the history", req: SimulateRequest{Weights: weights, Initial: 1000, HorizonMonths: 120, Method: "bootstrap", BlockMonths: intp(36)}, wantErr: "block_months"},
+		{name: "too many paths", req: SimulateRequest{Weights: weights, Initial: 1000, HorizonMonths: 120, Paths: intp(1000000)}, wantErr: "paths"},
+		{name: "negative seed", req: SimulateRequest{Weights: weights, Initial: 1000, HorizonMonths: 120, Seed: i64p(-1)}, wantErr: "seed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tt.req.resolve(180)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("got error %v, want one mentioning %q", err, tt.wantErr)
+			}
+		})
+	}
+
+	params, err := SimulateRequest{Weights: weights, Contribution: 500, HorizonMonths: 360, Method: "Bootstrap"}.resolve(180)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if params.Method != "bootstrap" || params.BlockMonths != 12 || params.Paths != 5000 || params.Seed <= 0 || params.LookbackMonths != 180 || params.GapPolicy != "drop" {
+		t.Errorf("unexpected defaults %+v", params)
+	}
+}
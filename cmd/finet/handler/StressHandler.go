@@ -0,0 +1,130 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/AndrewBrickweg/Finet_v2/cmd/finet/analysis"
+)
+
+const maxStressWindows = 20
+
+// StressRequest replays a portfolio the client holds over crisis windows.
+type StressRequest struct {
+	Weights       map[string]float64      `json:"weights"`        // ticker -> weight, summing to 1
+	Windows       []string                `json:"windows"`        // named windows; all of them when neither list is given
+	CustomWindows []analysis.StressWindow `json:"custom_windows"` // {"name", "start", "end"}, dates like 2008-09-15
+	Missing       string                  `json:"missing"`        // renormalize (default), cash or reject
+}
+
+// StressParameters echoes the settings a stress test ran with.
+type StressParameters struct {
+	Weights map[string]float64      `json:"weights"` // rescaled to sum to 1
+	Windows []analysis.StressWindow `json:"windows"`
+	Missing string                  `json:"missing"`
+}
+
+type StressResponse struct {
+	Results    []analysis.StressResult
+	Parameters StressParameters
+}
+
+// resolve validates r and fills in defaults. The returned error message is
+// meant for the client.
+func (r StressRequest) resolve() (StressParameters, error) {
+	var params StressParameters
+	var err error
+	if params.Weights, err = resolveWeights(r.Weights); err != nil {
+		return params, err
+	}
+
+	if len(r.Windows)+len(r.CustomWindows) > maxStressWindows {
+		return params, fmt.Errorf("at most %d windows per request, got %d", maxStressWindows, len(r.Windows)+len(r.CustomWindows))
+	}
+	names := make(map[string]bool)
+	add := func(w analysis.StressWindow) error {
+		if names[w.Name] {
+			return fmt.Errorf("window %s is listed twice", w.Name)
+		}
+		names[w.Name] = true
+		params.Windows = append(params.Windows, w)
+		return nil
+	}
+	if len(r.Windows) == 0 && len(r.CustomWindows) == 0 {
+		params.Windows = append(params.Windows, analysis.StressWindows...)
+	}
+	for _, name := range r.Windows {
+		w, ok := analysis.StressWindowNamed(name)
+		if !ok {
+			var known []string
+			for _, w := range analysis.StressWindows {
+				known = append(known, w.Name)
+			}
+			return params, fmt.Errorf("unknown window %q; named windows are %s", name, strings.Join(known, ", "))
+		}
+		if err := add(w); err != nil {
+			return params, err
+		}
+	}
+	for i, w := range r.CustomWindows {
+		w.Name = strings.TrimSpace(w.Name)
+		if w.Name == "" {
+			w.Name = fmt.Sprintf("custom_%d", i+1)
+		}
+		if err := w.Validate(); err != nil {
+			return params, err
+		}
+		if err := add(w); err != nil {
+			return params, err
+		}
+	}
+
+	missing, err := analysis.ParseMissingPolicy(r.Missing)
+	if err != nil {
+		return params, err
+	}
+	params.Missing = string(missing)
+	return params, nil
+}
+
+// StressHandler replays a fixed-weight portfolio over historical crises using
+// daily closes.
+func (h *Handler) StressHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req StressRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+
+	params, err := req.resolve()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+	defer cancel()
+
+	daily, err := analysis.MakeDailyHistory(ctx, weightTickers(params.Weights), h.StockDB)
+	if err != nil {
+		writeStockDataError(w, err)
+		return
+	}
+
+	results, err := analysis.StressTest(params.Weights, daily, params.Windows, analysis.MissingPolicy(params.Missing))
+	if err != nil {
+		writeAnalysisError(w, "running stress test", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(StressResponse{Results: results, Parameters: params})
+}
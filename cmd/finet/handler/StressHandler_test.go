@@ -0,0 +1,50 @@
+package handler
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/AndrewBrickweg/Finet_v2/cmd/finet/analysis"
+)
+
+func TestStressRequestResolve(t *testing.T) {
+	weights := map[string]float64{"AAPL": 0.5, "MSFT": 0.5}
+	lehman := analysis.StressWindow{Name: "lehman", Start: "2008-09-12", End: "2008-11-20"}
+
+	tests := []struct {
+		name    string
+		req     StressRequest
+		wantErr string
+	}{
+		{name: "no weights", wantErr: "no weights"},
+		{name: "unknown window", req: StressRequest{Weights: weights, Windows: []string{"tulip_mania"}}, wantErr: "covid_2020"},
+		{name: "named twice", req: StressRequest{Weights: weights, Windows: []string{"covid_2020", "COVID_2020"}}, wantErr: "twice"},
+		{name: "custom clashing with a named one", req: StressRequest{Weights: weights, Windows: []string{"covid_2020"}, CustomWindows: []analysis.StressWindow{{Name: "covid_2020", Start: "2020-01-01", End: "2020-06-01"}}}, wantErr: "twice"},
+		{name: "custom backwards", req: StressRequest{Weights: weights, CustomWindows: []analysis.StressWindow{{Start: "2008-11-20", End: "2008-09-12"}}}, wantErr: "custom_1"},
+		{name: "unknown missing policy", req: StressRequest{Weights: weights, Missing: "ignore"}, wantErr: "missing policy"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tt.req.resolve()
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("got error %v, want one mentioning %q", err, tt.wantErr)
+			}
+		})
+	}
+
+	params, err := StressRequest{Weights: weights}.resolve()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(params.Windows) != len(analysis.StressWindows) || params.Missing != "renormalize" {
+		t.Errorf("%d windows under %s, want every named window under renormalize", len(params.Windows), params.Missing)
+	}
+
+	params, err = StressRequest{Weights: weights, Windows: []string{"financial_crisis_2008"}, CustomWindows: []analysis.StressWindow{lehman}, Missing: "cash"}.resolve()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(params.Windows) != 2 || params.Windows[1] != lehman || params.Missing != "cash" {
+		t.Errorf("unexpected parameters %+v", params)
+	}
+}
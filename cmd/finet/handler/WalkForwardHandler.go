@@ -0,0 +1,211 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/AndrewBrickweg/Finet_v2/cmd/finet/analysis"
+)
+
+const maxWalkForwardStrategies = 6
+
+// defaultWalkForwardStrategies sets the Monte Carlo max-Sharpe search against
+// the two baselines it should beat out of sample.
+var defaultWalkForwardStrategies = []string{string(analysis.ModeMonteCarlo), string(analysis.ModeMinVariance), benchmarkEqualWeight}
+
+// WalkForwardRequest evaluates optimizer modes out of sample over tickers. It
+// takes the strategy form of /backtest: strategies replaces mode, every mode
+// is trained with the same settings on lookback_months of history, and
+// rebalance is how often the folds retrain.
+type WalkForwardRequest struct {
+	Strategies []string `json:"strategies"` // optimizer modes or equal_weight; default monte_carlo, min_variance and equal_weight
+	Window     string   `json:"window"`     // rolling (default) or expanding
+
+	BacktestRequest
+}
+
+// WalkForwardParameters echoes the settings a walk-forward evaluation ran
+// with; Strategy holds the optimizer settings the modes share.
+type WalkForwardParameters struct {
+	Strategies  []string `json:"strategies"`
+	Window      string   `json:"window"`
+	TrainMonths int      `json:"train_months"`
+
+	BacktestParameters
+}
+
+type WalkForwardResponse struct {
+	*analysis.WalkForwardResult
+	Parameters WalkForwardParameters
+}
+
+// resolve validates req and builds one strategy per requested mode through
+// BacktestRequest.resolve, leaving the data, sectors and benchmark for the
+// handler to load. The returned error message is meant for the client.
+func (req WalkForwardRequest) resolve() (WalkForwardParameters, analysis.WalkForwardConfig, error) {
+	var params WalkForwardParameters
+	var cfg analysis.WalkForwardConfig
+
+	switch {
+	case req.Weights != nil:
+		return params, cfg, errors.New("walk-forward evaluates strategies over tickers, not fixed weights")
+	case len(req.Tickers) == 0:
+		return params, cfg, errors.New("no tickers provided")
+	case req.Mode != "":
+		return params, cfg, errors.New("list the modes to compare in strategies, not mode")
+	}
+
+	switch window := analysis.WindowScheme(strings.ToLower(strings.TrimSpace(req.Window))); window {
+	case "":
+		cfg.Window = analysis.WindowRolling
+	case analysis.WindowRolling, analysis.WindowExpanding:
+		cfg.Window = window
+	default:
+		return params, cfg, fmt.Errorf("window must be rolling or expanding, got %q", req.Window)
+	}
+	params.Window = string(cfg.Window)
+
+	names := req.Strategies
+	if len(names) == 0 {
+		names = defaultWalkForwardStrategies
+	}
+	if len(names) > maxWalkForwardStrategies {
+		return params, cfg, fmt.Errorf("at most %d strategies, got %d", maxWalkForwardStrategies, len(names))
+	}
+	// every mode trains from the same seed, so the run reproduces as a whole
+	if req.Seed == nil {
+		seed := analysis.NewSeed()
+		req.Seed = &seed
+	}
+
+	optimized := false
+	seen := make(map[string]bool, len(names))
+	for _, name := range names {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			return params, cfg, errors.New("strategies has an empty name")
+		}
+		if seen[name] {
+			return params, cfg, fmt.Errorf("strategies lists %s twice", name)
+		}
+		seen[name] = true
+		params.Strategies = append(params.Strategies, name)
+		if name == benchmarkEqualWeight {
+			cfg.Strategies = append(cfg.Strategies, analysis.WalkForwardStrategy{Name: name})
+			continue
+		}
+
+		mode, err := analysis.ParseOptimizerMode(name)
+		if err != nil {
+			return params, cfg, err
+		}
+		// inputs for one mode only must not fail the others
+		one := req.BacktestRequest
+		one.Mode = string(mode)
+		if mode != analysis.ModeRiskBudget {
+			one.RiskBudgets = nil
+		}
+		if mode != analysis.ModeMinCVaR {
+			one.CVaRConfidence = nil
+		}
+		backtest, strategy, err := one.resolve()
+		if err != nil {
+			return params, cfg, fmt.Errorf("strategy %s: %w", name, err)
+		}
+		cfg.Strategies = append(cfg.Strategies, analysis.WalkForwardStrategy{Name: name, Config: strategy.Strategy})
+		if !optimized {
+			params.BacktestParameters = backtest
+			cfg.TrainMonths, cfg.Hold = strategy.TrainMonths, strategy.Rebalance
+			cfg.Start, cfg.End = strategy.Start, strategy.End
+			cfg.GapPolicy, cfg.Risk = strategy.GapPolicy, strategy.Risk
+			optimized = true
+		}
+	}
+	if !optimized {
+		return params, cfg, fmt.Errorf("strategies needs an optimizer mode to set against %s", benchmarkEqualWeight)
+	}
+
+	switch cfg.Hold {
+	case analysis.RebalanceMonthly, analysis.RebalanceQuarterly, analysis.RebalanceAnnual:
+	default:
+		return params, cfg, fmt.Errorf("folds retrain monthly, quarterly or annually, not on rebalance %s", cfg.Hold)
+	}
+	params.TrainMonths = cfg.TrainMonths
+	params.Strategy.Mode = "" // each strategy has its own
+	return params, cfg, nil
+}
+
+// WalkForwardHandler trains every requested strategy on a moving window of the
+// stored price history and reports how each did on the months that followed.
+func (h *Handler) WalkForwardHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req WalkForwardRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+	params, cfg, err := req.resolve()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// every strategy re-optimizes at every fold
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Minute)
+	defer cancel()
+
+	tickers := params.Strategy.Tickers
+	if len(req.SectorLimits) > 0 {
+		sectors, err := h.tickerSectors(ctx, tickers, req.SectorLevel)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error retrieving sectors: %v", err), http.StatusInternalServerError)
+			return
+		}
+		for _, s := range cfg.Strategies {
+			if s.Config == nil {
+				continue
+			}
+			s.Config.Sectors = sectors
+			if s.Config.SectorLimits, err = matchSectorLimits(s.Config.SectorLimits, sectors, tickers, req.SectorLevel); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+	}
+
+	monthlyData, err := analysis.MakeMonthlyHistory(ctx, tickers, h.StockDB, maxBacktestMonths)
+	if err != nil {
+		writeStockDataError(w, err)
+		return
+	}
+	if len(monthlyData) == 0 {
+		http.Error(w, "Error retrieving stock data: none of the tickers has stored prices", http.StatusUnprocessableEntity)
+		return
+	}
+	cfg.Benchmark, err = h.benchmark(ctx, params.Benchmark, params.Constituents, maxBacktestMonths, params.benchmarkRequired)
+	if err != nil {
+		writeStockDataError(w, err)
+		return
+	}
+
+	result, err := analysis.OrchestrateWalkForward(ctx, monthlyData, cfg)
+	if err != nil {
+		writeAnalysisError(w, "running walk-forward evaluation", err)
+		return
+	}
+	params.Start, params.End = result.Months[0], result.Months[len(result.Months)-1]
+	if result.BenchmarkName == "" {
+		params.Benchmark, params.Constituents = "", nil // the default had nothing to compare with
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(WalkForwardResponse{WalkForwardResult: result, Parameters: params})
+}
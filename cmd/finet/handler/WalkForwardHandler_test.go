@@ -0,0 +1,73 @@
+package handler
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/AndrewBrickweg/Finet_v2/cmd/finet/analysis"
+)
+
+func TestWalkForwardRequestResolve(t *testing.T) {
+	tickers := []string{"AAPL", "MSFT", "XOM"}
+	withTickers := func(req WalkForwardRequest) WalkForwardRequest {
+		req.Tickers = tickers
+		return req
+	}
+
+	tests := []struct {
+		name    string
+		req     WalkForwardRequest
+		wantErr string
+	}{
+		{name: "no tickers", wantErr: "no tickers"},
+		{name: "fixed weights", req: WalkForwardRequest{BacktestRequest: BacktestRequest{Weights: map[string]float64{"AAPL": 1}}}, wantErr: "not fixed weights"},
+		{name: "mode instead of strategies", req: WalkForwardRequest{BacktestRequest: BacktestRequest{PortfolioRequest: PortfolioRequest{Tickers: tickers, Mode: "max_sharpe"}}}, wantErr: "strategies"},
+		{name: "unknown window", req: withTickers(WalkForwardRequest{Window: "sliding"}), wantErr: "window"},
+		{name: "unknown mode", req: withTickers(WalkForwardRequest{Strategies: []string{"max_sortino"}}), wantErr: "optimizer mode"},
+		{name: "strategy twice", req: withTickers(WalkForwardRequest{Strategies: []string{"min_variance", "MIN_VARIANCE"}}), wantErr: "twice"},
+		{name: "baseline alone", req: withTickers(WalkForwardRequest{Strategies: []string{"equal_weight"}}), wantErr: "optimizer mode"},
+		{name: "threshold folds", req: withTickers(WalkForwardRequest{BacktestRequest: BacktestRequest{Rebalance: "threshold"}}), wantErr: "retrain"},
+		{name: "mode missing its inputs", req: withTickers(WalkForwardRequest{Strategies: []string{"target_return"}}), wantErr: "strategy target_return"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := tt.req.resolve()
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("got error %v, want one mentioning %q", err, tt.wantErr)
+			}
+		})
+	}
+
+	params, cfg, err := withTickers(WalkForwardRequest{}).resolve()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !slices.Equal(params.Strategies, defaultWalkForwardStrategies) || len(cfg.Strategies) != 3 || cfg.Strategies[2].Config != nil {
+		t.Errorf("strategies %v, want %v with equal weights unoptimized", params.Strategies, defaultWalkForwardStrategies)
+	}
+	if cfg.Window != analysis.WindowRolling || cfg.Hold != analysis.RebalanceMonthly || cfg.TrainMonths != defaultTrainMonths || cfg.GapPolicy != analysis.GapForwardFill {
+		t.Errorf("unexpected defaults: %+v", cfg)
+	}
+	if params.Strategy == nil || params.Strategy.Mode != "" || !slices.Equal(params.Strategy.Tickers, tickers) {
+		t.Errorf("shared settings %+v, want the tickers without a mode", params.Strategy)
+	}
+
+	// mode-specific inputs only reach their mode, and every mode shares the seed
+	req := withTickers(WalkForwardRequest{Strategies: []string{"Risk_Budget", "min_variance"}, Window: "expanding"})
+	req.RiskBudgets = map[string]float64{"AAPL": 1, "MSFT": 1, "XOM": 2}
+	params, cfg, err = req.resolve()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	budget, minVar := cfg.Strategies[0].Config, cfg.Strategies[1].Config
+	if budget.Mode != analysis.ModeRiskBudget || budget.RiskBudgets == nil || minVar.RiskBudgets != nil {
+		t.Errorf("risk budgets %v for %s and %v for %s, want them on risk_budget only", budget.RiskBudgets, budget.Mode, minVar.RiskBudgets, minVar.Mode)
+	}
+	if budget.Seed == 0 || budget.Seed != minVar.Seed || params.Strategy.Seed != budget.Seed {
+		t.Errorf("seeds %d and %d, want one shared seed", budget.Seed, minVar.Seed)
+	}
+	if cfg.Window != analysis.WindowExpanding || params.Strategies[0] != "risk_budget" {
+		t.Errorf("window %s and strategies %v, want expanding and lower-cased names", cfg.Window, params.Strategies)
+	}
+}
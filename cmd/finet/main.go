@@ -64,6 +64,14 @@ func main() {
 	mux.Handle("POST /register", http.HandlerFunc(appHandler.RegistrationHandler))
 
 	mux.Handle("/portfolio", appHandler.AuthMiddleware(http.HandlerFunc(appHandler.PortfolioHandler)))
+	mux.Handle("POST /portfolio/frontier", appHandler.AuthMiddleware(http.HandlerFunc(appHandler.FrontierHandler)))
+	mux.Handle("POST /portfolio/risk", appHandler.AuthMiddleware(http.HandlerFunc(appHandler.RiskHandler)))
+	mux.Handle("POST /backtest", appHandler.AuthMiddleware(http.HandlerFunc(appHandler.BacktestHandler)))
+	mux.Handle("POST /backtest/walkforward", appHandler.AuthMiddleware(http.HandlerFunc(appHandler.WalkForwardHandler)))
+	mux.Handle("POST /simulate", appHandler.AuthMiddleware(http.HandlerFunc(appHandler.SimulateHandler)))
+	mux.Handle("POST /retirement", appHandler.AuthMiddleware(http.HandlerFunc(appHandler.RetirementHandler)))
+	mux.Handle("POST /stress", appHandler.AuthMiddleware(http.HandlerFunc(appHandler.StressHandler)))
+	mux.Handle("POST /scenario", appHandler.AuthMiddleware(http.HandlerFunc(appHandler.ScenarioHandler)))
 	mux.Handle("/tickers", appHandler.AuthMiddleware(http.HandlerFunc(appHandler.GetTickersHandler)))
 
 	mux.Handle("GET /logout", appHandler.AuthMiddleware(http.HandlerFunc(appHandler.LogoutHandler)))
@@ -4,6 +4,8 @@ import (
 	"context"
 	"database/sql"
 	"log"
+	"strings"
+	"time"
 )
 
 type StockData struct {
@@ -22,6 +24,7 @@ type Ticker struct {
 	Ticker string `json:"ticker"`
 	CompanyName string `json:"company_name"`
 	Industry string `json:"industry"`
+	SubIndustry string `json:"sub_industry,omitempty"`
 }
 
 type StockDB struct {
@@ -108,6 +111,69 @@ func (s *StockDB) QueryStockData(ctx context.Context, ticker string) ([]StockDat
 	return stockData, nil
 }
 
+// QueryMonthEndStockData returns the last stored row of every month for each
+// of tickers, keyed by ticker, over the latest months calendar months any of
+// them has. Only those rows are read, in a single query, however long the
+// stored history is. Tickers without data are left out.
+func (s *StockDB) QueryMonthEndStockData(ctx context.Context, tickers []string, months int) (map[string][]StockData, error) {
+	result := make(map[string][]StockData, len(tickers))
+	if len(tickers) == 0 || months < 1 {
+		return result, nil
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(tickers)), ",")
+	args := make([]any, len(tickers), len(tickers)+1)
+	for i, t := range tickers {
+		args[i] = t
+	}
+
+	var latest sql.NullString
+	if err := s.DBService.db.QueryRowContext(ctx, `
+		SELECT MAX(date)
+		FROM stock_data
+		WHERE ticker IN (`+placeholders+`)
+	`, args...).Scan(&latest); err != nil {
+		return nil, err
+	}
+	if !latest.Valid || len(latest.String) < 10 {
+		return result, nil
+	}
+	end, err := time.Parse(time.DateOnly, latest.String[:10])
+	if err != nil {
+		return nil, err
+	}
+	since := time.Date(end.Year(), end.Month()-time.Month(months-1), 1, 0, 0, 0, 0, time.UTC)
+
+	rows, err := s.DBService.db.QueryContext(ctx, `
+		SELECT sd.ticker, sd.date, sd.open, sd.high, sd.low, sd.close, sd.adj_close, sd.volume, sd.dividend
+		FROM stock_data sd
+		JOIN (
+			SELECT ticker, MAX(date) AS date
+			FROM stock_data
+			WHERE ticker IN (`+placeholders+`) AND date >= ?
+			GROUP BY ticker, YEAR(date), MONTH(date)
+		) month_end ON month_end.ticker = sd.ticker AND month_end.date = sd.date
+		ORDER BY sd.ticker, sd.date ASC
+	`, append(args, since.Format(time.DateOnly))...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var sd StockData
+		if err := rows.Scan(&sd.Ticker, &sd.Date, &sd.Open, &sd.High, &sd.Low, &sd.Close, &sd.AdjClose, &sd.Volume, &sd.Dividend); err != nil {
+			return nil, err
+		}
+		result[sd.Ticker] = append(result[sd.Ticker], sd)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
 func MonthKey(date string) string {
 	return date[:7]
 }
@@ -146,3 +212,43 @@ func(s *StockDB) GetAllTickers(ctx context.Context)([]Ticker, error){
 
 	return tickers, nil
 }
+
+// GetTickerClassifications returns the sector (industry column) and sub-industry
+// of each requested ticker. Tickers missing from the tickers table are omitted.
+func (s *StockDB) GetTickerClassifications(ctx context.Context, tickers []string) (map[string]Ticker, error) {
+	result := make(map[string]Ticker, len(tickers))
+	if len(tickers) == 0 {
+		return result, nil
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(tickers)), ",")
+	args := make([]any, len(tickers))
+	for i, t := range tickers {
+		args[i] = t
+	}
+
+	rows, err := s.DBService.db.QueryContext(ctx, `
+		SELECT ticker, company_name, industry, sub_industry
+		FROM tickers
+		WHERE ticker IN (`+placeholders+`)
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var t Ticker
+		var name, industry, subIndustry sql.NullString
+		if err := rows.Scan(&t.Ticker, &name, &industry, &subIndustry); err != nil {
+			return nil, err
+		}
+		t.CompanyName, t.Industry, t.SubIndustry = name.String, industry.String, subIndustry.String
+		result[t.Ticker] = t
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
@@ -48,13 +48,11 @@ const PortfolioPanel = ({
   }, 0);
 
   const retPct =
-    hasPortfolio ? formatPct(portfolio!.BestPortfolio.Return * 12) : "–";
+    hasPortfolio ? formatPct(portfolio!.BestPortfolio.AnnualReturn) : "–";
   const volPct =
-    hasPortfolio ?
-      formatPct(portfolio!.BestPortfolio.Risk * Math.sqrt(12))
-    : "–";
+    hasPortfolio ? formatPct(portfolio!.BestPortfolio.AnnualRisk) : "–";
   const sharpe =
-    hasPortfolio ? formatNumber(portfolio!.BestPortfolio.Sharpe, 2) : "–";
+    hasPortfolio ? formatNumber(portfolio!.BestPortfolio.AnnualSharpe, 2) : "–";
 
   return (
     <section className="container mx-auto p-6 bg-white dark:bg-gray-800 rounded-xl shadow mb-10">
@@ -185,7 +183,7 @@ const PortfolioPanel = ({
 
         <div className="rounded-lg border border-gray-200 dark:border-gray-700 p-4">
           <div className="text-xs uppercase tracking-wide text-gray-500 dark:text-gray-400">
-            Sharpe Ratio (monthly returns)
+            Annualized Sharpe Ratio
           </div>
           <div className="mt-1 text-lg font-semibold tabular-nums text-gray-900 dark:text-gray-100">
             {sharpe}
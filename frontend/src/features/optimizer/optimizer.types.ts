@@ -3,11 +3,55 @@ export type BestPortfolio = {
   Return: number;
   Risk: number;
   Sharpe: number;
+  Frequency: "daily" | "weekly" | "monthly";
+  AnnualReturn: number;
+  AnnualRisk: number;
+  AnnualSharpe: number;
+  Clusters?: Dendrogram;
+  RiskContributions?: RiskContributions;
+};
+
+export type RiskContributions = {
+  Marginal: Record<string, number>;
+  Component: Record<string, number>;
+  Percent: Record<string, number>;
+  DiversificationRatio: number;
+  EffectiveBets: number;
+};
+
+export type Dendrogram = {
+  Tickers: string[];
+  Order: string[];
+  Merges: { Left: number; Right: number; Distance: number; Size: number }[];
+};
+
+export type GapReport = {
+  Policy: "drop" | "ffill" | "reject";
+  Start: string;
+  End: string;
+  DroppedMonths?: string[];
+  FilledMonths?: Record<string, string[]>;
+  RejectedTickers?: string[];
 };
 
 export type PortfolioResponse = {
   BestPortfolio: BestPortfolio;
   Returns: Record<string, number[]>;
+  Months: string[];
+  Gaps: GapReport;
+  BlackLitterman?: {
+    Frequency: "daily" | "weekly" | "monthly";
+    Equilibrium: Record<string, number>;
+    Posterior: Record<string, number>;
+  };
+  Benchmark?: {
+    Name: string;
+    Returns: number[];
+    Beta: number;
+    Alpha: number;
+    TrackingError: number;
+    InformationRatio: number;
+  };
 };
 
 export type Ticker = {